@@ -0,0 +1,113 @@
+package getlatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler returns an http.Handler that serves the admin API:
+//
+//	GET  /targets                   status of all targets (JSON)
+//	POST /targets/{output}/fetch    start a download attempt now
+//	POST /targets/{output}/pause    stop scheduling downloads
+//	POST /targets/{output}/resume   resume scheduling downloads
+//
+// In these paths, {output} is the output file path, with or without
+// its leading slash, e.g., /targets/tmp/example.html/fetch.
+//
+// The handler does no authentication, so it should only be served on
+// a loopback address or otherwise protected listener, not alongside
+// HealthHandler and metrics. Requests from web pages (i.e., with an
+// Origin header, or a Sec-Fetch-Site header other than "none") are
+// rejected, so a browser on the same host can't be used to send
+// cross-site requests.
+func (m *Manager) AdminHandler() http.Handler {
+	actions := map[string]func(string) error{
+		"fetch":  m.TriggerNow,
+		"pause":  m.Pause,
+		"resume": m.Resume,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/targets", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, m.Status())
+	})
+	mux.HandleFunc("/targets/", func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, "/targets/")
+		slash := strings.LastIndex(name, "/")
+		action := actions[name[slash+1:]]
+		if slash < 0 || action == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if req.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		output, ok := m.lookup(name[:slash])
+		if !ok {
+			http.Error(w, "no such target", http.StatusNotFound)
+			return
+		}
+		if err := action(output); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if site := req.Header.Get("Sec-Fetch-Site"); req.Header.Get("Origin") != "" || (site != "" && site != "none") {
+			http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
+
+// HealthHandler returns an http.Handler that serves health and
+// status endpoints for load balancers and dashboards:
+//
+//	GET /healthz   200 if the manager is running, otherwise 503
+//	GET /status    status of all targets (JSON)
+func (m *Manager) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		if !m.Running() {
+			http.Error(w, "not running", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, m.Status())
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// lookup returns the output path of the target identified by name,
+// which may be missing the output path's leading slash.
+func (m *Manager) lookup(name string) (string, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, output := range []string{name, "/" + name} {
+		if _, ok := m.getters[output]; ok {
+			return output, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,129 @@
+package getlatest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "foo")
+	g := &Getter{
+		URL:    "http://host.example/foo",
+		Output: output,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set up a manager without starting the getter goroutine, so
+	// the trigger stays in the channel where we can see it.
+	mgr := &Manager{getters: map[string]*Getter{output: g}}
+	h := mgr.AdminHandler()
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/targets", nil))
+	var status []Status
+	err = json.Unmarshal(resp.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].Output != output {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	for _, trial := range []struct {
+		method string
+		path   string
+		header http.Header
+		code   int
+	}{
+		{"GET", "/targets" + output + "/fetch", nil, http.StatusMethodNotAllowed},
+		{"POST", "/targets/nonexistent/fetch", nil, http.StatusNotFound},
+		{"POST", "/targets" + output, nil, http.StatusNotFound},
+		{"POST", "/targets" + output + "/fetch", http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+		{"POST", "/targets" + output + "/fetch", http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{"POST", "/targets" + output + "/fetch", nil, http.StatusAccepted},
+	} {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(trial.method, trial.path, nil)
+		for k, v := range trial.header {
+			req.Header[k] = v
+		}
+		h.ServeHTTP(resp, req)
+		if resp.Code != trial.code {
+			t.Errorf("%s %s: expected %d, got %d", trial.method, trial.path, trial.code, resp.Code)
+		}
+	}
+	select {
+	case <-g.trigger:
+	default:
+		t.Error("getter was not triggered")
+	}
+
+	for _, trial := range []struct {
+		action string
+		paused bool
+	}{
+		{"pause", true},
+		{"pause", true},
+		{"resume", false},
+	} {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("POST", "/targets"+output+"/"+trial.action, nil))
+		if resp.Code != http.StatusAccepted {
+			t.Errorf("%s: expected %d, got %d", trial.action, http.StatusAccepted, resp.Code)
+		}
+		if st := mgr.Status(); st[0].Paused != trial.paused {
+			t.Errorf("%s: expected Paused=%v, got %+v", trial.action, trial.paused, st[0])
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "foo")
+	err := ioutil.WriteFile(output, []byte("hello\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Getter{
+		URL:    "http://host.example/foo",
+		Output: output,
+	}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := &Manager{}
+	h := mgr.HealthHandler()
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before start, got %d", resp.Code)
+	}
+
+	mgr.getters = map[string]*Getter{output: g}
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected 200 after start, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/status", nil))
+	var status []Status
+	err = json.Unmarshal(resp.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].Output != output || status[0].Size != 6 || status[0].URL != g.URL {
+		t.Errorf("unexpected status %+v", status)
+	} else if expect := g.lastSuccess.Add(time.Hour); !status[0].NextEligible.Equal(expect) {
+		t.Errorf("expected NextEligible %s, got %s", expect, status[0].NextEligible)
+	}
+}
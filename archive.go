@@ -0,0 +1,179 @@
+package getlatest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var zipMagic = []byte("PK\x03\x04")
+
+// errStopWalk can be returned by a walkArchive callback to stop
+// walking without error.
+var errStopWalk = errors.New("stop walking")
+
+// walkArchive calls fn for each entry in the zip or tar archive in
+// src. A tar archive can be compressed with gzip, bzip2, or zstd.
+// Entry names are cleaned, and have no leading "/" or "./".
+func walkArchive(src *os.File, fn func(name string, hdr *tar.Header, r io.Reader) error) error {
+	magic := make([]byte, 4)
+	_, err := io.ReadFull(src, magic)
+	if err != nil {
+		return fmt.Errorf("error reading archive: %s", err)
+	}
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(magic, zipMagic) {
+		err = walkZip(src, fn)
+	} else {
+		err = walkTar(src, magic, fn)
+	}
+	if err == errStopWalk {
+		err = nil
+	}
+	return err
+}
+
+func walkZip(src *os.File, fn func(name string, hdr *tar.Header, r io.Reader) error) error {
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(src, fi.Size())
+	if err != nil {
+		return fmt.Errorf("error reading zip archive: %s", err)
+	}
+	for _, zf := range zr.File {
+		hdr, err := tar.FileInfoHeader(zf.FileInfo(), "")
+		if err != nil {
+			return err
+		}
+		var r io.ReadCloser
+		if zf.FileInfo().Mode().IsRegular() {
+			r, err = zf.Open()
+			if err != nil {
+				return fmt.Errorf("error reading %q from zip archive: %s", zf.Name, err)
+			}
+		} else {
+			r = io.NopCloser(strings.NewReader(""))
+		}
+		err = fn(cleanArchivePath(zf.Name), hdr, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(src *os.File, magic []byte, fn func(name string, hdr *tar.Header, r io.Reader) error) error {
+	var r io.Reader = bufio.NewReader(src)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("gzip: %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(magic, bzip2Magic):
+		r = bzip2.NewReader(r)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("zstd: %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			// Read the rest of the stream, so a compressed
+			// archive's trailer and checksum are verified.
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return fmt.Errorf("error reading tar archive: %s", err)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading tar archive: %s", err)
+		}
+		err = fn(cleanArchivePath(hdr.Name), hdr, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// archiveExtractor returns a rewriteFunc that extracts the first
+// regular file whose path inside the archive matches the given glob
+// pattern.
+func archiveExtractor(pattern string) (rewriteFunc, error) {
+	pattern = cleanArchivePath(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid ArchiveFilter pattern %q: %s", pattern, err)
+	}
+	return func(w io.Writer, src *os.File) error {
+		found := false
+		err := walkArchive(src, func(name string, hdr *tar.Header, r io.Reader) error {
+			if !hdr.FileInfo().Mode().IsRegular() {
+				return nil
+			}
+			if ok, _ := path.Match(pattern, name); !ok {
+				return nil
+			}
+			found = true
+			_, err := io.Copy(w, r)
+			if err != nil {
+				return fmt.Errorf("error extracting %q from archive: %s", name, err)
+			}
+			return errStopWalk
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("no file matching ArchiveFilter %q found in archive", pattern)
+		}
+		return nil
+	}, nil
+}
+
+// checkArchive returns an error if CheckArchive is set and the named
+// file is not a complete, readable archive. Every entry is read in
+// full, so zip CRCs and gzip/zstd checksums are verified.
+func (g *Getter) checkArchive(name string) error {
+	if !g.CheckArchive {
+		return nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return walkArchive(f, func(name string, hdr *tar.Header, r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		if err != nil {
+			return fmt.Errorf("error reading %q from archive: %s", name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,157 @@
+package getlatest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testArchives returns a zip archive and a tar.gz archive, each
+// containing the given files (name, content) in order. Directory
+// names end with "/".
+func testArchives(t *testing.T, files ...[2]string) (zipData, tgzData []byte) {
+	var zbuf, tbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	gw := gzip.NewWriter(&tbuf)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		name, content := file[0], file[1]
+		if strings.HasSuffix(name, "/") {
+			zw.Create(name)
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755})
+			continue
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+		tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	zw.Close()
+	tw.Close()
+	gw.Close()
+	return zbuf.Bytes(), tbuf.Bytes()
+}
+
+func TestArchiveFilter(t *testing.T) {
+	zipData, tgzData := testArchives(t,
+		[2]string{"release-1.0/", ""},
+		[2]string{"release-1.0/README", "readme\n"},
+		[2]string{"release-1.0/bin/example", "#!/bin/sh\necho example\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/release.zip":
+			w.Write(zipData)
+		case "/release.tgz":
+			w.Write(tgzData)
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path    string
+		filter  string
+		content string
+	}{
+		{"/release.zip", "*/bin/example", "#!/bin/sh\necho example\n"},
+		{"/release.tgz", "*/bin/example", "#!/bin/sh\necho example\n"},
+		{"/release.tgz", "release-1.0/README", "readme\n"},
+		{"/release.zip", "*/bin/missing", ""},
+		{"/release.tgz", "release-1.0", ""},
+	} {
+		g := &Getter{
+			URL:           srv.URL + trial.path,
+			Output:        filepath.Join(t.TempDir(), "foo"),
+			ArchiveFilter: trial.filter,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.content == "" {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.content {
+			t.Errorf("%+v: output file %q, %v", trial, buf, err)
+		}
+	}
+}
+
+func TestCheckArchive(t *testing.T) {
+	zipData, tgzData := testArchives(t,
+		[2]string{"release-1.0/", ""},
+		[2]string{"release-1.0/README", strings.Repeat("readme\n", 100)})
+	corrupt := func(data []byte, pos int) []byte {
+		data = append([]byte(nil), data...)
+		data[pos] ^= 0xff
+		return data
+	}
+	// The README entry's compressed data follows its name in
+	// the local file header.
+	zipBadData := corrupt(zipData, bytes.Index(zipData, []byte("release-1.0/README"))+len("release-1.0/README")+2)
+	tgzBadCRC := corrupt(tgzData, len(tgzData)-8)
+	tgzTruncated := tgzData[:len(tgzData)-4]
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/good.zip":
+			w.Write(zipData)
+		case "/good.tgz":
+			w.Write(tgzData)
+		case "/bad-data.zip":
+			w.Write(zipBadData)
+		case "/bad-crc.tgz":
+			w.Write(tgzBadCRC)
+		case "/truncated.tgz":
+			w.Write(tgzTruncated)
+		case "/plain.txt":
+			w.Write([]byte("not an archive\n"))
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path string
+		ok   bool
+	}{
+		{"/good.zip", true},
+		{"/good.tgz", true},
+		{"/bad-data.zip", false},
+		{"/bad-crc.tgz", false},
+		{"/truncated.tgz", false},
+		{"/plain.txt", false},
+	} {
+		g := &Getter{
+			URL:          srv.URL + trial.path,
+			Output:       filepath.Join(t.TempDir(), "foo"),
+			CheckArchive: true,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%s: %s", trial.path, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s: expected error", trial.path)
+		} else if !trial.ok && g.haveOutput() {
+			t.Errorf("%s: output file was written despite error", trial.path)
+		}
+	}
+}
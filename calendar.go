@@ -0,0 +1,282 @@
+package getlatest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A weekdaySet is a set of days of the week. The zero value is an
+// empty set.
+type weekdaySet uint8
+
+func (s weekdaySet) has(d time.Weekday) bool {
+	return s&(1<<uint(d)) != 0
+}
+
+func (s *weekdaySet) add(d time.Weekday) {
+	*s |= 1 << uint(d)
+}
+
+var weekdayNames = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		weekdayNames[name] = d
+		weekdayNames[name[:3]] = d
+	}
+}
+
+// parseWeekdays parses a list of days separated by spaces and/or
+// commas. Each item is a day name ("mon" or "monday"), a range of
+// days ("mon-fri", "fri-mon"), "weekday(s)", or "weekend(s)".
+func parseWeekdays(spec string) (weekdaySet, error) {
+	var set weekdaySet
+	for _, item := range splitList(strings.ToLower(spec)) {
+		switch item {
+		case "weekday", "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				set.add(d)
+			}
+			continue
+		case "weekend", "weekends":
+			set.add(time.Saturday)
+			set.add(time.Sunday)
+			continue
+		}
+		first, last := item, item
+		if i := strings.Index(item, "-"); i >= 0 {
+			first, last = item[:i], item[i+1:]
+		}
+		d0, ok0 := weekdayNames[first]
+		d1, ok1 := weekdayNames[last]
+		if !ok0 || !ok1 {
+			return 0, fmt.Errorf("unknown day %q", item)
+		}
+		for d := d0; ; d = (d + 1) % 7 {
+			set.add(d)
+			if d == d1 {
+				break
+			}
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("no days specified")
+	}
+	return set, nil
+}
+
+// A dayOfMonthSet is a set of days of the month (bits 1-31), plus
+// bit 0 for the last day of the month. The zero value is an empty
+// set.
+type dayOfMonthSet uint32
+
+func (s dayOfMonthSet) has(t time.Time) bool {
+	if s&(1<<uint(t.Day())) != 0 {
+		return true
+	}
+	return s&1 != 0 && t.AddDate(0, 0, 1).Day() == 1
+}
+
+// parseDaysOfMonth parses a list of days of the month separated by
+// spaces and/or commas. Each item is a number (1-31), a range of
+// numbers ("1-7"), or "last".
+func parseDaysOfMonth(spec string) (dayOfMonthSet, error) {
+	var set dayOfMonthSet
+	for _, item := range splitList(strings.ToLower(spec)) {
+		if item == "last" {
+			set |= 1
+			continue
+		}
+		first, last, err := parseRange(item, 1, 31, nil)
+		if err != nil {
+			return 0, err
+		}
+		for d := first; d <= last; d++ {
+			set |= 1 << uint(d)
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("no days specified")
+	}
+	return set, nil
+}
+
+// A monthSet is a set of months (bits 1-12). The zero value is an
+// empty set.
+type monthSet uint16
+
+func (s monthSet) has(m time.Month) bool {
+	return s&(1<<uint(m)) != 0
+}
+
+var monthNames = map[string]int{}
+
+func init() {
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		monthNames[name] = int(m)
+		monthNames[name[:3]] = int(m)
+	}
+}
+
+// parseMonths parses a list of months separated by spaces and/or
+// commas. Each item is a month name ("jan" or "january"), a number
+// (1-12), or a range ("jan-mar", "nov-feb", "1-6").
+func parseMonths(spec string) (monthSet, error) {
+	var set monthSet
+	for _, item := range splitList(strings.ToLower(spec)) {
+		first, last, err := parseRange(item, 1, 12, monthNames)
+		if err != nil {
+			return 0, err
+		}
+		for m := first; ; m = m%12 + 1 {
+			set |= 1 << uint(m)
+			if m == last {
+				break
+			}
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("no months specified")
+	}
+	return set, nil
+}
+
+// splitList splits a list of items separated by spaces and/or
+// commas.
+func splitList(spec string) []string {
+	return strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// parseRange parses a single value or a range ("first-last") of
+// values between min and max, each given as a number or one of the
+// given names.
+func parseRange(item string, min, max int, names map[string]int) (int, int, error) {
+	first, last := item, item
+	if i := strings.Index(item, "-"); i >= 0 {
+		first, last = item[:i], item[i+1:]
+	}
+	var vals [2]int
+	for i, s := range []string{first, last} {
+		v, ok := names[s]
+		if !ok {
+			var err error
+			v, err = strconv.Atoi(s)
+			if err != nil || v < min || v > max {
+				return 0, 0, fmt.Errorf("invalid value %q", item)
+			}
+		}
+		vals[i] = v
+	}
+	if names == nil && vals[0] > vals[1] {
+		return 0, 0, fmt.Errorf("invalid range %q", item)
+	}
+	return vals[0], vals[1], nil
+}
+
+// parseAlignTo parses an AlignTo value: "hour", "day", or a duration
+// that divides a day evenly, like "15m" or "6h". It returns 24h for
+// "day" or "24h", which aligns to midnight even on days that are not
+// 24 hours long. An empty string means no alignment.
+func parseAlignTo(s string) (time.Duration, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return 0, nil
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second || d > 24*time.Hour || (24*time.Hour)%d != 0 {
+		return 0, fmt.Errorf("must evenly divide 24h")
+	}
+	return d, nil
+}
+
+// alignDown returns the latest boundary at or before t, where
+// boundaries are multiples of d after midnight (in t's location).
+func alignDown(t time.Time, d time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if d >= 24*time.Hour {
+		return midnight
+	}
+	return midnight.Add(t.Sub(midnight) / d * d)
+}
+
+// alignUp returns the earliest boundary at or after t.
+func alignUp(t time.Time, d time.Duration) time.Time {
+	down := alignDown(t, d)
+	if down.Equal(t) {
+		return t
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.AddDate(0, 0, 1)
+	if d >= 24*time.Hour {
+		return next
+	}
+	if up := down.Add(d); up.Before(next) {
+		return up
+	}
+	return next
+}
+
+// A timeWindow is a range of times of day, in minutes after midnight.
+// Both ends are inclusive, so "06:00-08:00" includes 08:00:59. If
+// start > end, the window spans midnight.
+type timeWindow struct {
+	start, end int
+}
+
+func (w timeWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return m >= w.start && m <= w.end
+	}
+	return m >= w.start || m <= w.end
+}
+
+// startDay returns t, or the same time on the previous day if t is
+// after midnight in a window that spans midnight. t must be in w.
+func (w timeWindow) startDay(t time.Time) time.Time {
+	if w.start > w.end && t.Hour()*60+t.Minute() <= w.end {
+		return t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// parseClock parses a time of day like "6:00" or "18:30" and returns
+// minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWindow parses a time window like "06:00-08:00" or
+// "22:00-02:00".
+func parseWindow(s string) (timeWindow, error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return timeWindow{}, fmt.Errorf("invalid time window %q (should be like 06:00-08:00)", s)
+	}
+	start, err := parseClock(s[:i])
+	if err != nil {
+		return timeWindow{}, fmt.Errorf("invalid time window %q: %s", s, err)
+	}
+	end, err := parseClock(s[i+1:])
+	if err != nil {
+		return timeWindow{}, fmt.Errorf("invalid time window %q: %s", s, err)
+	}
+	return timeWindow{start, end}, nil
+}
@@ -0,0 +1,301 @@
+package getlatest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	sun, mon, tue, wed, thu, fri, sat := time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday
+	for _, trial := range []struct {
+		spec   string
+		expect []time.Weekday
+	}{
+		{"mon tue wed", []time.Weekday{mon, tue, wed}},
+		{"Mon,Tue, Wednesday", []time.Weekday{mon, tue, wed}},
+		{"mon-fri", []time.Weekday{mon, tue, wed, thu, fri}},
+		{"fri-mon", []time.Weekday{fri, sat, sun, mon}},
+		{"weekday", []time.Weekday{mon, tue, wed, thu, fri}},
+		{"weekends", []time.Weekday{sat, sun}},
+		{"sun wed-thu", []time.Weekday{sun, wed, thu}},
+		{"thur", nil},
+		{"mon-", nil},
+		{"mon-blah", nil},
+		{",", nil},
+	} {
+		set, err := parseWeekdays(trial.spec)
+		if trial.expect == nil {
+			if err == nil {
+				t.Errorf("%q: expected error, got %b", trial.spec, set)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %s", trial.spec, err)
+			continue
+		}
+		var expect weekdaySet
+		for _, d := range trial.expect {
+			expect.add(d)
+		}
+		if set != expect {
+			t.Errorf("%q: expected %b, got %b", trial.spec, expect, set)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	for _, trial := range []struct {
+		g      *Getter
+		clock  string
+		should bool
+	}{
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00"}, "21:59", false},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00"}, "22:00", true},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00"}, "00:30", true},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00"}, "02:00", true},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00"}, "02:01", false},
+		{&Getter{NotAfter: "02:00"}, "00:00", true},
+		{&Getter{NotAfter: "02:00"}, "03:00", false},
+		{&Getter{Windows: []string{"06:00-08:00", "18:00-20:00"}}, "07:00", true},
+		{&Getter{Windows: []string{"06:00-08:00", "18:00-20:00"}}, "12:00", false},
+		{&Getter{Windows: []string{"06:00-08:00", "18:00-20:00"}}, "20:00", true},
+		{&Getter{Windows: []string{"06:00-08:00", "23:00-1:00"}}, "00:15", true},
+	} {
+		g := trial.g
+		g.URL = "http://host.example/foo"
+		g.Timezone = "UTC"
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now, err := time.Parse(time.RFC3339, "2019-08-28T"+trial.clock+":30Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.should(now); got != trial.should {
+			t.Errorf("%+v at %s: expected %v, got %v", trial.g, now, trial.should, got)
+		}
+	}
+
+	// Weekdays etc. are checked against the day the window
+	// started. 2019-08-30 is a Friday.
+	for _, trial := range []struct {
+		g      *Getter
+		time   string
+		should bool
+	}{
+		{&Getter{Windows: []string{"22:00-02:00"}, Weekdays: "fri"}, "2019-08-29T23:00:00Z", false},
+		{&Getter{Windows: []string{"22:00-02:00"}, Weekdays: "fri"}, "2019-08-30T01:00:00Z", false},
+		{&Getter{Windows: []string{"22:00-02:00"}, Weekdays: "fri"}, "2019-08-30T23:00:00Z", true},
+		{&Getter{Windows: []string{"22:00-02:00"}, Weekdays: "fri"}, "2019-08-31T01:00:00Z", true},
+		{&Getter{Windows: []string{"22:00-02:00"}, Weekdays: "fri"}, "2019-09-01T01:00:00Z", false},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00", DaysOfMonth: "last"}, "2019-09-01T01:00:00Z", true},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00", Months: "aug"}, "2019-09-01T01:00:00Z", true},
+		{&Getter{NotBefore: "22:00", NotAfter: "02:00", Months: "aug"}, "2019-08-01T01:00:00Z", false},
+	} {
+		g := trial.g
+		g.URL = "http://host.example/foo"
+		g.Timezone = "UTC"
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		now, err := time.Parse(time.RFC3339, trial.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.should(now); got != trial.should {
+			t.Errorf("%+v at %s: expected %v, got %v", trial.g, now, trial.should, got)
+		}
+	}
+
+	for _, g := range []*Getter{
+		{Windows: []string{"06:00"}},
+		{Windows: []string{"06:00-25:00"}},
+		{Windows: []string{"06:00-08:00"}, NotBefore: "07:00"},
+		{NotBefore: "7am"},
+	} {
+		g.URL = "http://host.example/foo"
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected error", g)
+		}
+	}
+}
+
+func TestParseDaysOfMonth(t *testing.T) {
+	for _, trial := range []struct {
+		spec   string
+		expect []int // 0 means last
+	}{
+		{"1 15", []int{1, 15}},
+		{"1,15, 28-31", []int{1, 15, 28, 29, 30, 31}},
+		{"Last", []int{0}},
+		{"1-3 last", []int{0, 1, 2, 3}},
+		{"0", nil},
+		{"32", nil},
+		{"15-1", nil},
+		{"1-", nil},
+		{"first", nil},
+		{",", nil},
+	} {
+		set, err := parseDaysOfMonth(trial.spec)
+		if trial.expect == nil {
+			if err == nil {
+				t.Errorf("%q: expected error, got %b", trial.spec, set)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %s", trial.spec, err)
+			continue
+		}
+		var expect dayOfMonthSet
+		for _, d := range trial.expect {
+			expect |= 1 << uint(d)
+		}
+		if set != expect {
+			t.Errorf("%q: expected %b, got %b", trial.spec, expect, set)
+		}
+	}
+}
+
+func TestParseMonths(t *testing.T) {
+	jan, feb, mar, apr, jul, oct, nov, dec := time.January, time.February, time.March, time.April, time.July, time.October, time.November, time.December
+	for _, trial := range []struct {
+		spec   string
+		expect []time.Month
+	}{
+		{"jan apr jul oct", []time.Month{jan, apr, jul, oct}},
+		{"January, 2 3", []time.Month{jan, feb, mar}},
+		{"jan-mar", []time.Month{jan, feb, mar}},
+		{"nov-feb", []time.Month{nov, dec, jan, feb}},
+		{"1-3", []time.Month{jan, feb, mar}},
+		{"13", nil},
+		{"janu", nil},
+		{"jan-", nil},
+		{"", nil},
+	} {
+		set, err := parseMonths(trial.spec)
+		if trial.expect == nil {
+			if err == nil {
+				t.Errorf("%q: expected error, got %b", trial.spec, set)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %s", trial.spec, err)
+			continue
+		}
+		var expect monthSet
+		for _, m := range trial.expect {
+			expect |= 1 << uint(m)
+		}
+		if set != expect {
+			t.Errorf("%q: expected %b, got %b", trial.spec, expect, set)
+		}
+	}
+}
+
+func TestDaysOfMonth(t *testing.T) {
+	for _, trial := range []struct {
+		g      *Getter
+		date   string
+		should bool
+	}{
+		{&Getter{DaysOfMonth: "1", NotBefore: "06:00"}, "2019-08-01T06:00:00Z", true},
+		{&Getter{DaysOfMonth: "1", NotBefore: "06:00"}, "2019-08-01T05:59:00Z", false},
+		{&Getter{DaysOfMonth: "1", NotBefore: "06:00"}, "2019-08-02T06:00:00Z", false},
+		{&Getter{DaysOfMonth: "last"}, "2019-02-28T12:00:00Z", true},
+		{&Getter{DaysOfMonth: "last"}, "2020-02-28T12:00:00Z", false},
+		{&Getter{DaysOfMonth: "last"}, "2020-02-29T12:00:00Z", true},
+		{&Getter{DaysOfMonth: "31"}, "2019-09-30T12:00:00Z", false},
+		// first Monday
+		{&Getter{DaysOfMonth: "1-7", Weekdays: "mon"}, "2019-09-02T12:00:00Z", true},
+		{&Getter{DaysOfMonth: "1-7", Weekdays: "mon"}, "2019-09-09T12:00:00Z", false},
+		{&Getter{Months: "jan apr jul oct"}, "2019-07-15T12:00:00Z", true},
+		{&Getter{Months: "jan apr jul oct"}, "2019-08-15T12:00:00Z", false},
+		{&Getter{DaysOfMonth: "1", Months: "jan"}, "2020-01-01T12:00:00Z", true},
+		{&Getter{DaysOfMonth: "1", Months: "jan"}, "2020-02-01T12:00:00Z", false},
+	} {
+		g := trial.g
+		g.URL = "http://host.example/foo"
+		g.Timezone = "UTC"
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now, err := time.Parse(time.RFC3339, trial.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.should(now); got != trial.should {
+			t.Errorf("%+v at %s: expected %v, got %v", trial.g, now, trial.should, got)
+		}
+	}
+	for _, g := range []*Getter{
+		{DaysOfMonth: "0"},
+		{Months: "smarch"},
+	} {
+		g.URL = "http://host.example/foo"
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected error", g)
+		}
+	}
+}
+
+func TestAlignTo(t *testing.T) {
+	for _, trial := range []struct {
+		spec   string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"hour", time.Hour},
+		{"Day", 24 * time.Hour},
+		{"15m", 15 * time.Minute},
+		{"6h", 6 * time.Hour},
+		{"7m", -1},
+		{"48h", -1},
+		{"0s", -1},
+		{"weekly", -1},
+	} {
+		d, err := parseAlignTo(trial.spec)
+		if trial.expect < 0 {
+			if err == nil {
+				t.Errorf("%q: expected error, got %s", trial.spec, d)
+			}
+		} else if err != nil || d != trial.expect {
+			t.Errorf("%q: expected %s, got %s, %v", trial.spec, trial.expect, d, err)
+		}
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trial := range []struct {
+		t        string
+		d        time.Duration
+		down, up string
+	}{
+		{"2019-08-28T10:20:00-04:00", time.Hour, "2019-08-28T10:00:00-04:00", "2019-08-28T11:00:00-04:00"},
+		{"2019-08-28T10:00:00-04:00", time.Hour, "2019-08-28T10:00:00-04:00", "2019-08-28T10:00:00-04:00"},
+		{"2019-08-28T23:50:00-04:00", 15 * time.Minute, "2019-08-28T23:45:00-04:00", "2019-08-29T00:00:00-04:00"},
+		{"2019-08-28T10:20:00-04:00", 24 * time.Hour, "2019-08-28T00:00:00-04:00", "2019-08-29T00:00:00-04:00"},
+		// 25-hour day (DST ends)
+		{"2019-11-03T12:00:00-05:00", 24 * time.Hour, "2019-11-03T00:00:00-04:00", "2019-11-04T00:00:00-05:00"},
+		{"2019-11-03T23:30:00-05:00", time.Hour, "2019-11-03T23:00:00-05:00", "2019-11-04T00:00:00-05:00"},
+	} {
+		tm, _ := time.Parse(time.RFC3339, trial.t)
+		tm = tm.In(loc)
+		down, _ := time.Parse(time.RFC3339, trial.down)
+		up, _ := time.Parse(time.RFC3339, trial.up)
+		if got := alignDown(tm, trial.d); !got.Equal(down) {
+			t.Errorf("alignDown(%s, %s): expected %s, got %s", tm, trial.d, down, got)
+		}
+		if got := alignUp(tm, trial.d); !got.Equal(up) {
+			t.Errorf("alignUp(%s, %s): expected %s, got %s", tm, trial.d, up, got)
+		}
+	}
+
+	g := &Getter{URL: "http://host.example/foo", Schedule: "0 * * * *", AlignTo: "hour"}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for AlignTo with Schedule")
+	}
+}
@@ -0,0 +1,149 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	maxChunks    = 32
+	minChunkSize = 1 << 20
+)
+
+// fetchChunks downloads req.URL to f using up to Chunks concurrent
+// Range requests, each writing its own segment of the (pre-allocated)
+// tempfile.
+//
+// It starts with a HEAD request (including the conditional headers
+// already set in req) to find the size and validator of the current
+// content. If the server doesn't advertise range support, or the file
+// is too small to be worth splitting, it returns ok=false and the
+// caller should proceed with a normal GET request.
+func (g *Getter) fetchChunks(ctx context.Context, f *os.File, req *http.Request) (_ fetched, ok bool, _ error) {
+	url := req.URL.String()
+	head := req.Clone(ctx)
+	head.Method = http.MethodHead
+	resp, err := g.client.Do(head)
+	if err != nil {
+		return fetched{}, true, fmt.Errorf("%q: %s", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return fetched{}, true, errNotModified
+	} else if resp.StatusCode != http.StatusOK {
+		g.logger().Debug("not using Chunks, HEAD request failed", "url", url, "status", resp.StatusCode)
+		return fetched{}, false, nil
+	}
+	size := resp.ContentLength
+	etag := resp.Header.Get("Etag")
+	modtime := resp.Header.Get("Last-Modified")
+	// If-Range ensures every segment comes from the same version
+	// of the file. Weak ETags cannot be used with If-Range.
+	validator := etag
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = modtime
+	}
+	chunks := g.Chunks
+	if size >= 0 && size/minChunkSize < int64(chunks) {
+		chunks = int(size / minChunkSize)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || validator == "" || size < 0 || chunks < 2 {
+		g.logger().Debug("not using Chunks", "url", url, "size", size, "acceptRanges", resp.Header.Get("Accept-Ranges"), "validator", validator)
+		return fetched{}, false, nil
+	}
+	if err := g.checkResponseHeaders(resp.Header); err != nil {
+		return fetched{}, true, fmt.Errorf("%q: %s", url, err)
+	}
+	if err := g.checkMaximumSize(size); err != nil {
+		return fetched{}, true, err
+	}
+	if err := g.checkFreeSpace(size); err != nil {
+		return fetched{}, true, err
+	}
+	if err := f.Truncate(size); err != nil {
+		return fetched{}, true, fmt.Errorf("error allocating tempfile: %s", err)
+	}
+	g.logger().Info("downloading in chunks", "url", url, "size", size, "chunks", chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, chunks)
+	for i := 0; i < chunks; i++ {
+		start := size * int64(i) / int64(chunks)
+		end := size * int64(i+1) / int64(chunks)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = g.fetchChunk(ctx, f, req, validator, start, end)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		// Report the first error that isn't just a result of
+		// cancelling the other chunks.
+		if err != nil && err != context.Canceled {
+			return fetched{}, true, fmt.Errorf("downloading %q to tempfile: %s", url, err)
+		}
+	}
+	if ctx.Err() != nil {
+		return fetched{}, true, fmt.Errorf("downloading %q to tempfile: %s", url, ctx.Err())
+	}
+	if fi, err := f.Stat(); err != nil {
+		return fetched{}, true, fmt.Errorf("error checking tempfile: %s", err)
+	} else if fi.Size() != size {
+		return fetched{}, true, fmt.Errorf("downloading %q to tempfile: tempfile size %d, expected %d", url, fi.Size(), size)
+	}
+	return fetched{
+		size:    size,
+		etag:    etag,
+		modtime: modtime,
+	}, true, nil
+}
+
+// fetchChunk downloads bytes [start, end) of req.URL into the same
+// position in f.
+func (g *Getter) fetchChunk(ctx context.Context, f *os.File, req *http.Request, validator string, start, end int64) error {
+	req = req.Clone(ctx)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	req.Header.Set("If-Range", validator)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("content changed during download (server ignored Range/If-Range)")
+	} else if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range %d-%d: non-206 response: %d %q", start, end-1, resp.StatusCode, resp.Status)
+	} else if contentRangeStart(resp) != start {
+		return fmt.Errorf("range %d-%d: unexpected Content-Range %q", start, end-1, resp.Header.Get("Content-Range"))
+	}
+	var w io.Writer = io.NewOffsetWriter(f, start)
+	if g.minSpeed > 0 {
+		w = progressWriter{w: w, n: g.progressCounter(f)}
+	}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	} else if n != end-start {
+		return fmt.Errorf("range %d-%d: received %d bytes, expected %d", start, end-1, n, end-start)
+	}
+	return nil
+}
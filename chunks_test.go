@@ -0,0 +1,90 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChunks(t *testing.T) {
+	big := make([]byte, 3*minChunkSize+12345)
+	rand.New(rand.NewSource(1)).Read(big)
+	small := []byte("hello\n")
+	var mtx sync.Mutex
+	var ranges []string
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		if req.Method == "GET" {
+			gets++
+			if r := req.Header.Get("Range"); r != "" {
+				ranges = append(ranges, r)
+			}
+		}
+		mtx.Unlock()
+		content := big
+		if req.URL.Path == "/small" {
+			content = small
+		}
+		w.Header().Set("Etag", `"v1"`)
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path   string
+		expect []byte
+		ranges int
+	}{
+		{"/big", big, 3},
+		{"/small", small, 0},
+	} {
+		ranges, gets = nil, 0
+		g := &Getter{
+			URL:    srv.URL + trial.path,
+			Output: filepath.Join(t.TempDir(), "out"),
+			Chunks: 4,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || !bytes.Equal(buf, trial.expect) {
+			t.Errorf("%s: output file has %d bytes, expected %d (err %v)", trial.path, len(buf), len(trial.expect), err)
+		}
+		if len(ranges) != trial.ranges || gets != max(trial.ranges, 1) {
+			t.Errorf("%s: expected %d range requests, got %d GETs with ranges %q", trial.path, trial.ranges, gets, ranges)
+		}
+
+		// Second attempt: HEAD gets 304, no GET.
+		ranges, gets = nil, 0
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if gets != 0 && trial.ranges > 0 {
+			t.Errorf("%s: expected no GET requests for unchanged file, got %d", trial.path, gets)
+		}
+	}
+
+	for _, bad := range []*Getter{
+		{URL: srv.URL, Chunks: -1},
+		{URL: srv.URL, Chunks: maxChunks + 1},
+		{URL: srv.URL, Chunks: 4, Resume: true},
+		{URL: "file:///dev/null", Chunks: 4},
+	} {
+		bad.Output = filepath.Join(t.TempDir(), "out")
+		if err := bad.Setup(); err == nil || !strings.Contains(err.Error(), "Chunks") {
+			t.Errorf("%+v: expected Chunks error, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminPost sends a POST request for the given action (e.g.,
+// "pause") on the given output file to the admin API of a running
+// getlatest daemon at addr ("[host]:port", as given to -admin).
+func adminPost(addr, output, action string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" || port == "0" {
+		return fmt.Errorf("need the admin API address of the running daemon, e.g., -admin localhost:8081 (got %q)", addr)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	u := "http://" + net.JoinHostPort(host, port) + "/targets/" + strings.TrimPrefix(output, "/") + "/" + action
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Post(u, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,769 @@
+// Command getlatest keeps local copies of remote files up to date,
+// according to the schedule in its config file.
+//
+// Install:
+//
+//	go get github.com/tomclegg/getlatest/cmd/getlatest
+//
+// systemd:
+//
+//	install $(go env GOPATH)/bin/getlatest /usr/bin/
+//	getlatest -install-service
+//	# or, e.g.:
+//	getlatest -install-service -config /etc/getlatest.d -service-user getlatest
+//	# to remove:
+//	getlatest -uninstall-service
+//
+// macOS launchd (writes /Library/LaunchDaemons/getlatest.plist; logs
+// go to /var/log/getlatest.log):
+//
+//	sudo getlatest -install-service -config /usr/local/etc/getlatest.yaml
+//	# reload config:
+//	sudo launchctl kill HUP system/getlatest
+//	# to remove:
+//	sudo getlatest -uninstall-service
+//
+// Windows service (logs go to the Windows event log; use "sc control
+// getlatest paramchange" to reload the config):
+//
+//	getlatest.exe -install-service -config C:\ProgramData\getlatest\getlatest.yaml
+//	getlatest.exe -uninstall-service
+//
+// Standalone:
+//
+//	getlatest &
+//
+// Force an immediate download (see -admin flag; the admin API is off
+// by default, is served separately from -metrics, and has no
+// authentication):
+//
+//	getlatest -admin localhost:port -fetch /tmp/example.html
+//	# or:
+//	curl -X POST http://localhost:port/targets/tmp/example.html/fetch
+//	# or, to start all targets (except disabled/paused) right away:
+//	kill -USR1 $(pidof getlatest)
+//
+// Pause and resume scheduled downloads of a target, e.g., during the
+// upstream's maintenance window (the paused state is saved in the
+// -state file, if any, and survives config reloads; use "Disabled:
+// true" in the config file to pause a target permanently):
+//
+//	getlatest -admin localhost:port -pause /tmp/example.html
+//	getlatest -admin localhost:port -resume /tmp/example.html
+//	# or:
+//	curl -X POST http://localhost:port/targets/tmp/example.html/pause
+//
+// Health check, and status of each target as JSON (see -metrics flag):
+//
+//	curl http://localhost:port/healthz
+//	curl http://localhost:port/status
+//
+// cron/CI (attempt each target that is due, then exit non-zero if any
+// attempt failed):
+//
+//	getlatest -once
+//
+// The installed systemd service uses Type=notify and WatchdogSec, so
+// systemd knows when getlatest is ready, and restarts it if it stops
+// responding, or if a download or hook is stuck well past its
+// timeout.
+//
+// Reload config after editing (running downloads are not interrupted):
+//
+//	systemctl reload getlatest
+//	# or: kill -HUP $(pidof getlatest)
+//
+// On SIGTERM or SIGINT, downloads in progress are aborted, their
+// tempfiles are removed, and the state file (if any) is saved before
+// exiting.
+//
+// Check the config file (e.g., before deploying it) and exit non-zero
+// if there are any errors:
+//
+//	getlatest -check -config /etc/getlatest.yaml.new
+//
+// Keep ETags, failure streaks, and partial download state across
+// restarts:
+//
+//	getlatest -state /var/lib/getlatest/state.json
+//
+// Load and merge all *.yaml files in a directory (each output file
+// can only be defined once):
+//
+//	getlatest -config /etc/getlatest.d
+//
+// Prometheus metrics, labeled by target (see -metrics flag):
+//
+//	getlatest_last_success_timestamp_seconds
+//	getlatest_failing_seconds
+//	getlatest_retry_delay_seconds
+//	getlatest_retry_deferred_until_timestamp_seconds (from Retry-After)
+//	getlatest_attempts_total
+//	getlatest_failures_total
+//	getlatest_download_bytes_total
+//	getlatest_download_duration_seconds (histogram)
+//	getlatest_insufficient_space_total
+//	getlatest_mirror_successes_total (also labeled by mirror)
+//	getlatest_http_responses_total (also labeled by protocol)
+//
+// Config:
+//
+//	# /etc/getlatest.yaml
+//
+//	# Config values can refer to environment variables as ${VAR}, and
+//	# to the content of a file with "!secret /path/to/file" (relative
+//	# to the config file), e.g.:
+//	#   BearerToken: !secret /etc/getlatest/token
+//	#   URL: "https://${MIRROR_HOST}/example.html"
+//
+//	# Optional defaults for all targets in this file. Fields set in a
+//	# target replace the defaults.
+//	defaults:
+//	  Weekdays: mon tue wed thu fri
+//	  Headers:
+//	    Accept: application/json
+//	  UserAgent: "example-mirror/1.0 (ops@example.com)"
+//
+//	# Optional generated targets: one target for each combination of
+//	# Matrix values. Output is expanded using the values, which are
+//	# also available in URL templates (the defaults apply too):
+//	generate:
+//	  - Output: "/var/lib/example/{{.region}}/{{.dataset}}.csv"
+//	    Matrix:
+//	      region: [us-east-1, eu-west-1]
+//	      dataset: [prices, volumes]
+//	    Target:
+//	      URL: "https://{{.region}}.host.example/{{.dataset}}.csv"
+//	      TTL: 1h
+//
+//	/tmp/example.html:
+//	  URL: "https://host.example/source/example?t={{.time.Format \"2016-01-02T15:04.05\"}}.html"
+//	  NotBefore: 6:00
+//	  NotAfter: 13:00
+//	  # (NotAfter can be earlier than NotBefore to span midnight, or use
+//	  # one or more windows instead, e.g.,
+//	  # Windows: ["06:00-08:00", "22:00-02:00"])
+//	  # Weekdays: day names (mon or monday), ranges (mon-fri, fri-mon),
+//	  # weekday, and/or weekend
+//	  Weekdays: mon-fri
+//	  # Optional days of the month (1-31, ranges like 1-7, or last)
+//	  # and months (jan or january, 1-12, or ranges like nov-feb).
+//	  # Weekdays, DaysOfMonth, and Months must all match, so
+//	  # "DaysOfMonth: 1-7" with "Weekdays: mon" means the first Monday.
+//	  # For a window that spans midnight, they are checked against the
+//	  # day the window starts, so "Weekdays: fri" with 22:00-02:00
+//	  # allows Friday 22:00 until Saturday 02:00:
+//	  # DaysOfMonth: 1 15
+//	  # Months: jan apr jul oct
+//	  # Optional dates (YYYY-MM-DD) to skip, e.g., public holidays when
+//	  # the source is not updated. SkipDatesFile has one date per line
+//	  # (# starts a comment). HolidayCalendars are iCalendar URLs
+//	  # (fetched daily) whose event dates are skipped:
+//	  # SkipDates: [2026-12-25, 2027-01-01]
+//	  # SkipDatesFile: /etc/getlatest/holidays.txt
+//	  # HolidayCalendars: ["https://example.com/holidays.ics"]
+//	  # Timezone for NotBefore/NotAfter/Weekdays/DaysOfMonth/Months/
+//	  # Schedule/SkipDates (default: local)
+//	  Timezone: America/New_York
+//	  MinimumSize: 14000000
+//	  # Optional limit, to avoid filling the disk if the source is
+//	  # unexpectedly huge:
+//	  # MaximumSize: 100000000
+//	  # Optional free disk space to leave after downloading (checked
+//	  # before downloading, and again when the size is known):
+//	  # MinFreeSpace: 1000000000
+//	  # Optional response checks, to avoid replacing a good file
+//	  # with an HTML error page:
+//	  # ExpectContentType: text/csv
+//	  # ExpectHeaders:
+//	  #   X-Export-Status: complete
+//	  # Optional regular expressions the output must (not) match:
+//	  # MustMatch: '^id,name\n'
+//	  # MustNotMatch: '(?i)maintenance mode'
+//	  # Optionally reject stale data: find a timestamp in the content
+//	  # (the first capture group, if any) and require it to be recent:
+//	  # FreshnessRegex: '"generated_at": *"([^"]+)"'
+//	  # FreshnessMaxAge: 48h
+//	  # Optional format check (json, yaml, xml, or csv), so a truncated
+//	  # file or HTML error page never replaces a valid data file:
+//	  # ValidateFormat: json
+//	  # Optional file type check by magic number (7z, bzip2, elf, gif,
+//	  # gzip, jpeg, parquet, pdf, png, sqlite, tar, xz, zip, or zstd):
+//	  # ExpectFileType: zip
+//	  # Optionally read every entry of a zip or tar (.tar.gz, .tgz,
+//	  # etc.) archive, and reject it if it is truncated or fails a
+//	  # CRC check:
+//	  # CheckArchive: true
+//	  # Optional mirrors, tried in order (or randomly, with
+//	  # RandomizeMirrors: true) if URL fails:
+//	  # URLs:
+//	  #   - "https://mirror1.example/source/example.html"
+//	  #   - "https://mirror2.example/source/example.html"
+//	  # Also start the next mirror if there is no response header
+//	  # within this time, and use whichever finishes first (not
+//	  # compatible with Resume):
+//	  # HedgeAfter: 5s
+//	  TTL: 12h
+//	  # Optionally round the TTL up to a wall clock boundary in
+//	  # Timezone ("hour", "day", or a duration that divides a day,
+//	  # like 15m), so downloads happen at predictable times (e.g.,
+//	  # just after the top of the hour) instead of drifting:
+//	  # AlignTo: hour
+//	  # Keep interrupted downloads as /tmp/example.html.partial and
+//	  # resume them with a Range request if the upstream supports it:
+//	  # Resume: true
+//	  # Download large files (at least 1 MiB per chunk) using several
+//	  # concurrent Range requests, if the upstream supports it:
+//	  # Chunks: 4
+//	  # Timeouts (any timeout counts as a failed attempt):
+//	  # ConnectTimeout: 30s
+//	  # ResponseHeaderTimeout: 1m
+//	  # DownloadTimeout: 1h
+//	  # Optional minimum transfer speed: abort the attempt (and try
+//	  # the next mirror, if any) if a download stalls
+//	  # (KB/MB/GB = 1000^n, KiB/MiB/GiB = 1024^n; default interval 30s):
+//	  # MinSpeed: 50KB/s over 30s
+//	  # Or, instead of TTL, a cron schedule (seconds field optional),
+//	  # e.g., every 15 minutes from 06:00 to 09:59:
+//	  # Schedule: "*/15 6-9 * * *"
+//	  # Or download successfully just once (e.g., to seed a data file
+//	  # on first boot; nothing is downloaded if the output file
+//	  # already exists), then stop scheduling this target:
+//	  # Once: true
+//	  # Optionally stop scheduling downloads (see -pause):
+//	  # Disabled: true
+//	  # Optional checksum, either literal or from a sha256sum-style file
+//	  # (the file name field is matched against the downloaded URL):
+//	  # SHA256: 3b6a...
+//	  # ChecksumURL: "https://host.example/source/SHA256SUMS"
+//	  # Optional detached GPG signature, checked before replacing the
+//	  # output file:
+//	  # SignatureURL: "https://host.example/source/example.html.asc"
+//	  # GPGKeyFile: /etc/getlatest/upstream-signing-key.asc
+//	  # or a minisign or signify signature and public key:
+//	  # SignatureURL: "https://host.example/source/example.html.minisig"
+//	  # MinisignKey: RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3
+//	  # Optional decompression (gzip, zstd, bzip2, or auto) after
+//	  # checksum/signature verification and before MinimumSize check:
+//	  # Decompress: auto
+//	  # Optional path/glob of a single file to extract from a zip or
+//	  # tar(.gz/.bz2/.zst) archive:
+//	  # ArchiveFilter: "*/bin/example"
+//	  # Or extract the whole archive into a new directory, and atomically
+//	  # replace the output with a symlink to it (not compatible with
+//	  # ArchiveFilter, SkipUnchanged, or KeepVersions without Versioned):
+//	  # Unpack: true
+//	  # Optionally rewrite the content with a jq program (string
+//	  # results are written as is, like "jq -r") or a Go text/template
+//	  # ("." is the decoded JSON content, or the content as a string):
+//	  # Transform: "jq:.data.items[].name"
+//	  # Transform: "template:{{range .items}}{{.name}}={{.value}}\n{{end}}"
+//	  # Optionally convert a legacy character encoding (before
+//	  # Transform), and/or line endings (unix or dos, last):
+//	  # ConvertEncoding: windows-1252->utf-8
+//	  # LineEndings: unix
+//	  # Optional number of previous versions to keep, as
+//	  # /var/www/html/example.html.YYYYMMDDTHHMMSS:
+//	  # KeepVersions: 5
+//	  # Or write each new version to /var/www/html/example.html.d/
+//	  # and atomically repoint the output (a symlink) to it, so readers
+//	  # that already opened the previous version can finish reading, and
+//	  # rolling back is a matter of changing the symlink (KeepVersions is
+//	  # then the number of previous versions to keep in .d/):
+//	  # Versioned: true
+//	  # Optionally leave the output file (and its mtime) untouched, and
+//	  # skip OnSuccess, if the new content is identical:
+//	  # SkipUnchanged: true
+//	  # Optionally treat an unchanged source (not modified, or identical
+//	  # content) as a failure, e.g., for a feed that is supposed to be
+//	  # updated every time TTL expires:
+//	  # RequireChange: true
+//	  # Optional output file permissions and ownership (default
+//	  # 0666 minus umask, and the user running getlatest):
+//	  # FileMode: 0644
+//	  # Owner: www-data
+//	  # Group: www-data
+//	  # Optional additional copies of the output file, each replaced
+//	  # atomically after each update:
+//	  # AlsoWrite:
+//	  #   - /srv/container1/data/example.html
+//	  #   - /mnt/backup/example.html
+//	  # Optionally set the output file's mtime to the upstream
+//	  # Last-Modified time instead of the download time:
+//	  # PreserveModTime: true
+//	  # Optionally write the source URL, ETag, Last-Modified, SHA256,
+//	  # size, and download time of the current content to
+//	  # /var/www/html/example.html.meta.json:
+//	  # WriteMetadata: true
+//	  # By default the new content and directory entry are flushed
+//	  # to disk (fsync) so the output survives a crash or power
+//	  # loss. Optionally skip this for faster, non-durable updates:
+//	  # NoSync: true
+//	  # Optional directory for tempfiles (default is the output
+//	  # file's directory). If it is on a different filesystem, the
+//	  # result is copied next to the output file before renaming:
+//	  # TempDir: /var/tmp
+//	  # Optional shell command to check the new content (in the
+//	  # tempfile $1) before replacing the output file; the download
+//	  # fails unless it exits 0:
+//	  # ValidateCommand: jq empty "$1"
+//	  # Optionally pipe the new content (after all of the above checks)
+//	  # to a shell command instead of writing the output file; the
+//	  # download fails unless it exits 0. The output path is then only
+//	  # used as the target name, and for the tempfile:
+//	  # PipeTo: psql -q -c "\copy example FROM STDIN CSV"
+//	  # Optional shell command to run when the target has failed
+//	  # FailureThreshold times in a row (default 1), with
+//	  # $GETLATEST_OUTPUT, $GETLATEST_ERROR, and $GETLATEST_FAILURES
+//	  # in the environment. It runs once per failure streak, and is
+//	  # killed after 1 hour:
+//	  # OnFailure: /usr/local/bin/page-oncall
+//	  # FailureThreshold: 3
+//	  # Optional list of other targets (output files) that must
+//	  # succeed before this one is attempted, e.g., an index that
+//	  # this file is found in. When one of them is updated, this
+//	  # target is downloaded without waiting for its TTL/Schedule
+//	  # (but still within its time windows and dates, and not
+//	  # while disabled or paused):
+//	  # DependsOn: [/var/lib/example/index.json]
+//	  # Optional webhook notifications when the target starts failing,
+//	  # when it recovers, and (with OnSuccess) on every update. Format
+//	  # is "slack" (default, {"text":...}) or "json". Put this in
+//	  # "defaults" to apply it to all targets:
+//	  # Notify:
+//	  #   URL: "https://hooks.slack.com/services/..."
+//	  #   Format: slack
+//	  #   OnSuccess: false
+//	  # Optional systemd unit to reload (or restart, if it doesn't
+//	  # support reload) via D-Bus after each update (".service" is
+//	  # added if there is no suffix):
+//	  # ReloadUnit: nginx
+//	  # Optional process to signal after each update, found by pid file
+//	  # or by process name (Name is Linux only; Signal defaults to HUP):
+//	  # SignalProcess:
+//	  #   PIDFile: /run/nginx.pid
+//	  #   Signal: HUP
+//	  # Optional shell command to run after the output file is updated,
+//	  # with $GETLATEST_OUTPUT and $GETLATEST_URL in the environment
+//	  # (it is killed after 1 hour):
+//	  # OnSuccess: systemctl reload nginx
+//	  # Optional maximum time between schedule checks (default 1h; the
+//	  # next download is also scheduled precisely, so this only matters
+//	  # if the system clock jumps):
+//	  # CheckInterval: 5m
+//	  # Optional random delay after TTL/Schedule (stable for each host
+//	  # and target), to spread out requests from many hosts:
+//	  # Splay: 10m
+//	  # Optional priority when the -max-concurrent limit is reached
+//	  # (higher goes first, default 0):
+//	  # Priority: 10
+//	  # Optional retry backoff after failures (default: retry every minute).
+//	  # If the server responds 429 or 503 with a Retry-After header, the
+//	  # next retry waits at least that long (up to 24h):
+//	  # RetryInterval: 1m
+//	  # RetryBackoff: 2
+//	  # MaxRetryInterval: 1h
+//	  # Optionally, once the last success is older than StaleAfter (or
+//	  # there has never been one), having the data matters more than
+//	  # the polite schedule: ignore NotBefore/NotAfter/Windows, and
+//	  # retry every StaleRetryInterval (default RetryInterval) with no
+//	  # backoff:
+//	  # StaleAfter: 48h
+//	  # StaleRetryInterval: 5m
+//	  # Optional TLS client certificate and custom CA bundle for http(s)
+//	  # URLs:
+//	  # TLSCert: /etc/getlatest/client.crt
+//	  # TLSKey: /etc/getlatest/client.key
+//	  # TLSCACert: /etc/getlatest/internal-ca.pem
+//	  # Optional public key pinning: refuse to connect unless the
+//	  # server's certificate chain includes a key with one of these
+//	  # SHA-256 SPKI hashes, e.g., from "openssl x509 -pubkey -noout |
+//	  # openssl pkey -pubin -outform der | openssl dgst -sha256
+//	  # -binary | base64":
+//	  # PinnedSPKIHashes: ["sha256/AAAA...="]
+//	  # Optional HTTP version: "1.1" to disable HTTP/2, or "3" to use
+//	  # HTTP/3 (QUIC) for https URLs (not compatible with Proxy):
+//	  # HTTPVersion: "1.1"
+//	  # Optional DNS overrides: connect to a fixed address (like curl
+//	  # --resolve), and/or use specific DNS servers instead of the
+//	  # system resolver (e.g., in the defaults section, for
+//	  # split-horizon DNS):
+//	  # ResolveTo:
+//	  #   host.example: 10.1.2.3
+//	  # DNSServers: ["10.0.0.53", "10.0.1.53:5353"]
+//	  # Optional IP address family (default auto, i.e., either):
+//	  # IPVersion: 4
+//	  # Optional unix domain socket to connect to instead of the host
+//	  # in an http URL (e.g., to snapshot a local daemon's API):
+//	  # UnixSocket: /run/foo.sock
+//	  # Optional proxy (http, https, or socks5) for http(s) and s3 URLs,
+//	  # overriding $HTTP_PROXY/$HTTPS_PROXY/$NO_PROXY ("NoProxy: '*'"
+//	  # disables an environment-configured proxy):
+//	  # Proxy: "http://proxy.example:3128"
+//	  # NoProxy: "internal.example,10.0.0.0/8"
+//	  # Optional extra HTTP request headers:
+//	  # Headers:
+//	  #   X-Api-Version: "2"
+//	  # Optional User-Agent for http(s) and oci URLs (default
+//	  # "getlatest/<version>"):
+//	  # UserAgent: "example-client/2.1"
+//	  # Optional redirect policy (default: follow up to 10 redirects;
+//	  # -1 refuses all redirects):
+//	  # MaxRedirects: 30
+//	  # ForbidRedirectToOtherHost: true
+//	  # Send a HEAD request first, and skip the download if the ETag
+//	  # (or Last-Modified) and Content-Length are unchanged (for
+//	  # servers that ignore If-None-Match/If-Modified-Since):
+//	  # HeadCheck: true
+//	  # Optional authentication for http(s) URLs, either
+//	  # BearerToken: "..."
+//	  # or BearerTokenFile: /etc/getlatest/token
+//	  # or OAuth2 client credentials (tokens are refreshed automatically):
+//	  # OAuth2:
+//	  #   TokenURL: "https://auth.example/oauth2/token"
+//	  #   ClientID: getlatest
+//	  #   ClientSecretFile: /etc/getlatest/client-secret
+//	  #   Scopes: [read]
+//	  # or AWS SigV4 request signing (standard AWS credential chain):
+//	  # AWSSigV4:
+//	  #   Region: us-east-1
+//	  #   Service: execute-api
+//	  # or Digest or NTLM authentication (e.g., for legacy appliances):
+//	  # Auth:
+//	  #   Type: digest  # or ntlm
+//	  #   Username: admin  # for NTLM, optionally DOMAIN\admin
+//	  #   PasswordFile: /etc/getlatest/appliance-password
+//	  # Optionally, look up credentials for the URL's host in a netrc
+//	  # file, used for basic auth if no other HTTP authentication is
+//	  # configured (and for SFTP/FTP if no Username is given):
+//	  # NetrcFile: /etc/getlatest/netrc
+//	  # Optionally, log in before each attempt (e.g., to a vendor portal);
+//	  # session cookies from the response are sent with the download
+//	  # request:
+//	  # Login:
+//	  #   URL: "https://portal.example/login"
+//	  #   Form: {username: getlatest, password: "..."}
+//	  #   # or JSON: {"user": "getlatest", "password": "..."}
+//
+//	# SFTP sources use the same scheduling options. Server host keys
+//	# are checked against KnownHostsFile (default ~/.ssh/known_hosts).
+//	/tmp/feed.csv:
+//	  URL: "sftp://feeds.example/outgoing/feed.csv"
+//	  Username: getlatest
+//	  PrivateKeyFile: /etc/getlatest/id_ed25519
+//	  TTL: 1h
+//
+//	# FTP and FTPS sources use passive mode, and are only downloaded
+//	# again when the size or modification time (MDTM) changes.
+//	# ftps:// uses explicit TLS (AUTH TLS), or implicit TLS on port 990.
+//	/tmp/vendor-drop.zip:
+//	  URL: "ftps://ftp.vendor.example/outgoing/drop.zip"
+//	  Username: customer123
+//	  Password: "..."
+//	  TTL: 1h
+//
+//	# exec: sources run a shell command and save its stdout (the
+//	# command must exit 0). All the usual scheduling, size checks,
+//	# validation, and atomic replacement apply.
+//	/var/backups/app.dump:
+//	  URL: "exec:pg_dump -Fc app"
+//	  TTL: 24h
+//	  MinimumSize: 1000000
+//	  SkipUnchanged: true
+//
+//	# file:// sources keep a local copy of a file (e.g., on a slow
+//	# network mount), updated when its size or mtime changes.
+//	# CopyMode "hardlink" or "reflink" avoids copying the data when
+//	# the source is on the same filesystem.
+//	/var/cache/models/model.bin:
+//	  URL: "file:///mnt/nfs/models/model.bin"
+//	  TTL: 10m
+//	  # CopyMode: reflink
+//
+//	# OCI sources download a layer of an artifact in a container
+//	# registry (e.g., pushed with "oras push"), using credentials
+//	# from ~/.docker/config.json and docker credential helpers. The
+//	# layer is only downloaded again when its digest changes.
+//	/etc/app/bundle.tar.gz:
+//	  URL: "oci://ghcr.io/example/config-bundle:prod"
+//	  OCILayer: bundle.tar.gz
+//	  TTL: 5m
+//
+//	# S3 sources use the standard AWS credential chain. S3Endpoint
+//	# can point to MinIO or another S3-compatible service.
+//	/tmp/bundle.tgz:
+//	  URL: "s3://bucket/path/to/bundle.tgz"
+//	  S3Region: us-west-2
+//	  # S3Endpoint: "https://minio.example:9000"
+//
+//	# Any target can also upload each new version to S3 (using the
+//	# same credentials, S3Region, and S3Endpoint) or Google Cloud
+//	# Storage (using an HMAC key as AWS_ACCESS_KEY_ID and
+//	# AWS_SECRET_ACCESS_KEY), so other hosts can pull it from there.
+//	/srv/data/feed.json:
+//	  URL: "https://feeds.example/feed.json"
+//	  Mirror:
+//	    - "s3://fleet-bucket/feed.json"
+//	    - "gs://fleet-bucket-eu/feed.json"
+//
+//	# GitHub release sources download the newest release asset
+//	# matching a glob. BearerToken/BearerTokenFile, if given, is used
+//	# as a GitHub token (required for private repositories).
+//	/usr/local/bin/tool.tgz:
+//	  URL: "github-release://owner/repo/tool-*-linux-amd64.tar.gz"
+//	  TTL: 6h
+//	  # Optionally include pre-releases:
+//	  # GitHubPrerelease: true
+//
+//	# Index sources fetch a JSON manifest and extract the download URL
+//	# (relative to IndexURL) from it. If URL is also given, the
+//	# extracted value is available there as {{.index}}.
+//	/tmp/data.zip:
+//	  IndexURL: "https://data.example/latest.json"
+//	  IndexJSONPath: "$.files[0].url"
+//	  # URL: "https://data.example/releases/{{.index}}/data.zip"
+//
+//	# Alternatively, find the download link on an HTML page using a
+//	# CSS selector (default "a[href]") and/or a regular expression
+//	# for the href. LinkLatest picks the lexically greatest match
+//	# instead of the first.
+//	/tmp/tool.tar.gz:
+//	  IndexURL: "https://vendor.example/downloads/"
+//	  LinkRegex: '^tool-[0-9.]+\.tar\.gz$'
+//	  # LinkSelector: "#latest a"
+//	  # LinkLatest: true
+//
+//	# Or download the enclosure (or link) of the newest entry in an
+//	# RSS/Atom feed:
+//	/srv/podcast/latest.mp3:
+//	  IndexURL: "https://podcast.example/feed.xml"
+//	  IndexFeed: true
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // for Timezone config on hosts without tzdata
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tomclegg/getlatest"
+)
+
+const defaultConfigPath = "/etc/getlatest.yaml"
+
+func main() {
+	log.SetFlags(0)
+
+	install := flag.Bool("install-service", false, "install and start system service (systemd, launchd, or Windows)")
+	uninstall := flag.Bool("uninstall-service", false, "stop and remove system service")
+	var svc serviceConfig
+	flag.StringVar(&svc.Name, "service-name", "getlatest", "service `name` for -install-service/-uninstall-service")
+	flag.StringVar(&svc.Binary, "service-binary", "", "getlatest executable `path` for -install-service (default: this executable)")
+	flag.StringVar(&svc.User, "service-user", "", "run service as `user` (-install-service)")
+	flag.StringVar(&svc.Group, "service-group", "", "run service as `group` (-install-service)")
+	configPath := flag.String("config", defaultConfigPath, "configuration `file`, or directory of *.yaml files")
+	metrics := flag.String("metrics", ":", "serve metrics, /healthz, and /status (read-only) at http://`[address]:port`/")
+	admin := flag.String("admin", "", "serve admin API at http://`[address]:port`/targets. It has no authentication, and can start and pause downloads: use a loopback or firewalled address")
+	fetch := flag.String("fetch", "", "tell the running daemon (at the -admin address) to download `output` file right away")
+	pause := flag.String("pause", "", "tell the running daemon (at the -admin address) to stop scheduling downloads of `output` file")
+	resume := flag.String("resume", "", "tell the running daemon (at the -admin address) to resume scheduling downloads of `output` file")
+	statePath := flag.String("state", "", "save ETags, failure streaks, etc. across restarts in state `file`, e.g., /var/lib/getlatest/state.json")
+	maxConcurrent := flag.Int("max-concurrent", 0, "maximum number of concurrent downloads (0 = unlimited)")
+	check := flag.Bool("check", false, "check the config file, print a report, and exit")
+	once := flag.Bool("once", false, "attempt each target that is due, print a summary, and exit")
+	logFormat := flag.String("log-format", "text", "log `format`: text or json")
+	logLevel := flag.String("log-level", "info", "minimum log `level`: debug, info, warn, or error")
+	flag.Parse()
+	logw, isService := serviceLog(svc.Name)
+	if !isService {
+		logw = os.Stderr
+	}
+	if err := setupLogging(logw, *logFormat, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *install || *uninstall {
+		svc.Config = *configPath
+		var err error
+		if *install {
+			err = installService(svc)
+		} else {
+			err = uninstallService(svc)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *fetch != "" || *pause != "" || *resume != "" {
+		output, action := *fetch, "fetch"
+		if *pause != "" {
+			output, action = *pause, "pause"
+		} else if *resume != "" {
+			output, action = *resume, "resume"
+		}
+		if err := adminPost(*admin, output, action); err != nil {
+			log.Fatalf("%s %q: %s", action, output, err)
+		}
+		return
+	}
+
+	if *check {
+		results, err := getlatest.CheckConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Printf("FAILED  %s\n", result.Err)
+				failed++
+			} else {
+				fmt.Printf("ok      %q %q\n", result.Output, result.URLs)
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d target(s) failed", failed)
+		}
+		return
+	}
+
+	if *once {
+		getters, err := getlatest.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *statePath != "" {
+			if err := getlatest.LoadState(*statePath, getters); err != nil {
+				log.Fatal(err)
+			}
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		results := getlatest.RunOnce(ctx, getters, *maxConcurrent)
+		cancel()
+		if *statePath != "" {
+			if err := getlatest.SaveState(*statePath, getters); err != nil {
+				log.Print(err)
+			}
+		}
+		failed := 0
+		for _, result := range results {
+			// Err may be set even if no attempt was made,
+			// e.g., a dependency failed.
+			if result.Err != nil {
+				fmt.Printf("FAILED  %s\n", result.Err)
+				failed++
+			} else if !result.Attempted {
+				fmt.Printf("skipped %q: not due\n", result.Output)
+			} else {
+				fmt.Printf("ok      %q\n", result.Output)
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d target(s) failed", failed)
+		}
+		return
+	}
+
+	getters, err := getlatest.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mgr := getlatest.Manager{StateFile: *statePath, MaxConcurrent: *maxConcurrent}
+	mgr.Start(getters)
+	sdNotify("READY=1")
+	go sdWatchdog(&mgr)
+
+	if *admin != "" {
+		// The admin API is never served on the -metrics
+		// listener, which is often reachable from other hosts.
+		go func() {
+			err := http.ListenAndServe(*admin, mgr.AdminHandler())
+			slog.Error("admin API server stopped", "address", *admin, "error", err)
+		}()
+	}
+	http.Handle("/metrics", promhttp.Handler())
+	healthHandler := mgr.HealthHandler()
+	http.Handle("/healthz", healthHandler)
+	http.Handle("/status", healthHandler)
+	go http.ListenAndServe(*metrics, nil)
+	reload := func() {
+		slog.Info("reloading config file", "config", *configPath)
+		getters, err := getlatest.LoadConfig(*configPath)
+		if err != nil {
+			slog.Error("error reloading config, keeping current config", "error", err)
+		} else {
+			mgr.Update(getters)
+		}
+	}
+	if isService {
+		if err := serveService(svc.Name, &mgr, reload); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, append([]os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}, fetchAllSignals...)...)
+	for sig := range sigs {
+		if isFetchAllSignal(sig) {
+			slog.Info("starting all downloads now", "signal", sig.String())
+			mgr.TriggerAll()
+			continue
+		}
+		if sig != syscall.SIGHUP {
+			slog.Info("shutting down", "signal", sig.String())
+			sdNotify("STOPPING=1")
+			mgr.Shutdown()
+			return
+		}
+		sdNotify("RELOADING=1")
+		reload()
+		sdNotify("READY=1")
+	}
+}
+
+func isFetchAllSignal(sig os.Signal) bool {
+	for _, s := range fetchAllSignals {
+		if sig == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setupLogging replaces the default logger with a structured logger
+// that writes to w using the given format and minimum level. In text
+// format, timestamps are omitted, as they are normally added by the
+// journal (or the Windows event log).
+func setupLogging(w io.Writer, format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid -log-level %q: %s", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch format {
+	case "text":
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid -log-format %q: must be text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tomclegg/getlatest"
+)
+
+// sdNotify sends a state notification (e.g., "READY=1") to systemd,
+// if getlatest was started by systemd with Type=notify. Otherwise it
+// does nothing.
+func sdNotify(state string) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return
+	}
+	if path[0] == '@' {
+		// abstract namespace socket
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("error connecting to systemd notify socket", "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("error sending systemd notification", "state", state, "error", err)
+	}
+}
+
+// sdWatchdog sends WATCHDOG=1 to systemd at half the interval
+// requested by WatchdogSec, as long as the manager is responsive and
+// none of the targets are stuck (see Manager.Stuck). If the watchdog
+// is not enabled, it returns immediately.
+func sdWatchdog(mgr *getlatest.Manager) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	for range time.Tick(interval) {
+		// Status locks the manager and each getter, so it
+		// blocks (and the watchdog fires) if they are wedged.
+		mgr.Status()
+		if stuck := mgr.Stuck(); len(stuck) > 0 {
+			slog.Error("targets are stuck, not sending watchdog notification", "outputs", stuck)
+			continue
+		}
+		sdNotify("WATCHDOG=1")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// serviceConfig describes the service installed by -install-service.
+type serviceConfig struct {
+	Name   string // service name (systemd unit name without ".service", launchd label)
+	Binary string // absolute path to getlatest executable
+	Config string // -config argument
+	User   string
+	Group  string
+}
+
+// setup fills in defaults and checks the service config.
+func (sc *serviceConfig) setup() error {
+	if sc.Name == "" {
+		sc.Name = "getlatest"
+	}
+	if sc.Binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot determine path to getlatest executable (use -service-binary): %s", err)
+		}
+		sc.Binary = exe
+	}
+	for _, path := range []*string{&sc.Binary, &sc.Config} {
+		abs, err := filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+		*path = abs
+	}
+	return nil
+}
+
+// runCommands runs the given commands in order, stopping at the
+// first failure.
+func runCommands(cmds ...*exec.Cmd) error {
+	for _, cmd := range cmds {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%q: %s", cmd.Args, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var launchdPlistTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var buf strings.Builder
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Binary}}</string>
+		<string>-config</string>
+		<string>{{xml .Config}}</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>ThrottleInterval</key>
+	<integer>60</integer>
+	<key>StandardErrorPath</key>
+	<string>/var/log/{{xml .Name}}.log</string>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{- end}}
+{{- if .Group}}
+	<key>GroupName</key>
+	<string>{{xml .Group}}</string>
+{{- end}}
+</dict>
+</plist>
+`))
+
+func (sc *serviceConfig) plistPath() string {
+	return filepath.Join("/Library/LaunchDaemons", sc.Name+".plist")
+}
+
+// installService writes a launchd plist (LaunchDaemon) and loads
+// it, which starts the service.
+func installService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := launchdPlistTemplate.Execute(&buf, sc); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(sc.plistPath(), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of an existing file.
+	if err := os.Chmod(sc.plistPath(), 0644); err != nil {
+		return err
+	}
+	// If the service is already loaded (e.g., we are replacing an
+	// existing installation), unload it first so the new plist
+	// takes effect. An error here just means it wasn't loaded.
+	exec.Command("launchctl", "bootout", "system/"+sc.Name).Run()
+	return runCommands(exec.Command("launchctl", "bootstrap", "system", sc.plistPath()))
+}
+
+// uninstallService unloads (and stops) the service, and removes its
+// plist.
+func uninstallService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	err := runCommands(exec.Command("launchctl", "bootout", "system/"+sc.Name))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(sc.plistPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+)
+
+var systemdUnitTemplate = template.Must(template.New("unit").Parse(`
+[Unit]
+Description=getlatest
+After=network.target
+StartLimitIntervalSec=0
+ConditionPathExists={{.Config}}
+
+[Service]
+Type=notify
+WatchdogSec=60
+ExecStart={{.Binary}} -config {{.Config}}
+RestartSec=60
+Restart=always
+ExecReload=/bin/kill -HUP $MAINPID
+SyslogIdentifier={{.Name}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{- if .Group}}
+Group={{.Group}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func (sc *serviceConfig) unitPath() string {
+	return filepath.Join("/lib/systemd/system", sc.Name+".service")
+}
+
+// installService writes a systemd unit file and enables/starts the
+// service.
+func installService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := systemdUnitTemplate.Execute(&buf, sc); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(sc.unitPath(), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of an existing file.
+	if err := os.Chmod(sc.unitPath(), 0644); err != nil {
+		return err
+	}
+	return runCommands(
+		exec.Command("systemctl", "daemon-reload"),
+		exec.Command("systemctl", "enable", "--now", sc.Name+".service"))
+}
+
+// uninstallService stops and disables the service, and removes its
+// unit file.
+func uninstallService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	err := runCommands(exec.Command("systemctl", "disable", "--now", sc.Name+".service"))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(sc.unitPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return runCommands(exec.Command("systemctl", "daemon-reload"))
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func installService(sc serviceConfig) error {
+	return fmt.Errorf("-install-service is not supported on %s", runtime.GOOS)
+}
+
+func uninstallService(sc serviceConfig) error {
+	return fmt.Errorf("-uninstall-service is not supported on %s", runtime.GOOS)
+}
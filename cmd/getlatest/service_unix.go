@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/tomclegg/getlatest"
+)
+
+// serviceLog returns false: only Windows has a service manager that
+// getlatest needs to talk to directly.
+func serviceLog(name string) (io.Writer, bool) {
+	return nil, false
+}
+
+// fetchAllSignals start a download of every target right away.
+var fetchAllSignals = []os.Signal{syscall.SIGUSR1}
+
+func serveService(name string, mgr *getlatest.Manager, reload func()) error {
+	return errors.New("not running as a Windows service")
+}
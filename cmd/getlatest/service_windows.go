@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tomclegg/getlatest"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers getlatest with the Windows service
+// manager (starting automatically at boot), sets up its event log
+// source, and starts it. If User is given, the service runs as that
+// account (e.g., `NT AUTHORITY\LocalService`).
+func installService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	if sc.Group != "" {
+		return fmt.Errorf("-service-group is not supported on Windows")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.CreateService(sc.Name, sc.Binary, mgr.Config{
+		DisplayName:      "getlatest",
+		Description:      "Keeps local copies of remote files up to date",
+		StartType:        mgr.StartAutomatic,
+		ServiceStartName: sc.User,
+	}, "-config", sc.Config, "-service-name", sc.Name)
+	if err != nil {
+		return fmt.Errorf("error creating service %q: %s", sc.Name, err)
+	}
+	defer s.Close()
+	err = eventlog.InstallAsEventCreate(sc.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil && !strings.Contains(err.Error(), "exists") {
+		s.Delete()
+		return fmt.Errorf("error installing event log source: %s", err)
+	}
+	err = s.Start()
+	if err != nil {
+		return fmt.Errorf("error starting service %q: %s", sc.Name, err)
+	}
+	return nil
+}
+
+// uninstallService stops the service (waiting up to 30 seconds),
+// removes it from the service manager, and removes its event log
+// source.
+func uninstallService(sc serviceConfig) error {
+	if err := sc.setup(); err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(sc.Name)
+	if err != nil {
+		return fmt.Errorf("error opening service %q: %s", sc.Name, err)
+	}
+	defer s.Close()
+	if status, err := s.Control(svc.Stop); err == nil {
+		for deadline := time.Now().Add(30 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("error deleting service %q: %s", sc.Name, err)
+	}
+	eventlog.Remove(sc.Name)
+	return nil
+}
+
+// serviceLog returns true if getlatest was started by the Windows
+// service manager, along with a writer that sends log entries to
+// the event log.
+func serviceLog(name string) (io.Writer, bool) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return nil, false
+	}
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		// Without an event log source, there is nowhere
+		// useful to log to, but we can still run.
+		return io.Discard, true
+	}
+	return eventlogWriter{elog}, true
+}
+
+// eventlogWriter sends each log entry (one line of text or JSON from
+// slog) to the event log, with the event type matching its level.
+type eventlogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventlogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	switch {
+	case strings.Contains(msg, "level=ERROR"), strings.Contains(msg, `"level":"ERROR"`):
+		err = w.elog.Error(1, msg)
+	case strings.Contains(msg, "level=WARN"), strings.Contains(msg, `"level":"WARN"`):
+		err = w.elog.Warning(1, msg)
+	default:
+		err = w.elog.Info(1, msg)
+	}
+	return len(p), err
+}
+
+// serveService handles requests from the Windows service manager
+// until the service is stopped. A "paramchange" request (sc control
+// getlatest paramchange) reloads the config, like SIGHUP.
+// fetchAllSignals is empty: Windows has no SIGUSR1. Use the admin API
+// instead (see -fetch).
+var fetchAllSignals []os.Signal
+
+func serveService(name string, m *getlatest.Manager, reload func()) error {
+	return svc.Run(name, &windowsService{mgr: m, reload: reload})
+}
+
+type windowsService struct {
+	mgr    *getlatest.Manager
+	reload func()
+}
+
+func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	s <- svc.Status{State: svc.Running, Accepts: accepts}
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			s <- c.CurrentStatus
+		case svc.ParamChange:
+			ws.reload()
+		case svc.Stop, svc.Shutdown:
+			slog.Info("shutting down", "request", fmt.Sprint(c.Cmd))
+			s <- svc.Status{State: svc.StopPending}
+			ws.mgr.Shutdown()
+			return false, 0
+		}
+	}
+	return false, 0
+}
@@ -0,0 +1,450 @@
+package getlatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/ghodss/yaml"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads a YAML config file and returns a Getter for each
+// output file listed. Setup has already been called on each Getter.
+//
+// If path is a directory, all *.yaml and *.yml files in it are loaded
+// (in lexical order) and merged. It is an error for the same output
+// file to appear in more than one of them.
+func LoadConfig(path string) (map[string]*Getter, error) {
+	getters, source, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for output, g := range getters {
+		err := g.Setup()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", source[output], err)
+		}
+	}
+	if err := checkDependencies(getters); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return getters, nil
+}
+
+// A CheckResult is the outcome of checking the config for a single
+// output file.
+type CheckResult struct {
+	Output string
+	URLs   []string // URLs that would be used now (templates expanded)
+	Err    error
+}
+
+// CheckConfig loads a config file (or directory) like LoadConfig, but
+// reports the outcome of Setup for each target separately instead of
+// stopping at the first error. The returned error is non-nil only if
+// the config cannot be loaded at all (e.g., YAML syntax error). The
+// results are sorted by output file.
+func CheckConfig(path string) ([]CheckResult, error) {
+	getters, source, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []CheckResult
+	for output, g := range getters {
+		result := CheckResult{Output: output}
+		result.Err = g.Setup()
+		if result.Err != nil {
+			result.Err = fmt.Errorf("%s: %s", source[output], result.Err)
+		} else {
+			for _, m := range g.mirrors {
+				url, err := g.expand(m.urlt)
+				if err != nil {
+					result.Err = fmt.Errorf("%s: %q: error expanding URL %q: %s", source[output], output, m.config, err)
+					break
+				}
+				result.URLs = append(result.URLs, url)
+			}
+		}
+		if result.Err == nil {
+			for _, dep := range g.DependsOn {
+				if _, ok := getters[dep]; !ok {
+					result.Err = fmt.Errorf("%s: %q: DependsOn unknown target %q", source[output], output, dep)
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	if err := checkDependencies(getters); err != nil {
+		for i := range results {
+			if results[i].Err == nil && len(getters[results[i].Output].DependsOn) > 0 {
+				results[i].Err = fmt.Errorf("%s: %s", path, err)
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Output < results[j].Output
+	})
+	return results, nil
+}
+
+// loadConfig loads all targets from the given config file or
+// directory, without calling Setup. It returns the getters, and the
+// file where each one was found.
+func loadConfig(path string) (map[string]*Getter, map[string]string, error) {
+	files := []string{path}
+	if fi, err := os.Stat(path); err != nil {
+		return nil, nil, err
+	} else if fi.IsDir() {
+		files, err = configFiles(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	getters := map[string]*Getter{}
+	source := map[string]string{}
+	for _, file := range files {
+		loaded, err := loadConfigFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		for output, g := range loaded {
+			if prev, ok := source[output]; ok {
+				return nil, nil, fmt.Errorf("%q: duplicate output file in %q and %q", output, prev, file)
+			}
+			g.Output = output
+			source[output] = file
+			getters[output] = g
+		}
+	}
+	return getters, source, nil
+}
+
+// configFiles returns the YAML files in dir, sorted by name. Hidden
+// files (e.g., editor backups) are skipped.
+func configFiles(dir string) ([]string, error) {
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, ent := range ents {
+		name := ent.Name()
+		if ent.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConfig replaces ${VAR} in YAML scalars with the value of the
+// environment variable VAR, and values tagged "!secret path" with the
+// content of the given file (with leading/trailing whitespace
+// removed). Relative secret paths are relative to dir.
+//
+// It is an error to refer to an undefined environment variable.
+func expandConfig(buf []byte, dir string) ([]byte, error) {
+	var doc yaml3.Node
+	err := yaml3.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		// empty file
+		return buf, nil
+	}
+	err = expandNode(&doc, dir)
+	if err != nil {
+		return nil, err
+	}
+	quoteMatrixValues(&doc)
+	return yaml3.Marshal(&doc)
+}
+
+// quoteMatrixValues marks the values in each generate Matrix as
+// strings, so numbers keep their literal text (e.g., "1.10" or
+// "1234567") instead of being converted to float64 and back.
+func quoteMatrixValues(doc *yaml3.Node) {
+	top := doc.Content[0]
+	if top.Kind != yaml3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		if top.Content[i].Value != generateKey || top.Content[i+1].Kind != yaml3.SequenceNode {
+			continue
+		}
+		for _, gen := range top.Content[i+1].Content {
+			if gen.Kind != yaml3.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(gen.Content); j += 2 {
+				if !strings.EqualFold(gen.Content[j].Value, "Matrix") || gen.Content[j+1].Kind != yaml3.MappingNode {
+					continue
+				}
+				matrix := gen.Content[j+1]
+				for k := 1; k < len(matrix.Content); k += 2 {
+					for _, v := range matrix.Content[k].Content {
+						if v.Kind == yaml3.ScalarNode && v.Tag != "!!null" {
+							v.Tag = "!!str"
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func expandNode(node *yaml3.Node, dir string) error {
+	if node.Kind == yaml3.ScalarNode {
+		var err error
+		value := envVarRegexp.ReplaceAllStringFunc(node.Value, func(s string) string {
+			name := envVarRegexp.FindStringSubmatch(s)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("line %d: environment variable %q is not set", node.Line, name)
+			}
+			return v
+		})
+		if err != nil {
+			return err
+		}
+		if value != node.Value {
+			node.Value = value
+			if node.Style == 0 {
+				// Let the expanded value determine
+				// its type, e.g., MinimumSize: ${SIZE}
+				node.Tag = ""
+			}
+		}
+		if node.Tag == "!secret" {
+			path := node.Value
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			secret, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("line %d: error reading secret: %s", node.Line, err)
+			}
+			node.Value = strings.TrimSpace(string(secret))
+			node.Tag = "!!str"
+			node.Style = yaml3.DoubleQuotedStyle
+		}
+	}
+	for _, child := range node.Content {
+		if err := expandNode(child, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultsKey is the top-level config key whose fields are used as
+// defaults for all targets in the same file.
+const defaultsKey = "defaults"
+
+// generateKey is the top-level config key for a list of generators,
+// each of which expands into many targets.
+const generateKey = "generate"
+
+// A generator is an entry in the "generate" section of a config
+// file. It expands into one target for each combination of Matrix
+// values, with Output (a text/template) expanded using the values,
+// and the values also available to URL templates as Vars.
+type generator struct {
+	Output string
+	Matrix map[string][]json.RawMessage // variable name => values
+	Target map[string]json.RawMessage
+}
+
+// matrixValue returns a Matrix value as a string: a JSON string is
+// unquoted, and any other scalar is used as its literal JSON text.
+func matrixValue(v json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s, nil
+	}
+	lit := strings.TrimSpace(string(v))
+	if lit == "" || lit == "null" || lit[0] == '{' || lit[0] == '[' {
+		return "", fmt.Errorf("invalid value %s", lit)
+	}
+	return lit, nil
+}
+
+// maxGenerated is the maximum number of targets a single generator
+// can produce.
+const maxGenerated = 10000
+
+// expand returns the config fields for each generated target, keyed
+// by output file.
+func (gen *generator) expand() (map[string]map[string]json.RawMessage, error) {
+	if gen.Output == "" {
+		return nil, fmt.Errorf("missing Output")
+	}
+	outt, err := texttemplate.New("Output").Option("missingkey=error").Parse(gen.Output)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Output %q: %s", gen.Output, err)
+	}
+	var names []string
+	for name, values := range gen.Matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("Matrix %q has no values", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Start with the target's own Vars, if any.
+	base := map[string]string{}
+	fields := map[string]json.RawMessage{}
+	for k, v := range gen.Target {
+		if strings.EqualFold(k, "Vars") {
+			if err := json.Unmarshal(v, &base); err != nil {
+				return nil, fmt.Errorf("Target Vars: %s", err)
+			}
+		} else {
+			fields[k] = v
+		}
+	}
+	combos := []map[string]string{base}
+	for _, name := range names {
+		if len(combos)*len(gen.Matrix[name]) > maxGenerated {
+			return nil, fmt.Errorf("Matrix would generate more than %d targets", maxGenerated)
+		}
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, v := range gen.Matrix[name] {
+				vars := map[string]string{}
+				for k, v := range combo {
+					vars[k] = v
+				}
+				s, err := matrixValue(v)
+				if err != nil {
+					return nil, fmt.Errorf("Matrix %q: %s", name, err)
+				}
+				vars[name] = s
+				next = append(next, vars)
+			}
+		}
+		combos = next
+	}
+	targets := map[string]map[string]json.RawMessage{}
+	for _, vars := range combos {
+		var buf strings.Builder
+		if err := outt.Execute(&buf, vars); err != nil {
+			return nil, fmt.Errorf("error expanding Output %q: %s", gen.Output, err)
+		}
+		output := buf.String()
+		if _, dup := targets[output]; dup {
+			return nil, fmt.Errorf("duplicate output file %q (Output %q must use all Matrix variables)", output, gen.Output)
+		}
+		js, err := json.Marshal(vars)
+		if err != nil {
+			return nil, err
+		}
+		target := map[string]json.RawMessage{"Vars": js}
+		for k, v := range fields {
+			target[k] = v
+		}
+		targets[output] = target
+	}
+	return targets, nil
+}
+
+// loadConfigFile parses a single config file. Setup is not called.
+//
+// Fields in the file's "defaults" section are applied to each target
+// that doesn't set them itself. A field set in a target replaces the
+// default entirely (e.g., Headers are not merged).
+func loadConfigFile(path string) (map[string]*Getter, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	buf, err = expandConfig(buf, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	js, err := yaml.YAMLToJSON(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	var top map[string]json.RawMessage
+	err = json.Unmarshal(js, &top)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	var gens []generator
+	if js, ok := top[generateKey]; ok {
+		err = json.Unmarshal(js, &gens)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", path, generateKey, err)
+		}
+		delete(top, generateKey)
+	}
+	raw := map[string]map[string]json.RawMessage{}
+	for output, js := range top {
+		var fields map[string]json.RawMessage
+		err = json.Unmarshal(js, &fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %s", path, output, err)
+		}
+		raw[output] = fields
+	}
+	defaults := raw[defaultsKey]
+	delete(raw, defaultsKey)
+	for i, gen := range gens {
+		targets, err := gen.expand()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s[%d]: %s", path, generateKey, i, err)
+		}
+		for output, fields := range targets {
+			if _, dup := raw[output]; dup {
+				return nil, fmt.Errorf("%s: %s[%d]: duplicate output file %q", path, generateKey, i, output)
+			}
+			raw[output] = fields
+		}
+	}
+	getters := map[string]*Getter{}
+	for output, fields := range raw {
+		if fields == nil {
+			return nil, fmt.Errorf("%s: %q: empty config", path, output)
+		}
+		merged := map[string]json.RawMessage{}
+		for k, v := range defaults {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			// Field names are case-insensitive (as in
+			// json.Unmarshal), so "ttl" overrides a
+			// default "TTL".
+			for dk := range merged {
+				if strings.EqualFold(dk, k) {
+					delete(merged, dk)
+				}
+			}
+			merged[k] = v
+		}
+		js, err := json.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %s", path, output, err)
+		}
+		g := &Getter{}
+		err = json.Unmarshal(js, g)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %s", path, output, err)
+		}
+		getters[output] = g
+	}
+	return getters, nil
+}
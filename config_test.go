@@ -0,0 +1,273 @@
+package getlatest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.yaml":      "/tmp/a:\n  URL: http://host.example/a\n",
+		"b.yml":       "/tmp/b:\n  URL: http://host.example/b\n/tmp/c:\n  URL: http://host.example/c\n",
+		".hidden.yml": "/tmp/hidden:\n  URL: http://host.example/hidden\n",
+		"README":      "not yaml",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	getters, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getters) != 3 || getters["/tmp/c"].Output != "/tmp/c" || getters["/tmp/hidden"] != nil {
+		t.Errorf("unexpected getters %v", getters)
+	}
+
+	// A single file still works.
+	getters, err = LoadConfig(filepath.Join(dir, "b.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getters) != 2 {
+		t.Errorf("unexpected getters %v", getters)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "d.yaml"), []byte("/tmp/a:\n  URL: http://host.example/d\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(dir)
+	if err == nil || !strings.Contains(err.Error(), "duplicate") || !strings.Contains(err.Error(), "a.yaml") || !strings.Contains(err.Error(), "d.yaml") {
+		t.Errorf("expected duplicate error naming both files, got %v", err)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getlatest.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+defaults:
+  TTL: 2h
+  MinimumSize: 10
+  FileMode: 0640
+  Headers:
+    Accept: text/plain
+/tmp/a:
+  URL: http://host.example/a
+/tmp/b:
+  URL: http://host.example/b
+  ttl: 5m
+  Headers:
+    X-Foo: bar
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getters, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getters) != 2 {
+		t.Fatalf("unexpected getters %v", getters)
+	}
+	a, b := getters["/tmp/a"], getters["/tmp/b"]
+	if a.TTL != "2h" || a.MinimumSize != 10 || a.FileMode != 0640 || a.Headers["Accept"] != "text/plain" {
+		t.Errorf("defaults not applied: %+v", a)
+	}
+	if b.TTL != "5m" || b.MinimumSize != 10 || b.Headers["Accept"] != "" || b.Headers["X-Foo"] != "bar" {
+		t.Errorf("defaults not overridden: %+v", b)
+	}
+}
+
+func TestConfigExpand(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GETLATEST_TEST_HOST", "host.example")
+	os.Setenv("GETLATEST_TEST_SIZE", "123")
+	defer os.Unsetenv("GETLATEST_TEST_HOST")
+	defer os.Unsetenv("GETLATEST_TEST_SIZE")
+	path := filepath.Join(dir, "getlatest.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+/tmp/a:
+  URL: "https://${GETLATEST_TEST_HOST}/a?t={{.time.Unix}}"
+  MinimumSize: ${GETLATEST_TEST_SIZE}
+  BearerToken: !secret token
+  Headers:
+    X-Literal: "$HOME"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getters, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := getters["/tmp/a"]
+	if g.URL != "https://host.example/a?t={{.time.Unix}}" || g.MinimumSize != 123 || g.BearerToken != "s3cr3t" || g.Headers["X-Literal"] != "$HOME" {
+		t.Errorf("unexpected config %+v", g)
+	}
+
+	err = ioutil.WriteFile(path, []byte("/tmp/a:\n  URL: https://${GETLATEST_TEST_UNDEFINED}/a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "GETLATEST_TEST_UNDEFINED") {
+		t.Errorf("expected error about undefined variable, got %v", err)
+	}
+}
+
+func TestConfigGenerate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getlatest.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+defaults:
+  TTL: 2h
+generate:
+  - Output: "/tmp/{{.region}}/{{.dataset}}.csv"
+    Matrix:
+      region: [us-east-1, eu-west-1]
+      dataset: [prices, 2024]
+    Target:
+      URL: "https://{{.region}}.host.example/{{.dataset}}.csv?t={{.time.Unix}}&v={{.version}}"
+      Vars:
+        version: "1&2"
+      MinimumSize: 10
+/tmp/other:
+  URL: http://host.example/other
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getters, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getters) != 5 {
+		t.Errorf("expected 5 getters, got %d", len(getters))
+	}
+	for _, region := range []string{"us-east-1", "eu-west-1"} {
+		for _, dataset := range []string{"prices", "2024"} {
+			output := "/tmp/" + region + "/" + dataset + ".csv"
+			g, ok := getters[output]
+			if !ok {
+				t.Errorf("missing generated target %q", output)
+				continue
+			}
+			if g.TTL != "2h" || g.MinimumSize != 10 || g.Vars["region"] != region || g.Vars["dataset"] != dataset {
+				t.Errorf("unexpected config %+v", g)
+			}
+			url, err := g.expand(g.mirrors[0].urlt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := fmt.Sprintf("https://%s.host.example/%s.csv?t=", region, dataset)
+			if !strings.HasPrefix(url, expect) || !strings.HasSuffix(url, "&v=1&2") {
+				t.Errorf("expected URL like %s...&v=1&2, got %s", expect, url)
+			}
+		}
+	}
+
+	// Numbers keep their literal text.
+	err = ioutil.WriteFile(path, []byte(`
+generate:
+  - Output: "/tmp/{{.id}}-{{.version}}"
+    Matrix:
+      id: [1234567, 12345678901234567890]
+      version: [1.10, 2]
+    Target:
+      URL: "https://host.example/{{.id}}/{{.version}}"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getters, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range []string{"/tmp/1234567-1.10", "/tmp/1234567-2", "/tmp/12345678901234567890-1.10", "/tmp/12345678901234567890-2"} {
+		g, ok := getters[output]
+		if !ok {
+			t.Errorf("missing generated target %q (got %d targets)", output, len(getters))
+			continue
+		}
+		url, err := g.expand(g.mirrors[0].urlt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "https://host.example/" + g.Vars["id"] + "/" + g.Vars["version"]; url != expect || "/tmp/"+g.Vars["id"]+"-"+g.Vars["version"] != output {
+			t.Errorf("%s: unexpected Vars %q, URL %q", output, g.Vars, url)
+		}
+	}
+
+	for _, conf := range []string{
+		// Output doesn't use all variables
+		"generate:\n- Output: /tmp/{{.a}}\n  Matrix: {a: [x, y], b: [x, y]}\n  Target: {URL: http://host.example/}\n",
+		// unknown variable
+		"generate:\n- Output: /tmp/{{.c}}\n  Matrix: {a: [x, y]}\n  Target: {URL: http://host.example/}\n",
+		// no values
+		"generate:\n- Output: /tmp/{{.a}}\n  Matrix: {a: []}\n  Target: {URL: http://host.example/}\n",
+		// conflicts with explicit target
+		"/tmp/x:\n  URL: http://host.example/\ngenerate:\n- Output: /tmp/{{.a}}\n  Matrix: {a: [x, y]}\n  Target: {URL: http://host.example/}\n",
+		// reserved name
+		"generate:\n- Output: /tmp/{{.time}}\n  Matrix: {time: [x, y]}\n  Target: {URL: http://host.example/}\n",
+		"generate: {}\n",
+	} {
+		err := ioutil.WriteFile(path, []byte(conf), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("expected error loading %q", conf)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "getlatest.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+/tmp/a:
+  URL: "http://host.example/a?y={{.time.Year}}"
+  URLs: ["http://mirror.example/a"]
+/tmp/b:
+  URL: "http://host.example/b"
+  TTL: bogus
+/tmp/c:
+  URL: "gopher://host.example/c"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := CheckConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if r := results[0]; r.Err != nil || len(r.URLs) != 2 || r.URLs[0] != fmt.Sprintf("http://host.example/a?y=%d", time.Now().Year()) {
+		t.Errorf("unexpected result %+v", r)
+	}
+	for _, r := range results[1:] {
+		if r.Err == nil || !strings.Contains(r.Err.Error(), path) {
+			t.Errorf("expected error mentioning config file, got %+v", r)
+		}
+	}
+
+	err = ioutil.WriteFile(path, []byte("/tmp/a: [\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckConfig(path); err == nil {
+		t.Error("expected error for invalid YAML")
+	}
+}
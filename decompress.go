@@ -0,0 +1,70 @@
+package getlatest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressor returns a rewriteFunc that decompresses content in the
+// given format.
+func decompressor(format string) (rewriteFunc, error) {
+	switch format {
+	case "gzip", "zstd", "bzip2", "auto":
+	default:
+		return nil, fmt.Errorf("unsupported Decompress format %q (must be gzip, zstd, bzip2, or auto)", format)
+	}
+	return func(w io.Writer, src *os.File) error {
+		r := bufio.NewReader(src)
+		format := format
+		if format == "auto" {
+			magic, _ := r.Peek(4)
+			switch {
+			case bytes.HasPrefix(magic, gzipMagic):
+				format = "gzip"
+			case bytes.HasPrefix(magic, bzip2Magic):
+				format = "bzip2"
+			case bytes.HasPrefix(magic, zstdMagic):
+				format = "zstd"
+			}
+		}
+		var dr io.Reader
+		switch format {
+		case "gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return fmt.Errorf("gzip: %s", err)
+			}
+			defer zr.Close()
+			dr = zr
+		case "bzip2":
+			dr = bzip2.NewReader(r)
+		case "zstd":
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return fmt.Errorf("zstd: %s", err)
+			}
+			defer zr.Close()
+			dr = zr
+		default:
+			dr = r
+		}
+		_, err := io.Copy(w, dr)
+		if err != nil {
+			return fmt.Errorf("error decompressing (%s): %s", format, err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,78 @@
+package getlatest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompress(t *testing.T) {
+	content := bytes.Repeat([]byte("hello\n"), 1000)
+	var gz, zst bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(content)
+	gw.Close()
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(content)
+	zw.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/data.gz":
+			w.Write(gz.Bytes())
+		case "/data.zst":
+			w.Write(zst.Bytes())
+		case "/data":
+			w.Write(content)
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path   string
+		format string
+		ok     bool
+	}{
+		{"/data.gz", "gzip", true},
+		{"/data.gz", "auto", true},
+		{"/data.zst", "zstd", true},
+		{"/data.zst", "auto", true},
+		{"/data", "auto", true},
+		{"/data", "gzip", false},
+		{"/data.zst", "gzip", false},
+	} {
+		g := &Getter{
+			URL:         srv.URL + trial.path,
+			Output:      filepath.Join(t.TempDir(), "foo"),
+			Decompress:  trial.format,
+			MinimumSize: int64(len(content)),
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if !trial.ok {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+			continue
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || !bytes.Equal(buf, content) {
+			t.Errorf("%+v: output file has %d bytes, %v", trial, len(buf), err)
+		}
+	}
+}
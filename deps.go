@@ -0,0 +1,112 @@
+package getlatest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// checkDependencies returns an error if any of the given getters
+// depends on a target that is not in the set, or if there is a
+// dependency cycle.
+func checkDependencies(getters map[string]*Getter) error {
+	var outputs []string
+	for output := range getters {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	mark := map[string]int{}
+	var visit func(output string, path []string) error
+	visit = func(output string, path []string) error {
+		switch mark[output] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %q", append(path, output))
+		case visited:
+			return nil
+		}
+		mark[output] = visiting
+		for _, dep := range getters[output].DependsOn {
+			if _, ok := getters[dep]; !ok {
+				return fmt.Errorf("%q: DependsOn unknown target %q", output, dep)
+			}
+			if err := visit(dep, append(path, output)); err != nil {
+				return err
+			}
+		}
+		mark[output] = visited
+		return nil
+	}
+	for _, output := range outputs {
+		if err := visit(output, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkDependencies sets up the deps and dependents of each of the
+// given getters. Unknown targets in DependsOn are ignored.
+func linkDependencies(getters map[string]*Getter) {
+	for _, g := range getters {
+		g.mtx.Lock()
+		g.deps, g.dependents = nil, nil
+		g.mtx.Unlock()
+	}
+	for _, g := range getters {
+		for _, output := range g.DependsOn {
+			dep, ok := getters[output]
+			if !ok {
+				continue
+			}
+			g.mtx.Lock()
+			g.deps = append(g.deps, dep)
+			g.mtx.Unlock()
+			dep.mtx.Lock()
+			dep.dependents = append(dep.dependents, g)
+			dep.mtx.Unlock()
+		}
+	}
+}
+
+// depsReady returns true if each of g's dependencies has succeeded in
+// the current cycle, i.e., it has an output file, is not failing, is
+// not in the middle of a download attempt, and is not due for another
+// one. Otherwise, when a target and its dependency come due at the
+// same time, the target would be downloaded against the dependency's
+// stale output.
+func (g *Getter) depsReady() bool {
+	g.mtx.Lock()
+	deps := g.deps
+	g.mtx.Unlock()
+	now := time.Now()
+	for _, dep := range deps {
+		dep.mtx.Lock()
+		ok := !dep.lastSuccess.IsZero() && dep.failSince.IsZero() && !dep.downloading && !dep.should(now)
+		dep.mtx.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// wakeDependents tells g's dependents that g has succeeded. If g's
+// output was updated, they download as soon as their schedules allow,
+// even if their own TTLs have not expired; otherwise they just
+// re-check whether they are due.
+func (g *Getter) wakeDependents(updated bool) {
+	g.mtx.Lock()
+	dependents := g.dependents
+	g.mtx.Unlock()
+	for _, d := range dependents {
+		if updated {
+			d.signal(d.depUpdated)
+		} else {
+			d.signal(d.wake)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	for _, trial := range []struct {
+		deps   map[string][]string
+		errMsg string
+	}{
+		{map[string][]string{"a": nil, "b": {"a"}, "c": {"a", "b"}}, ""},
+		{map[string][]string{"a": nil, "b": {"x"}}, "unknown target"},
+		{map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}}, "cycle"},
+	} {
+		getters := map[string]*Getter{}
+		for output, deps := range trial.deps {
+			getters[output] = &Getter{Output: output, DependsOn: deps}
+		}
+		err := checkDependencies(getters)
+		if trial.errMsg == "" && err != nil {
+			t.Errorf("%v: %s", trial.deps, err)
+		} else if trial.errMsg != "" && (err == nil || !strings.Contains(err.Error(), trial.errMsg)) {
+			t.Errorf("%v: expected %q error, got %v", trial.deps, trial.errMsg, err)
+		}
+	}
+}
+
+// depsServer serves /index and /data, and records the order of
+// completed requests.
+type depsServer struct {
+	*httptest.Server
+	mtx       sync.Mutex
+	log       []string
+	failIndex atomic.Bool
+	version   atomic.Int64
+}
+
+func newDepsServer() *depsServer {
+	s := &depsServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/index" {
+			time.Sleep(100 * time.Millisecond)
+			if s.failIndex.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		fmt.Fprintf(w, "%s version %d\n", req.URL.Path, s.version.Load())
+		s.mtx.Lock()
+		s.log = append(s.log, req.URL.Path)
+		s.mtx.Unlock()
+	}))
+	return s
+}
+
+func (s *depsServer) requests() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return strings.Join(s.log, ",")
+}
+
+func (s *depsServer) getters(t *testing.T) map[string]*Getter {
+	tmpdir := t.TempDir()
+	index := &Getter{URL: s.URL + "/index", Output: filepath.Join(tmpdir, "index"), TTL: "1h"}
+	data := &Getter{URL: s.URL + "/data", Output: filepath.Join(tmpdir, "data"), TTL: "1h", DependsOn: []string{index.Output}}
+	getters := map[string]*Getter{index.Output: index, data.Output: data}
+	for _, g := range getters {
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return getters
+}
+
+func TestRunOnceDependsOn(t *testing.T) {
+	srv := newDepsServer()
+	defer srv.Close()
+
+	results := RunOnce(context.Background(), srv.getters(t), 0)
+	for _, r := range results {
+		if r.Err != nil || !r.Attempted {
+			t.Errorf("%+v", r)
+		}
+	}
+	if got := srv.requests(); got != "/index,/data" {
+		t.Errorf("got requests %q", got)
+	}
+
+	srv.failIndex.Store(true)
+	results = RunOnce(context.Background(), srv.getters(t), 0)
+	for _, r := range results {
+		if r.Err == nil {
+			t.Errorf("expected error: %+v", r)
+		} else if strings.HasSuffix(r.Output, "data") && (r.Attempted || !strings.Contains(r.Err.Error(), "dependency")) {
+			t.Errorf("expected dependency error: %+v", r)
+		}
+	}
+}
+
+func TestManagerDependsOn(t *testing.T) {
+	defer func(d time.Duration) { minCheckWait = d }(minCheckWait)
+	minCheckWait = 10 * time.Millisecond
+
+	srv := newDepsServer()
+	defer srv.Close()
+	getters := srv.getters(t)
+	var index string
+	for output, g := range getters {
+		if len(g.DependsOn) == 0 {
+			index = output
+		}
+	}
+
+	waitFor := func(expect string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for srv.requests() != expect && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := srv.requests(); got != expect {
+			t.Fatalf("got requests %q, expected %q", got, expect)
+		}
+	}
+
+	var mgr Manager
+	mgr.Start(getters)
+	defer mgr.Stop()
+	waitFor("/index,/data")
+
+	// New index content triggers a data download, even though
+	// data's TTL has not expired.
+	srv.version.Add(1)
+	mgr.TriggerNow(index)
+	waitFor("/index,/data,/index,/data")
+
+	// A paused dependent doesn't download when its dependency is
+	// updated, but does catch up when resumed.
+	var data string
+	for output := range getters {
+		if output != index {
+			data = output
+		}
+	}
+	if err := mgr.Pause(data); err != nil {
+		t.Fatal(err)
+	}
+	srv.version.Add(1)
+	mgr.TriggerNow(index)
+	waitFor("/index,/data,/index,/data,/index")
+	time.Sleep(200 * time.Millisecond)
+	waitFor("/index,/data,/index,/data,/index")
+	if err := mgr.Resume(data); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("/index,/data,/index,/data,/index,/data")
+}
+
+func TestDependsOnSameCycle(t *testing.T) {
+	defer func(d time.Duration) { minCheckWait = d }(minCheckWait)
+	minCheckWait = 10 * time.Millisecond
+
+	srv := newDepsServer()
+	defer srv.Close()
+	getters := srv.getters(t)
+	linkDependencies(getters)
+
+	// Both targets succeeded 2h ago, so both are due now.
+	for _, g := range getters {
+		if err := ioutil.WriteFile(g.Output, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		g.lastSuccess = time.Now().Add(-2 * time.Hour)
+	}
+	for _, g := range getters {
+		if len(g.DependsOn) > 0 && g.depsReady() {
+			t.Error("depsReady() returned true while dependency is due")
+		}
+	}
+
+	var mgr Manager
+	mgr.Start(getters)
+	defer mgr.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.requests() != "/index,/data" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := srv.requests(); got != "/index,/data" {
+		t.Errorf("got requests %q, expected data to wait for index", got)
+	}
+}
@@ -0,0 +1,137 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// setupDNS prepares the ResolveTo, DNSServers, and IPVersion settings
+// used by dialContext.
+func (g *Getter) setupDNS() error {
+	g.resolveTo = nil
+	for host, ip := range g.ResolveTo {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ResolveTo address %q for %q (must be an IP address)", ip, host)
+		}
+		if g.resolveTo == nil {
+			g.resolveTo = map[string]string{}
+		}
+		g.resolveTo[strings.ToLower(host)] = ip
+	}
+	switch g.IPVersion {
+	case "", "auto", "4", "6":
+	default:
+		return fmt.Errorf("invalid IPVersion %q (must be 4, 6, or auto)", g.IPVersion)
+	}
+	g.resolver = nil
+	if len(g.DNSServers) == 0 {
+		return nil
+	}
+	var servers []string
+	for _, s := range g.DNSServers {
+		if net.ParseIP(s) != nil {
+			s = net.JoinHostPort(s, "53")
+		} else if host, port, err := net.SplitHostPort(s); err != nil || net.ParseIP(host) == nil || !isPort(port) {
+			return fmt.Errorf("invalid DNSServers entry %q (must be an IP address, optionally with :port)", s)
+		}
+		servers = append(servers, s)
+	}
+	var next atomic.Uint32
+	g.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			// The resolver retries failed queries, so
+			// rotating through the servers here provides
+			// failover.
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+	return nil
+}
+
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
+
+// resolveAddr returns addr ("host:port") with the host replaced by
+// its ResolveTo address, if any.
+func (g *Getter) resolveAddr(addr string) string {
+	if g.resolveTo == nil {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	for _, key := range []string{addr, host} {
+		if ip, ok := g.resolveTo[strings.ToLower(key)]; ok {
+			return net.JoinHostPort(ip, port)
+		}
+	}
+	return addr
+}
+
+// ipNetwork returns network ("tcp", "udp", or "ip") restricted to
+// the IPVersion address family, e.g., "tcp4".
+func (g *Getter) ipNetwork(network string) string {
+	switch g.IPVersion {
+	case "4", "6":
+		return network + g.IPVersion
+	default:
+		return network
+	}
+}
+
+// dialOverrides returns true if ResolveTo, DNSServers, or IPVersion
+// affect how addresses are resolved.
+func (g *Getter) dialOverrides() bool {
+	return g.resolveTo != nil || g.resolver != nil || g.ipNetwork("ip") != "ip"
+}
+
+// dialContext connects to addr using the configured timeout,
+// ResolveTo, DNSServers, and IPVersion -- or, if UnixSocket is set,
+// connects to UnixSocket regardless of addr.
+func (g *Getter) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if g.UnixSocket != "" {
+		d := net.Dialer{Timeout: g.connectTimeout}
+		return d.DialContext(ctx, "unix", g.UnixSocket)
+	}
+	d := net.Dialer{
+		Timeout:   g.connectTimeout,
+		KeepAlive: 30 * time.Second,
+		Resolver:  g.resolver,
+	}
+	return d.DialContext(ctx, g.ipNetwork(network), g.resolveAddr(addr))
+}
+
+// lookupAddr resolves the host part of addr ("host:port") using
+// ResolveTo, DNSServers, and IPVersion, and returns "ip:port". It is
+// used where the connection is made by a library that doesn't accept
+// a dial func.
+func (g *Getter) lookupAddr(ctx context.Context, addr string) (string, error) {
+	addr = g.resolveAddr(addr)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	r := g.resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	ips, err := r.LookupIP(ctx, g.ipNetwork("ip"), host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
@@ -0,0 +1,207 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startTestDNSServer answers every A query with 127.0.0.1, and
+// returns the server address and a pointer to the number of queries
+// answered.
+func startTestDNSServer(t *testing.T) (string, *atomic.Int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	queries := new(atomic.Int32)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true})
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+			if q.Type == dnsmessage.TypeA {
+				queries.Add(1)
+				b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+			}
+			msg, err := b.Finish()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(msg, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), queries
+}
+
+func TestResolveTo(t *testing.T) {
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hosts = append(hosts, req.Host)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	dnsAddr, queries := startTestDNSServer(t)
+
+	for _, trial := range []struct {
+		resolveTo  map[string]string
+		dnsServers []string
+		queries    int32
+	}{
+		{resolveTo: map[string]string{"Fake.Example": "127.0.0.1"}},
+		{resolveTo: map[string]string{"fake.example:" + port: "127.0.0.1"}},
+		{dnsServers: []string{dnsAddr}, queries: 1},
+	} {
+		hosts = nil
+		queries.Store(0)
+		g := &Getter{
+			URL:        "http://fake.example:" + port + "/foo",
+			Output:     filepath.Join(t.TempDir(), "foo"),
+			ResolveTo:  trial.resolveTo,
+			DNSServers: trial.dnsServers,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatalf("%+v: %s", trial, err)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+			t.Errorf("%+v: output %q, %v", trial, buf, err)
+		}
+		if len(hosts) != 1 || hosts[0] != "fake.example:"+port {
+			t.Errorf("%+v: expected request with original Host header, got %q", trial, hosts)
+		}
+		if n := queries.Load(); n != trial.queries {
+			t.Errorf("%+v: expected %d DNS queries, got %d", trial, trial.queries, n)
+		}
+	}
+
+	for _, bad := range []*Getter{
+		{ResolveTo: map[string]string{"fake.example": "localhost"}},
+		{DNSServers: []string{"dns.example"}},
+		{DNSServers: []string{"10.0.0.1:dns"}},
+	} {
+		bad.URL = srv.URL
+		bad.Output = filepath.Join(t.TempDir(), "foo")
+		if err := bad.Setup(); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("ResolveTo %q DNSServers %q: expected error, got %v", bad.ResolveTo, bad.DNSServers, err)
+		}
+	}
+}
+
+func TestIPVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	ftpsrv := newFTPTestServer(t, map[string]string{"/foo": "hello\n"})
+	_, ftpport, _ := net.SplitHostPort(ftpsrv.ln.Addr().String())
+	// The test DNS server only returns IPv4 addresses.
+	dnsAddr, _ := startTestDNSServer(t)
+
+	for _, trial := range []struct {
+		url        string
+		ipVersion  string
+		resolveTo  map[string]string
+		dnsServers []string
+		ok         bool
+	}{
+		{url: "http://fake.example:" + port + "/foo", ipVersion: "4", dnsServers: []string{dnsAddr}, ok: true},
+		{url: "http://fake.example:" + port + "/foo", ipVersion: "6", dnsServers: []string{dnsAddr}, ok: false},
+		{url: "http://fake.example:" + port + "/foo", ipVersion: "auto", dnsServers: []string{dnsAddr}, ok: true},
+		{url: "http://fake.example:" + port + "/foo", ipVersion: "6", resolveTo: map[string]string{"fake.example": "127.0.0.1"}, ok: false},
+		{url: "ftp://fake.example:" + ftpport + "/foo", ipVersion: "4", dnsServers: []string{dnsAddr}, ok: true},
+		{url: "ftp://fake.example:" + ftpport + "/foo", ipVersion: "6", dnsServers: []string{dnsAddr}, ok: false},
+	} {
+		g := &Getter{
+			URL:            trial.url,
+			Output:         filepath.Join(t.TempDir(), "foo"),
+			IPVersion:      trial.ipVersion,
+			ResolveTo:      trial.resolveTo,
+			DNSServers:     trial.dnsServers,
+			ConnectTimeout: "2s",
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		err := g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%s IPVersion %q: %s", trial.url, trial.ipVersion, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s IPVersion %q: expected error", trial.url, trial.ipVersion)
+		}
+	}
+
+	g := &Getter{URL: srv.URL, Output: filepath.Join(t.TempDir(), "foo"), IPVersion: "ipv4"}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for invalid IPVersion")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Host + req.URL.Path + "\n"))
+	}))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	g := &Getter{
+		URL:        "http://localhost/metrics",
+		Output:     filepath.Join(t.TempDir(), "metrics"),
+		UnixSocket: sock,
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "localhost/metrics\n" {
+		t.Errorf("output %q, %v", buf, err)
+	}
+
+	for _, bad := range []*Getter{
+		{URL: "ftp://localhost/foo", UnixSocket: sock},
+		{URL: "http://localhost/foo", UnixSocket: sock, Proxy: "http://proxy.example"},
+		{URL: "https://localhost/foo", UnixSocket: sock, HTTPVersion: "3"},
+	} {
+		bad.Output = filepath.Join(t.TempDir(), "foo")
+		if err := bad.Setup(); err == nil || !strings.Contains(err.Error(), "UnixSocket") {
+			t.Errorf("%s: expected UnixSocket error, got %v", bad.URL, err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package getlatest
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the number of bytes available to unprivileged
+// users on the filesystem containing dir.
+func diskFree(dir string) (int64, error) {
+	var st unix.Statfs_t
+	err := unix.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.F_bavail) * uint64(st.F_bsize)), nil
+}
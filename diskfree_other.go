@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !openbsd && !netbsd && !solaris && !windows
+
+package getlatest
+
+import "errors"
+
+// diskFree is not implemented on this platform, so MinFreeSpace is
+// not checked (see checkFreeSpace).
+func diskFree(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,16 @@
+//go:build netbsd || solaris
+
+package getlatest
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the number of bytes available to unprivileged
+// users on the filesystem containing dir.
+func diskFree(dir string) (int64, error) {
+	var st unix.Statvfs_t
+	err := unix.Statvfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail * st.Frsize), nil
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package getlatest
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the number of bytes available to unprivileged
+// users on the filesystem containing dir.
+func diskFree(dir string) (int64, error) {
+	var st unix.Statfs_t
+	err := unix.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
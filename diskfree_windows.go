@@ -0,0 +1,18 @@
+package getlatest
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the number of bytes available to the current user
+// on the volume containing dir.
+func diskFree(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail, total, free uint64
+	err = windows.GetDiskFreeSpaceEx(path, &avail, &total, &free)
+	if err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
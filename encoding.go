@@ -0,0 +1,82 @@
+package getlatest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// parseConvertEncoding parses a ConvertEncoding value of the form
+// "from->to" or "from" (meaning "from->utf-8"), where from and to are
+// WHATWG encoding names or aliases, e.g., "windows-1252",
+// "iso-8859-1", "shift_jis", "utf-16le".
+func parseConvertEncoding(spec string) (from, to encoding.Encoding, toName string, err error) {
+	fromName, toName, ok := strings.Cut(spec, "->")
+	if !ok {
+		toName = "utf-8"
+	}
+	fromName, toName = strings.TrimSpace(fromName), strings.TrimSpace(toName)
+	from, err = htmlindex.Get(fromName)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid ConvertEncoding %q: unsupported encoding %q", spec, fromName)
+	}
+	to, err = htmlindex.Get(toName)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid ConvertEncoding %q: unsupported encoding %q", spec, toName)
+	}
+	return from, to, strings.ToLower(toName), nil
+}
+
+// encodingConverter returns a rewriteFunc that converts content
+// from one character encoding to another. Characters that cannot be
+// represented in the target encoding are an error.
+func encodingConverter(from, to encoding.Encoding) rewriteFunc {
+	return func(w io.Writer, src *os.File) error {
+		t := transform.Chain(from.NewDecoder(), to.NewEncoder())
+		_, err := io.Copy(w, transform.NewReader(src, t))
+		if err != nil {
+			return fmt.Errorf("ConvertEncoding: %s", err)
+		}
+		return nil
+	}
+}
+
+// lineEndingConverter returns a rewriteFunc that converts line endings
+// to "unix" (LF) or "dos" (CRLF) style.
+func lineEndingConverter(style string) (rewriteFunc, error) {
+	switch style {
+	case "unix", "dos":
+	default:
+		return nil, fmt.Errorf("invalid LineEndings %q (must be unix or dos)", style)
+	}
+	return func(w io.Writer, src *os.File) error {
+		r := bufio.NewReader(src)
+		bw := bufio.NewWriter(w)
+		prevCR := false
+		for {
+			c, err := r.ReadByte()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			switch {
+			case style == "unix" && c == '\r':
+				if next, err := r.Peek(1); err == nil && next[0] == '\n' {
+					continue
+				}
+			case style == "dos" && c == '\n' && !prevCR:
+				bw.WriteByte('\r')
+			}
+			bw.WriteByte(c)
+			prevCR = c == '\r'
+		}
+		return bw.Flush()
+	}, nil
+}
@@ -0,0 +1,64 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertEncoding(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		body        string
+		encoding    string
+		lineEndings string
+		expect      string
+		setupErr    bool
+	}{
+		{body: "caf\xe9,\x805\r\n", encoding: "windows-1252->utf-8", expect: "café,€5\r\n"},
+		{body: "caf\xe9\r\n", encoding: "iso-8859-1", lineEndings: "unix", expect: "café\n"},
+		{body: "café\n", encoding: "utf-8->windows-1252", lineEndings: "dos", expect: "caf\xe9\r\n"},
+		{body: "日本\n", encoding: "utf-8->windows-1252"},
+		{body: "a\r\nb\nc\rd\r\n", lineEndings: "unix", expect: "a\nb\nc\rd\n"},
+		{body: "a\r\nb\nc\n\n", lineEndings: "dos", expect: "a\r\nb\r\nc\r\n\r\n"},
+		{encoding: "klingon->utf-8", setupErr: true},
+		{encoding: "utf-8->utf-16le", lineEndings: "unix", setupErr: true},
+		{lineEndings: "mac", setupErr: true},
+	} {
+		body = trial.body
+		g := &Getter{
+			URL:             srv.URL,
+			Output:          filepath.Join(t.TempDir(), "foo"),
+			ConvertEncoding: trial.encoding,
+			LineEndings:     trial.lineEndings,
+		}
+		err := g.Setup()
+		if trial.setupErr {
+			if err == nil {
+				t.Errorf("%+v: expected Setup error", trial)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.expect {
+			t.Errorf("%+v: got %q, %v", trial, buf, err)
+		}
+	}
+}
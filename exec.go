@@ -0,0 +1,77 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// setupExec checks an exec: source, where the rest of the "URL" is
+// a shell command whose stdout is the content to save.
+func (g *Getter) setupExec(urlstr string) error {
+	if strings.TrimSpace(strings.TrimPrefix(urlstr, "exec:")) == "" {
+		return fmt.Errorf("exec URL %q must include a command", urlstr)
+	}
+	return nil
+}
+
+// fetchExec runs the command in an exec: URL using /bin/sh, and
+// writes its stdout to f. The command's stderr is passed through to
+// our own stderr. There is no way to tell whether the content has
+// changed, so the command runs every time the target is due; use
+// SkipUnchanged to avoid replacing the output file with identical
+// content.
+func (g *Getter) fetchExec(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	command := strings.TrimPrefix(srcurl, "exec:")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), "GETLATEST_OUTPUT="+g.Output)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	n, err := g.copyBody(f, stdout, 0)
+	if err != nil {
+		// Kill the command (e.g., MaximumSize exceeded)
+		// rather than waiting for it to finish.
+		cancel()
+		cmd.Wait()
+		return fetched{}, fmt.Errorf("running %q: %s", srcurl, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fetched{}, fmt.Errorf("running %q: %s", srcurl, err)
+	}
+	return fetched{size: n}, nil
+}
+
+// runPipeTo runs the PipeTo command using /bin/sh, with the
+// downloaded (and verified) content in tmpname on its stdin. It
+// returns an error if the command exits non-zero.
+func (g *Getter) runPipeTo(ctx context.Context, tmpname, url string) error {
+	f, err := os.Open(tmpname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", g.PipeTo)
+	cmd.Env = append(os.Environ(),
+		"GETLATEST_OUTPUT="+g.Output,
+		"GETLATEST_URL="+url)
+	cmd.Stdin = f
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 1000 {
+			msg = msg[:1000] + "..."
+		}
+		return fmt.Errorf("PipeTo command failed: %s: %q", err, msg)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	for _, trial := range []struct {
+		url     string
+		maxSize int64
+		expect  string
+		errstr  string
+	}{
+		{url: "exec:echo hello; echo ignored >&2", expect: "hello\n"},
+		{url: `exec:echo "$GETLATEST_OUTPUT"`, expect: "{output}\n"},
+		{url: "exec:echo partial; exit 3", errstr: "exit status 3"},
+		{url: "exec:yes", maxSize: 1000, errstr: "MaximumSize"},
+	} {
+		output := filepath.Join(t.TempDir(), "out")
+		expect := strings.Replace(trial.expect, "{output}", output, 1)
+		g := Getter{
+			URL:         trial.url,
+			Output:      output,
+			MaximumSize: trial.maxSize,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.errstr != "" {
+			if err == nil || !strings.Contains(err.Error(), trial.errstr) {
+				t.Errorf("%s: expected error containing %q, got %v", trial.url, trial.errstr, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %s", trial.url, err)
+			continue
+		}
+		if buf, err := ioutil.ReadFile(output); err != nil || string(buf) != expect {
+			t.Errorf("%s: output file: %q, %v", trial.url, buf, err)
+		}
+	}
+
+	g := Getter{URL: "exec: ", Output: filepath.Join(t.TempDir(), "out")}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for empty command")
+	}
+}
+
+func TestPipeTo(t *testing.T) {
+	for _, trial := range []struct {
+		url         string
+		pipeTo      string
+		minimumSize int64
+		expect      string
+		errstr      string
+	}{
+		{url: "exec:echo hello", pipeTo: `cat >"$GETLATEST_OUTPUT.piped"`, expect: "hello\n"},
+		{url: "exec:echo hello", pipeTo: "cat >/dev/null; echo no >&2; exit 4", errstr: `exit status 4: "no"`},
+		{url: "exec:echo hi", pipeTo: `cat >"$GETLATEST_OUTPUT.piped"`, minimumSize: 10, errstr: "MinimumSize"},
+	} {
+		output := filepath.Join(t.TempDir(), "out")
+		g := Getter{
+			URL:         trial.url,
+			Output:      output,
+			PipeTo:      trial.pipeTo,
+			MinimumSize: trial.minimumSize,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.errstr != "" {
+			if err == nil || !strings.Contains(err.Error(), trial.errstr) {
+				t.Errorf("%s: expected error containing %q, got %v", trial.pipeTo, trial.errstr, err)
+			}
+			if _, err := ioutil.ReadFile(output + ".piped"); err == nil {
+				t.Errorf("%s: command was run despite MinimumSize error", trial.pipeTo)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %s", trial.pipeTo, err)
+			continue
+		}
+		if buf, err := ioutil.ReadFile(output + ".piped"); err != nil || string(buf) != trial.expect {
+			t.Errorf("%s: piped content %q, %v", trial.pipeTo, buf, err)
+		}
+		if !g.haveOutput() {
+			t.Errorf("%s: haveOutput() false after successful pipe", trial.pipeTo)
+		}
+		if _, err := ioutil.ReadFile(output); err == nil {
+			t.Errorf("%s: output file was written", trial.pipeTo)
+		}
+	}
+
+	g := Getter{URL: "exec:echo hello", Output: filepath.Join(t.TempDir(), "out"), PipeTo: "cat", Unpack: true}
+	if err := g.Setup(); err == nil {
+		t.Error("expected Setup error for PipeTo with Unpack")
+	}
+}
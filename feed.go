@@ -0,0 +1,94 @@
+package getlatest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// feed is enough of an RSS 2.0 or Atom document to find the newest
+// entry's link.
+type feed struct {
+	XMLName xml.Name
+	Items   []feedEntry `xml:"channel>item"` // RSS
+	Entries []feedEntry `xml:"entry"`        // Atom
+}
+
+type feedEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"` // Atom
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"` // RSS
+	} `xml:"link"`
+	Enclosures []struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"` // RSS
+	PubDate   string `xml:"pubDate"`   // RSS
+	Updated   string `xml:"updated"`   // Atom
+	Published string `xml:"published"` // Atom
+}
+
+// link returns the entry's enclosure URL if it has one, otherwise
+// its main link.
+func (e feedEntry) link() string {
+	for _, enc := range e.Enclosures {
+		if enc.URL != "" {
+			return enc.URL
+		}
+	}
+	for _, l := range e.Links {
+		if l.Rel == "enclosure" && l.Href != "" {
+			return l.Href
+		}
+	}
+	for _, l := range e.Links {
+		if (l.Rel == "" || l.Rel == "alternate") && l.Href != "" {
+			return l.Href
+		}
+		if s := strings.TrimSpace(l.Text); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// time returns the entry's publication/update time, or the zero time
+// if none can be parsed.
+func (e feedEntry) time() time.Time {
+	for _, s := range []string{e.Updated, e.Published, e.PubDate} {
+		s = strings.TrimSpace(s)
+		for _, layout := range []string{time.RFC3339, time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// feedLink returns the link of the newest entry (with a link) in the
+// given RSS or Atom feed. Entries without dates are considered older
+// than entries with dates; among those, the first one wins.
+func feedLink(buf []byte) (string, error) {
+	var f feed
+	err := xml.Unmarshal(buf, &f)
+	if err != nil {
+		return "", fmt.Errorf("error parsing feed: %s", err)
+	}
+	var best string
+	var bestTime time.Time
+	for _, e := range append(f.Items, f.Entries...) {
+		link := e.link()
+		if link == "" {
+			continue
+		}
+		if t := e.time(); best == "" || t.After(bestTime) {
+			best, bestTime = link, t
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no entries with links in %s feed", f.XMLName.Local)
+	}
+	return best, nil
+}
@@ -0,0 +1,73 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeedLink(t *testing.T) {
+	for _, trial := range []struct {
+		feed   string
+		expect string
+	}{
+		{`<rss version="2.0"><channel>
+<item><title>old</title><link>https://example.com/old</link><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>
+<item><title>new</title><link>https://example.com/new</link><enclosure url="https://example.com/new.mp3" type="audio/mpeg" length="1"/><pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate></item>
+</channel></rss>`, "https://example.com/new.mp3"},
+		{`<rss version="2.0"><channel>
+<item><link>https://example.com/first</link></item>
+<item><link>https://example.com/second</link></item>
+</channel></rss>`, "https://example.com/first"},
+		{`<feed xmlns="http://www.w3.org/2005/Atom">
+<entry><link rel="alternate" href="https://example.com/a"/><updated>2024-01-01T00:00:00Z</updated></entry>
+<entry><link rel="alternate" href="https://example.com/b"/><link rel="enclosure" href="https://example.com/b.tgz"/><updated>2024-03-01T00:00:00Z</updated></entry>
+<entry><link href="https://example.com/c"/><updated>2024-02-01T00:00:00Z</updated></entry>
+</feed>`, "https://example.com/b.tgz"},
+		{`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`, ""},
+		{`not xml`, ""},
+	} {
+		link, err := feedLink([]byte(trial.feed))
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("expected error, got %q from %s", link, trial.feed)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", trial.feed, err)
+		} else if link != trial.expect {
+			t.Errorf("got %q, expected %q", link, trial.expect)
+		}
+	}
+}
+
+func TestIndexFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/feed.xml":
+			w.Write([]byte(`<rss version="2.0"><channel><item><enclosure url="/files/episode-2.mp3"/></item></channel></rss>`))
+		default:
+			w.Write([]byte("content of " + req.URL.Path))
+		}
+	}))
+	defer srv.Close()
+	g := &Getter{
+		Output:    filepath.Join(t.TempDir(), "latest.mp3"),
+		IndexURL:  srv.URL + "/feed.xml",
+		IndexFeed: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadFile(g.Output)
+	if string(buf) != "content of /files/episode-2.mp3" {
+		t.Errorf("got %q", buf)
+	}
+}
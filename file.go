@@ -0,0 +1,110 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// setupFile checks the configuration for a file:// URL.
+func (g *Getter) setupFile(u *url.URL) error {
+	if u.Host != "" && u.Host != "localhost" {
+		return fmt.Errorf("file URL %q must refer to a local file (file:///path)", u.Redacted())
+	}
+	if u.Path == "" {
+		return fmt.Errorf("file URL %q must include a file path", u.Redacted())
+	}
+	switch g.CopyMode {
+	case "", "copy", "reflink":
+	case "hardlink":
+		if g.FileMode != 0 || g.Owner != "" || g.Group != "" {
+			return fmt.Errorf("cannot use FileMode, Owner, or Group with CopyMode %q", g.CopyMode)
+		}
+	default:
+		return fmt.Errorf("invalid CopyMode %q (must be copy, hardlink, or reflink)", g.CopyMode)
+	}
+	return nil
+}
+
+// fetchFile copies a local file to f, or (depending on CopyMode)
+// replaces f with a hard link to it, or clones it into f using a
+// reflink. If linking or cloning fails (e.g., because the source is
+// on a different filesystem), it falls back to copying.
+func (g *Getter) fetchFile(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	u, err := url.Parse(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	src, err := os.Open(u.Path)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	} else if !fi.Mode().IsRegular() {
+		return fetched{}, fmt.Errorf("%q: not a regular file", srcurl)
+	}
+	// Like SFTP, we use the size and modification time of the
+	// source file as an ETag.
+	result := fetched{
+		size:    fi.Size(),
+		etag:    fmt.Sprintf("%d-%d", fi.Size(), fi.ModTime().UnixNano()),
+		modtime: fi.ModTime().UTC().Format(http.TimeFormat),
+	}
+	if g.haveOutput() && result.etag == g.etag {
+		return fetched{}, errNotModified
+	}
+	if err := g.checkMaximumSize(fi.Size()); err != nil {
+		return fetched{}, err
+	}
+
+	switch g.CopyMode {
+	case "hardlink":
+		// Link to a new name and rename it over the tempfile,
+		// so f is still usable for copying if this fails.
+		tmplink := f.Name() + ".link"
+		err = os.Link(u.Path, tmplink)
+		if err == nil {
+			err = os.Rename(tmplink, f.Name())
+			if err != nil {
+				os.Remove(tmplink)
+			}
+		}
+		if err == nil {
+			result.linked = true
+			return result, nil
+		}
+		g.logger().Info("cannot hardlink, copying instead", "url", srcurl, "error", err)
+	case "reflink":
+		err = reflink(f, src)
+		if err == nil {
+			return result, nil
+		}
+		g.logger().Info("cannot reflink, copying instead", "url", srcurl, "error", err)
+	}
+
+	if err := g.checkFreeSpace(fi.Size()); err != nil {
+		return fetched{}, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Abort the copy if ctx is done (e.g.,
+		// DownloadTimeout is reached).
+		select {
+		case <-ctx.Done():
+			src.Close()
+		case <-done:
+		}
+	}()
+	n, err := g.copyBody(f, src, 0)
+	if err != nil {
+		return fetched{}, fmt.Errorf("copying %q to tempfile: %s", srcurl, err)
+	}
+	result.size = n
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	for _, mode := range []string{"", "copy", "hardlink", "reflink"} {
+		dir := t.TempDir()
+		srcpath := filepath.Join(dir, "src.txt")
+		err := ioutil.WriteFile(srcpath, []byte("hello\n"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := Getter{
+			URL:      "file://" + srcpath,
+			Output:   filepath.Join(dir, "out.txt"),
+			CopyMode: mode,
+		}
+		err = g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err = g.trydownload(context.Background())
+			if err != nil {
+				t.Fatalf("CopyMode %q: %s", mode, err)
+			}
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+			t.Errorf("CopyMode %q: output file: %q, %v", mode, buf, err)
+		}
+		if g.updates != 1 {
+			t.Errorf("CopyMode %q: expected 1 update (second attempt should be not-modified), got %d", mode, g.updates)
+		}
+		srcfi, err := os.Stat(srcpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outfi, err := os.Stat(g.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked := os.SameFile(srcfi, outfi); linked != (mode == "hardlink") {
+			t.Errorf("CopyMode %q: output is hardlink = %v", mode, linked)
+		}
+		if srcfi.Mode().Perm() != 0600 {
+			t.Errorf("CopyMode %q: source file mode changed to %o", mode, srcfi.Mode().Perm())
+		}
+
+		// Replacing the source file should trigger an update.
+		err = ioutil.WriteFile(srcpath+".new", []byte("world\n"), 0600)
+		if err == nil {
+			err = os.Chtimes(srcpath+".new", time.Now(), time.Now().Add(time.Hour))
+		}
+		if err == nil {
+			err = os.Rename(srcpath+".new", srcpath)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "world\n" {
+			t.Errorf("CopyMode %q: output file after update: %q, %v", mode, buf, err)
+		}
+	}
+
+	for _, g := range []*Getter{
+		{URL: "file://remotehost/tmp/foo", Output: "/tmp/foo"},
+		{URL: "file:///tmp/foo", Output: "/tmp/bar", CopyMode: "symlink"},
+		{URL: "file:///tmp/foo", Output: "/tmp/bar", CopyMode: "hardlink", FileMode: 0644},
+	} {
+		if err := g.Setup(); err == nil {
+			t.Errorf("%s %q: expected Setup error", g.URL, g.CopyMode)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package getlatest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fileTypes lists the magic numbers accepted for each ExpectFileType
+// value, and the offset where each one appears.
+var fileTypes = map[string][]struct {
+	offset int
+	magic  []byte
+}{
+	"7z":      {{0, []byte("7z\xbc\xaf\x27\x1c")}},
+	"bzip2":   {{0, bzip2Magic}},
+	"elf":     {{0, []byte("\x7fELF")}},
+	"gif":     {{0, []byte("GIF87a")}, {0, []byte("GIF89a")}},
+	"gzip":    {{0, gzipMagic}},
+	"jpeg":    {{0, []byte{0xff, 0xd8, 0xff}}},
+	"parquet": {{0, []byte("PAR1")}},
+	"pdf":     {{0, []byte("%PDF-")}},
+	"png":     {{0, []byte("\x89PNG\r\n\x1a\n")}},
+	"sqlite":  {{0, []byte("SQLite format 3\x00")}},
+	"tar":     {{257, []byte("ustar")}},
+	"xz":      {{0, []byte("\xfd7zXZ\x00")}},
+	"zip":     {{0, zipMagic}, {0, []byte("PK\x05\x06")}}, // empty archive
+	"zstd":    {{0, zstdMagic}},
+}
+
+// fileTypeNames returns the supported ExpectFileType values, sorted.
+func fileTypeNames() string {
+	var names []string
+	for name := range fileTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// checkFileType returns an error if the named file does not start
+// with a magic number for ExpectFileType.
+func (g *Getter) checkFileType(name string) error {
+	if g.ExpectFileType == "" {
+		return nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	for _, m := range fileTypes[g.ExpectFileType] {
+		if len(head) >= m.offset && bytes.HasPrefix(head[m.offset:], m.magic) {
+			return nil
+		}
+	}
+	return fmt.Errorf("content is not a %s file (starts with %q)", g.ExpectFileType, head[:min(len(head), 16)])
+}
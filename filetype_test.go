@@ -0,0 +1,75 @@
+package getlatest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpectFileType(t *testing.T) {
+	var tarbuf bytes.Buffer
+	tw := tar.NewWriter(&tarbuf)
+	tw.WriteHeader(&tar.Header{Name: "foo", Mode: 0644, Size: 3})
+	tw.Write([]byte("foo"))
+	tw.Close()
+	html := []byte("<!DOCTYPE html><html><body>Service Unavailable</body></html>")
+
+	tmpdir := t.TempDir()
+	for _, trial := range []struct {
+		filetype string
+		content  []byte
+		ok       bool
+	}{
+		{"zip", []byte("PK\x03\x04\x14\x00\x00\x00"), true},
+		{"zip", []byte("PK\x05\x06" + strings.Repeat("\x00", 18)), true},
+		{"zip", html, false},
+		{"gzip", []byte{0x1f, 0x8b, 8, 0}, true},
+		{"gzip", []byte{0x1f}, false},
+		{"pdf", []byte("%PDF-1.7\n"), true},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), true},
+		{"png", html, false},
+		{"tar", tarbuf.Bytes(), true},
+		{"tar", html, false},
+		{"sqlite", []byte("SQLite format 3\x00\x10\x00"), true},
+		{"jpeg", []byte{}, false},
+	} {
+		name := filepath.Join(tmpdir, "tmp")
+		if err := ioutil.WriteFile(name, trial.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		g := &Getter{ExpectFileType: trial.filetype}
+		err := g.checkFileType(name)
+		if trial.ok && err != nil {
+			t.Errorf("%s %q: %s", trial.filetype, trial.content, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s %q: expected error", trial.filetype, trial.content)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(html)
+	}))
+	defer srv.Close()
+	g := &Getter{
+		URL:            srv.URL + "/data.zip",
+		Output:         filepath.Join(tmpdir, "data.zip"),
+		ExpectFileType: "zip",
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err == nil || !strings.Contains(err.Error(), "not a zip file") {
+		t.Errorf("expected file type error, got %v", err)
+	}
+
+	g.ExpectFileType = "docx"
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for unsupported ExpectFileType")
+	}
+}
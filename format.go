@@ -0,0 +1,118 @@
+package getlatest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// formatCheckers parse content in each ValidateFormat, returning an
+// error if it is not well-formed. JSON, XML, and CSV content is
+// parsed as a stream, so large files are not loaded into memory.
+// YAML documents are loaded one at a time.
+var formatCheckers = map[string]func(io.Reader) error{
+	"json": checkJSON,
+	"yaml": checkYAML,
+	"xml":  checkXML,
+	"csv":  checkCSV,
+}
+
+// checkFormat returns an error if the named file is not well-formed
+// according to ValidateFormat.
+func (g *Getter) checkFormat(name string) error {
+	if g.ValidateFormat == "" {
+		return nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = formatCheckers[g.ValidateFormat](bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("content is not valid %s: %s", g.ValidateFormat, err)
+	}
+	return nil
+}
+
+var errNoContent = errors.New("no content")
+
+func checkJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	depth := 0
+	for n := 0; ; n++ {
+		tok, err := dec.Token()
+		if err == io.EOF && n == 0 {
+			return errNoContent
+		} else if err == io.EOF && depth > 0 {
+			// Token() doesn't report truncated
+			// objects/arrays as errors.
+			return io.ErrUnexpectedEOF
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+func checkYAML(r io.Reader) error {
+	dec := yaml3.NewDecoder(r)
+	for n := 0; ; n++ {
+		var doc yaml3.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF && n == 0 {
+			return errNoContent
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func checkXML(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	root := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && !root {
+			return fmt.Errorf("no root element")
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			root = true
+		}
+	}
+}
+
+func checkCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	for n := 0; ; n++ {
+		_, err := cr.Read()
+		if err == io.EOF && n == 0 {
+			return errNoContent
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
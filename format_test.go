@@ -0,0 +1,85 @@
+package getlatest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCheckers(t *testing.T) {
+	for _, trial := range []struct {
+		format  string
+		content string
+		ok      bool
+	}{
+		{"json", `{"a": [1, 2, {"b": null}]}`, true},
+		{"json", "{\"a\": 1}\n{\"a\": 2}\n", true},
+		{"json", `{"a": [1, 2, {"b": null}`, false},
+		{"json", `<html><body>502 Bad Gateway</body></html>`, false},
+		{"json", ``, false},
+		{"yaml", "a: 1\nb: [2, 3]\n", true},
+		{"yaml", "a: 1\n---\nb: 2\n", true},
+		{"yaml", "a: [1, 2\n", false},
+		{"yaml", "a: 1\n  b: 2\n", false},
+		{"yaml", "", false},
+		{"xml", `<?xml version="1.0"?><a><b x="1">text</b></a>`, true},
+		{"xml", `<a><b></a>`, false},
+		{"xml", `<a><b>`, false},
+		{"xml", `<html><head><meta charset="utf-8"></head></html>`, false},
+		{"xml", `just text`, false},
+		{"csv", "id,name\n1,foo\n2,\"bar, baz\"\n", true},
+		{"csv", "id,name\n1,foo,extra\n", false},
+		{"csv", "id,name\n1,\"foo\n", false},
+		{"csv", "", false},
+	} {
+		err := formatCheckers[trial.format](strings.NewReader(trial.content))
+		if trial.ok && err != nil {
+			t.Errorf("%s %q: %s", trial.format, trial.content, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s %q: expected error", trial.format, trial.content)
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/good.json" {
+			w.Write([]byte(`{"ok": true}`))
+		} else {
+			w.Write([]byte(`{"ok": tru`))
+		}
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:            srv.URL + "/good.json",
+		Output:         filepath.Join(tmpdir, "out.json"),
+		ValidateFormat: "json",
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	g.URL = srv.URL + "/truncated.json"
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err == nil || !strings.Contains(err.Error(), "not valid json") {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if buf, err := os.ReadFile(g.Output); err != nil || string(buf) != `{"ok": true}` {
+		t.Errorf("output file was replaced: %q, %v", buf, err)
+	}
+
+	g.ValidateFormat = "toml"
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for unsupported ValidateFormat")
+	}
+}
@@ -0,0 +1,97 @@
+package getlatest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// freshnessLayouts are the timestamp formats accepted in content
+// matched by FreshnessRegex, in addition to Unix timestamps.
+// Timestamps without a time zone are interpreted in Timezone.
+var freshnessLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// setupFreshness checks FreshnessRegex and FreshnessMaxAge.
+func (g *Getter) setupFreshness() error {
+	g.freshnessRx, g.freshnessMaxAge = nil, 0
+	if g.FreshnessRegex == "" && g.FreshnessMaxAge == "" {
+		return nil
+	} else if g.FreshnessRegex == "" || g.FreshnessMaxAge == "" {
+		return fmt.Errorf("FreshnessRegex and FreshnessMaxAge must be used together")
+	}
+	rx, err := regexp.Compile(g.FreshnessRegex)
+	if err != nil {
+		return fmt.Errorf("invalid FreshnessRegex %q: %s", g.FreshnessRegex, err)
+	} else if rx.NumSubexp() > 1 {
+		return fmt.Errorf("invalid FreshnessRegex %q: more than one capture group", g.FreshnessRegex)
+	}
+	d, err := time.ParseDuration(g.FreshnessMaxAge)
+	if err != nil {
+		return fmt.Errorf("error parsing FreshnessMaxAge value %q: %s", g.FreshnessMaxAge, err)
+	} else if d <= 0 {
+		return fmt.Errorf("FreshnessMaxAge value %q must be positive", g.FreshnessMaxAge)
+	}
+	g.freshnessRx, g.freshnessMaxAge = rx, d
+	return nil
+}
+
+// parseFreshnessTime parses a timestamp found by FreshnessRegex.
+func parseFreshnessTime(s string, loc *time.Location) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	for _, layout := range freshnessLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse timestamp %q", s)
+}
+
+// checkFreshness returns an error if FreshnessRegex is set and the
+// timestamp it finds in the named file is older than
+// FreshnessMaxAge. Like MustMatch, only the first MatchLimit bytes
+// are searched.
+func (g *Getter) checkFreshness(name string) error {
+	if g.freshnessRx == nil {
+		return nil
+	}
+	limit := g.MatchLimit
+	if limit == 0 {
+		limit = 1 << 24
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf, err := io.ReadAll(bufio.NewReader(io.LimitReader(f, limit)))
+	if err != nil {
+		return err
+	}
+	m := g.freshnessRx.FindSubmatch(buf)
+	if m == nil {
+		return fmt.Errorf("output does not match FreshnessRegex %q", g.freshnessRx)
+	}
+	ts := m[len(m)-1]
+	t, err := parseFreshnessTime(string(ts), g.location())
+	if err != nil {
+		return fmt.Errorf("FreshnessRegex: %s", err)
+	}
+	if age := time.Since(t); age > g.freshnessMaxAge {
+		return fmt.Errorf("content is stale: timestamp %s is %s old, more than FreshnessMaxAge %s", t.Format(time.RFC3339), age.Round(time.Second), g.freshnessMaxAge)
+	}
+	return nil
+}
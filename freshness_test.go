@@ -0,0 +1,95 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFreshnessTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, trial := range []struct {
+		in     string
+		expect time.Time
+	}{
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02T03:04:05.5+01:00", time.Date(2024, 1, 2, 2, 4, 5, 5e8, time.UTC)},
+		{"2024-01-02T03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, loc)},
+		{"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, loc)},
+		{"2024-01-02 03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, loc)},
+		{"Tue, 02 Jan 2024 03:04:05 GMT", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"1704164645", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+	} {
+		got, err := parseFreshnessTime(trial.in, loc)
+		if trial.expect.IsZero() {
+			if err == nil {
+				t.Errorf("%q: expected error, got %s", trial.in, got)
+			}
+		} else if err != nil {
+			t.Errorf("%q: %s", trial.in, err)
+		} else if !got.Equal(trial.expect) {
+			t.Errorf("%q: expected %s, got %s", trial.in, trial.expect, got)
+		}
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		body     string
+		regex    string
+		maxAge   string
+		setupErr bool
+		ok       bool
+	}{
+		{body: fmt.Sprintf(`{"generated_at": "%s"}`, time.Now().Add(-time.Hour).Format(time.RFC3339)), regex: `"generated_at": "([^"]+)"`, maxAge: "2h", ok: true},
+		{body: fmt.Sprintf(`{"generated_at": "%s"}`, time.Now().Add(-3*time.Hour).Format(time.RFC3339)), regex: `"generated_at": "([^"]+)"`, maxAge: "2h"},
+		{body: fmt.Sprintf("# exported %d\n", time.Now().Unix()), regex: `exported \d+`, maxAge: "2h"},
+		{body: fmt.Sprintf("# exported %d\n", time.Now().Unix()), regex: `exported (\d+)`, maxAge: "2h", ok: true},
+		{body: `{"generated_at": "soon"}`, regex: `"generated_at": "([^"]+)"`, maxAge: "2h"},
+		{body: `{}`, regex: `"generated_at": "([^"]+)"`, maxAge: "2h"},
+		{regex: `"generated_at": "([^"]+)"`, setupErr: true},
+		{maxAge: "2h", setupErr: true},
+		{regex: `(\d+)-(\d+)`, maxAge: "2h", setupErr: true},
+		{regex: `(\d+)`, maxAge: "-2h", setupErr: true},
+	} {
+		body = trial.body
+		g := &Getter{
+			URL:             srv.URL,
+			Output:          filepath.Join(t.TempDir(), "foo"),
+			FreshnessRegex:  trial.regex,
+			FreshnessMaxAge: trial.maxAge,
+		}
+		err := g.Setup()
+		if trial.setupErr {
+			if err == nil {
+				t.Errorf("%+v: expected Setup error", trial)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%+v: expected error", trial)
+		} else if !trial.ok && g.haveOutput() {
+			t.Errorf("%+v: output file was written despite error", trial)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package getlatest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// setupFTP checks the FTP-specific configuration.
+func (g *Getter) setupFTP(u *url.URL) error {
+	if u.Path == "" || u.Path == "/" {
+		return fmt.Errorf("%s URL %q must include a file path", u.Scheme, u.Redacted())
+	}
+	return nil
+}
+
+// ftpLogin returns the username and password for u: Username and
+// Password if configured, otherwise the credentials in the URL,
+// otherwise the NetrcFile entry for the host, otherwise anonymous.
+func (g *Getter) ftpLogin(u *url.URL) (string, string, error) {
+	if g.Username != "" {
+		return g.Username, g.Password, nil
+	}
+	if u.User != nil {
+		pw, _ := u.User.Password()
+		return u.User.Username(), pw, nil
+	}
+	netrc, err := g.netrcLogin(u.Hostname())
+	if err != nil {
+		return "", "", err
+	} else if netrc != nil {
+		return netrc.login, netrc.password, nil
+	}
+	return "anonymous", "anonymous", nil
+}
+
+// fetchFTP downloads an ftp:// or ftps:// URL using a passive-mode
+// transfer. ftps:// uses explicit TLS (AUTH TLS) on port 21, or
+// implicit TLS if the URL specifies port 990.
+func (g *Getter) fetchFTP(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	u, err := url.Parse(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "21"
+	}
+	opts := []ftp.DialOption{
+		ftp.DialWithContext(ctx),
+		ftp.DialWithDialer(net.Dialer{Timeout: g.connectTimeout}),
+	}
+	if u.Scheme == "ftps" {
+		cfg := &tls.Config{}
+		if g.tlsConfig != nil {
+			cfg = g.tlsConfig.Clone()
+		}
+		cfg.ServerName = u.Hostname()
+		// Many servers require the data connection to resume
+		// the control connection's TLS session.
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		if port == "990" {
+			opts = append(opts, ftp.DialWithTLS(cfg))
+		} else {
+			opts = append(opts, ftp.DialWithExplicitTLS(cfg))
+		}
+	}
+	user, password, err := g.ftpLogin(u)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	if g.dialOverrides() {
+		// ftp.DialWithDialFunc would also be used for data
+		// connections, bypassing TLS, so we resolve the
+		// address here instead.
+		addr, err = g.lookupAddr(ctx, addr)
+		if err != nil {
+			return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+		}
+	}
+	conn, err := ftp.Dial(addr, opts...)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer conn.Quit()
+	if err := conn.Login(user, password); err != nil {
+		return fetched{}, fmt.Errorf("%q: login failed: %s", srcurl, err)
+	}
+
+	// FTP has no ETag, so we use the size and MDTM modification
+	// time of the remote file instead. If the server doesn't
+	// support MDTM, we download every time.
+	size, err := conn.FileSize(u.Path)
+	if err != nil {
+		size = -1
+	}
+	var etag, modtime string
+	if mtime, err := conn.GetTime(u.Path); err == nil {
+		etag = fmt.Sprintf("%d-%d", size, mtime.UnixNano())
+		modtime = mtime.UTC().Format(http.TimeFormat)
+		if g.haveOutput() && etag == g.etag {
+			return fetched{}, errNotModified
+		}
+	}
+	if size >= 0 {
+		if err := g.checkMaximumSize(size); err != nil {
+			return fetched{}, err
+		}
+		if err := g.checkFreeSpace(size); err != nil {
+			return fetched{}, err
+		}
+	}
+
+	src, err := conn.Retr(u.Path)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer src.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Abort the transfer if ctx is done (e.g.,
+		// DownloadTimeout is reached).
+		select {
+		case <-ctx.Done():
+			src.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	n, err := g.copyBody(f, src, 0)
+	if err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", srcurl, err)
+	}
+	if err := src.Close(); err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", srcurl, err)
+	}
+	return fetched{
+		size:    n,
+		etag:    etag,
+		modtime: modtime,
+	}, nil
+}
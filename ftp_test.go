@@ -0,0 +1,172 @@
+package getlatest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ftpTestServer is a minimal passive-mode FTP server that serves
+// files from a map.
+type ftpTestServer struct {
+	ln    net.Listener
+	files map[string]string
+	mtx   sync.Mutex
+	users []string
+	retrs int
+}
+
+func newFTPTestServer(t *testing.T, files map[string]string) *ftpTestServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &ftpTestServer{ln: ln, files: files}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return srv
+}
+
+func (srv *ftpTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	reply("220 ready")
+	var pasv net.Listener
+	defer func() {
+		if pasv != nil {
+			pasv.Close()
+		}
+	}()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			srv.mtx.Lock()
+			srv.users = append(srv.users, arg)
+			srv.mtx.Unlock()
+			reply("331 password please")
+		case "PASS":
+			reply("230 logged in")
+		case "FEAT":
+			reply("211-Features:\r\n MDTM\r\n SIZE\r\n UTF8\r\n211 End")
+		case "TYPE", "OPTS":
+			reply("200 ok")
+		case "EPSV":
+			if pasv == nil {
+				pasv, err = net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					reply("425 %s", err)
+					continue
+				}
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", pasv.Addr().(*net.TCPAddr).Port)
+		case "SIZE", "MDTM", "RETR":
+			data, ok := srv.files[arg]
+			if !ok {
+				reply("550 not found")
+				continue
+			}
+			if cmd == "SIZE" {
+				reply("213 %d", len(data))
+				continue
+			} else if cmd == "MDTM" {
+				reply("213 20240102030405")
+				continue
+			}
+			srv.mtx.Lock()
+			srv.retrs++
+			srv.mtx.Unlock()
+			dconn, err := pasv.Accept()
+			if err != nil {
+				reply("425 %s", err)
+				continue
+			}
+			reply("150 sending")
+			dconn.Write([]byte(data))
+			dconn.Close()
+			reply("226 done")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTP(t *testing.T) {
+	srv := newFTPTestServer(t, map[string]string{"/outgoing/foo.txt": "hello\n"})
+	for _, trial := range []struct {
+		url      string
+		username string
+		password string
+		expect   string
+	}{
+		{url: "ftp://%s/outgoing/foo.txt", expect: "anonymous"},
+		{url: "ftp://urluser:urlpw@%s/outgoing/foo.txt", expect: "urluser"},
+		{url: "ftp://urluser@%s/outgoing/foo.txt", username: "cfguser", password: "cfgpw", expect: "cfguser"},
+	} {
+		srv.mtx.Lock()
+		srv.users, srv.retrs = nil, 0
+		srv.mtx.Unlock()
+		g := Getter{
+			URL:      fmt.Sprintf(trial.url, srv.ln.Addr()),
+			Output:   filepath.Join(t.TempDir(), "foo"),
+			Username: trial.username,
+			Password: trial.password,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err = g.trydownload(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+			t.Errorf("output file: %q, %v", buf, err)
+		}
+		srv.mtx.Lock()
+		if srv.retrs != 1 {
+			t.Errorf("%s: expected 1 RETR (second attempt should be not-modified), got %d", g.URL, srv.retrs)
+		}
+		if len(srv.users) != 2 || srv.users[0] != trial.expect {
+			t.Errorf("%s: expected login as %q, got %q", g.URL, trial.expect, srv.users)
+		}
+		srv.mtx.Unlock()
+	}
+
+	g := Getter{
+		URL:    fmt.Sprintf("ftp://%s/missing.txt", srv.ln.Addr()),
+		Output: filepath.Join(t.TempDir(), "missing"),
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
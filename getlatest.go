@@ -1,177 +1,1019 @@
-// Install:
+// Package getlatest keeps local copies of remote files up to date.
 //
-//	go get github.com/tomclegg/getlatest
+// Each Getter downloads a URL to an output file, according to a
+// schedule (TTL, time window, weekdays), and replaces the output file
+// atomically only after the download succeeds and passes the
+// configured checks. A Manager runs a set of Getters.
 //
-// systemd:
+// Typical use:
 //
-//	install $(go env GOPATH)/bin/getlatest /usr/bin/
-//	getlatest -install-service
+//	getters, err := getlatest.LoadConfig("/etc/getlatest.yaml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	var mgr getlatest.Manager
+//	mgr.Start(getters)
 //
-// Standalone:
-//
-//	getlatest &
-//
-// Config:
-//
-//	# /etc/getlatest.yaml
-//	/tmp/example.html:
-//	  URL: "https://host.example/source/example?t={{.time.Format \"2016-01-02T15:04.05\"}}.html"
-//	  NotBefore: 6:00
-//	  NotAfter: 13:00
-//	  Weekdays: mon tue wed thu fri
-//	  MinimumSize: 14000000
-//	  TTL: 12h
-//
-package main
+// See the getlatest command for config file documentation.
+package getlatest
 
 import (
+	"bufio"
 	"bytes"
-	"flag"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/ghodss/yaml"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/andybalholm/cascadia"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/ssh"
 )
 
-type getter struct {
+// A Getter keeps a single output file up to date. The exported
+// fields are its configuration, which is normally loaded from a YAML
+// config file by LoadConfig.
+type Getter struct {
 	URL         string
+	URLs        []string // mirrors, tried in order after URL fails
 	Output      string
 	NotBefore   string
-	NotAfter    string
+	NotAfter    string   // may be earlier than NotBefore, to span midnight
+	Windows     []string // alternative to NotBefore/NotAfter, e.g., ["06:00-08:00", "22:00-02:00"]
 	Weekdays    string
+	DaysOfMonth string // e.g., "1 15", "1-7", or "last"
+	Months      string // e.g., "jan apr jul oct" or "1-6"
 	MinimumSize int64
-	TTL         string
+	MaximumSize int64 // abort downloads larger than this
+
+	MinFreeSpace     int64 // fail if downloading would leave less free disk space than this
+	RandomizeMirrors bool  // try mirrors in random order
+	Priority         int   // higher priority downloads go first when concurrency is limited
+	TTL              string
+	AlignTo          string // round TTL to wall clock boundaries: "hour", "day", or a duration like "15m"
+	Resume           bool   // resume interrupted http(s) downloads
+	Chunks           int    // download large http(s) files using this many concurrent Range requests
+	HedgeAfter       string // also start the next mirror if there's no response header within this time
+	Schedule         string // cron expression, alternative to TTL
+	Once             bool   // stop scheduling after the first success (or if Output already exists)
+	Disabled         bool   // don't schedule downloads (see also Manager.Pause)
+	Splay            string // max random delay after TTL/Schedule, stable per host and target
+	CheckInterval    string // max time between schedule checks (default 1h)
+	Timezone         string // for NotBefore/NotAfter/Weekdays/DaysOfMonth/Months/Schedule/SkipDates (default local)
+	SHA256           string
+	ChecksumURL      string
+	OnSuccess        string
+	OnFailure        string
+	FailureThreshold int // consecutive failures before running OnFailure (default 1)
+	ValidateCommand  string
+	PipeTo           string // shell command that reads the content on stdin, instead of writing the output file
+	TempDir          string
+	KeepVersions     int  // archive previous versions as Output.YYYYMMDDTHHMMSS
+	Versioned        bool // write versions to Output.d/YYYYMMDDTHHMMSS.NNNNNNNNN; Output is a symlink to the current one
+	SkipUnchanged    bool // leave output file untouched if content is identical
+	RequireChange    bool // fail if content is not modified or identical
+	PreserveModTime  bool // set output mtime to upstream Last-Modified time
+	NoSync           bool // skip fsync of tempfile and directory (faster, not crash-safe)
+	WriteMetadata    bool // write source URL, ETag, SHA256, etc. to Output.meta.json
+
+	// Dates (YYYY-MM-DD in Timezone) when no scheduled downloads
+	// are attempted, e.g., public holidays for a feed that is
+	// only published on business days
+	SkipDates        []string
+	SkipDatesFile    string   // one date per line
+	HolidayCalendars []string // iCalendar (.ics) URLs; days with events are skipped
+
+	// Output file permissions (default 0666 minus umask) and
+	// ownership (user/group names or numeric IDs)
+	FileMode os.FileMode
+	Owner    string
+	Group    string
+
+	// Additional paths where a copy of the output file is written
+	// (atomically, with the same mode, ownership, and mtime)
+	// after each update
+	AlsoWrite []string
+
+	// Webhook notifications (see Notify)
+	Notify *Notify
+
+	// After each update, reload (or restart) this systemd unit
+	// using the D-Bus API, and/or send a signal to a process
+	ReloadUnit    string
+	SignalProcess *SignalProcess
+
+	// Output files of other targets that must succeed before this
+	// one is attempted. When one of them is updated, this target
+	// is downloaded without waiting for its TTL/Schedule, as soon
+	// as its time windows and dates allow.
+	DependsOn []string
+
+	// Values available in URL templates (URL, URLs, ChecksumURL,
+	// SignatureURL, and IndexURL) as {{.name}}, normally set for
+	// each target by a "generate" section in the config file
+	Vars map[string]string
+
+	// Detached GPG signature (.asc or .sig), verified against
+	// the public keys in GPGKeyring and/or GPGKeyFile, or
+	// minisign/signify signature (.minisig or .sig), verified
+	// against the MinisignKey public key (e.g., "RWQf...")
+	SignatureURL string
+	GPGKeyring   string
+	GPGKeyFile   string
+	MinisignKey  string
+
+	// Decompress downloaded content before writing the output
+	// file: gzip, zstd, bzip2, or auto (detect by magic number,
+	// and leave uncompressed content as is)
+	Decompress string
+
+	// Path or glob pattern of a file inside a zip or tar archive
+	// (optionally compressed) to extract as the output file
+	ArchiveFilter string
+
+	// Extract the downloaded zip or tar archive into a new
+	// directory next to the output, and atomically replace the
+	// output with a symlink to it. Archive file modes are used
+	// unless FileMode is set.
+	Unpack bool
+
+	// Rewrite the content (after Decompress and ArchiveFilter)
+	// using "jq:" and a jq program (string results are written
+	// as is, like "jq -r"), or "template:" and a Go text/template
+	// ("." is the decoded JSON content, or the content as a
+	// string). The whole content is loaded into memory.
+	Transform string
+
+	// Convert the content (after Decompress, ArchiveFilter, and
+	// before Transform) from one character encoding to another,
+	// e.g., "windows-1252->utf-8", and convert line endings
+	// (last) to "unix" or "dos" style
+	ConvertEncoding string
+	LineEndings     string
+
+	// Delay before retrying after a failure. After each
+	// consecutive failure the delay is multiplied by RetryBackoff,
+	// up to MaxRetryInterval (default TTL).
+	RetryInterval    string
+	RetryBackoff     float64
+	MaxRetryInterval string
+
+	// Once the last success is older than StaleAfter (or there has
+	// never been one), ignore NotBefore/NotAfter/Windows, and retry
+	// failures every StaleRetryInterval (default RetryInterval)
+	// without backoff
+	StaleAfter         string
+	StaleRetryInterval string
+
+	// Extra HTTP request headers
+	Headers map[string]string
+
+	// User-Agent header for HTTP requests and OCI registry
+	// requests (default "getlatest/<version>")
+	UserAgent string
+
+	// Maximum number of HTTP redirects to follow (default 10, -1
+	// to refuse all redirects), and whether to refuse redirects
+	// to a different host
+	MaxRedirects              int
+	ForbidRedirectToOtherHost bool
+
+	// Send a HEAD request before each http(s) download, and skip
+	// the download if the ETag (or Last-Modified) and
+	// Content-Length match the existing output file. This saves
+	// bandwidth with servers that ignore conditional requests.
+	HeadCheck bool
+
+	// Reject responses whose Content-Type (ignoring parameters)
+	// does not match, e.g. "text/csv" or "application/*".
+	ExpectContentType string
+
+	// Reject HTTP responses unless each of these headers has the
+	// given value. An empty value only requires the header to be
+	// present.
+	ExpectHeaders map[string]string
+
+	// Reject the output unless it matches MustMatch, or if it
+	// matches MustNotMatch (regular expressions, checked against
+	// the first MatchLimit bytes, default 16 MiB).
+	MustMatch    string
+	MustNotMatch string
+	MatchLimit   int64
+
+	// Reject the output unless it is well-formed json, yaml,
+	// xml, or csv. A JSON or YAML file may contain a stream of
+	// values/documents.
+	ValidateFormat string
+
+	// Reject the output unless it starts with the magic number
+	// for this file type, e.g., "zip", "gzip", "pdf", or "png"
+	ExpectFileType string
+
+	// Reject the output unless it is a complete zip or tar
+	// (optionally compressed) archive, reading every entry to
+	// verify CRCs and checksums
+	CheckArchive bool
+
+	// Reject the output if the timestamp matched by
+	// FreshnessRegex (the first capture group, if any) is older
+	// than FreshnessMaxAge, e.g., `"generated_at": "([^"]+)"` and
+	// "48h". RFC 3339, RFC 1123, "2006-01-02 15:04:05", and Unix
+	// timestamps are accepted.
+	FreshnessRegex  string
+	FreshnessMaxAge string
+
+	// HTTP authentication (at most one of these)
+	BearerToken     string
+	BearerTokenFile string
+	OAuth2          *OAuth2
+	AWSSigV4        *AWSSigV4
+	Auth            *HTTPAuth // Digest or NTLM
 
-	urlt        *template.Template
+	// Look up credentials for the URL's host in a netrc file
+	// (used for http(s) basic auth if no other HTTP
+	// authentication is configured, and for SFTP and FTP if
+	// Username and the URL don't specify a user)
+	NetrcFile string
+
+	// Log in (e.g., submit a form) before each attempt, and send
+	// the resulting session cookies with the download request
+	Login *Login
+
+	// Timeouts (defaults 30s, 1m, 1h). DownloadTimeout limits the
+	// total time for an attempt, including the response body.
+	ConnectTimeout        string
+	ResponseHeaderTimeout string
+	DownloadTimeout       string
+
+	// Abort a download attempt if the transfer speed drops below
+	// the given rate, averaged over the given interval (default
+	// 30s), e.g., "50KB/s over 30s"
+	MinSpeed string
+
+	// Proxy for http(s) and s3 URLs (http, https, or socks5
+	// URL), and comma-separated hosts/domains/CIDRs that bypass
+	// the proxy ("*" for all). These override the HTTP_PROXY,
+	// HTTPS_PROXY, and NO_PROXY environment variables.
+	Proxy   string
+	NoProxy string
+
+	// TLS client certificate and key (PEM files) for http(s) URLs
+	// that require mutual TLS, and a CA bundle to use instead of
+	// the system roots when verifying the server
+	TLSCert   string
+	TLSKey    string
+	TLSCACert string
+
+	// Refuse TLS connections unless the server's certificate
+	// chain includes a public key with one of these SHA-256
+	// hashes (base64-encoded SubjectPublicKeyInfo hash, as in
+	// HPKP, optionally prefixed with "sha256/")
+	PinnedSPKIHashes []string
+
+	// HTTP protocol version for http(s) URLs: "1.1" to disable
+	// HTTP/2 for servers with a broken implementation, or "3" to
+	// use HTTP/3 (QUIC) for https URLs. The default ("") uses
+	// HTTP/2 if the server supports it.
+	HTTPVersion string
+
+	// Connect to the given IP addresses instead of resolving
+	// hostnames (like curl --resolve), e.g., {"host.example":
+	// "10.1.2.3"} or {"host.example:443": "10.1.2.3"}, and DNS
+	// servers to use instead of the system resolver
+	ResolveTo  map[string]string
+	DNSServers []string
+
+	// Connect to this unix domain socket instead of the host and
+	// port in http(s) URLs, e.g., URL "http://localhost/metrics"
+	// with UnixSocket "/run/foo.sock"
+	UnixSocket string
+
+	// IP address family to connect with: "4", "6", or "auto"
+	// (default, use both)
+	IPVersion string
+
+	// SFTP and FTP (FTP defaults to anonymous login)
+	Username       string
+	Password       string
+	PrivateKeyFile string
+	KnownHostsFile string
+
+	// S3 (credentials are found using the standard AWS
+	// credential chain)
+	S3Region   string
+	S3Endpoint string
+
+	// Upload each new version to these destinations, e.g.,
+	// "s3://bucket/key" (using S3Region and S3Endpoint), or
+	// "gs://bucket/key" (using Google Cloud Storage's S3
+	// compatible API, with an HMAC key as AWS credentials)
+	Mirror []string
+
+	// file:///path URLs are copied, or with CopyMode "hardlink"
+	// or "reflink", hard-linked or cloned when possible (falling
+	// back to a copy). A hard-linked output shares its mode,
+	// owner, and mtime with the source file.
+	CopyMode string
+
+	// oci://registry/repository:tag URLs download a layer (blob)
+	// from an OCI artifact, e.g., a file pushed with ORAS.
+	// OCILayer selects the layer by file name (title annotation)
+	// or media type; it can be omitted if there is only one.
+	OCILayer string
+
+	// github-release://owner/repo/asset-glob URLs download the
+	// newest matching asset. BearerToken/BearerTokenFile, if
+	// set, are used as a GitHub token. GitHubAPI is the API base
+	// URL (default https://api.github.com).
+	GitHubPrerelease bool // include pre-releases
+	GitHubAPI        string
+
+	// Fetch a JSON manifest from IndexURL and extract the value at
+	// IndexJSONPath (e.g., "$.assets[0].url"); or fetch an HTML
+	// page and find the first link (or the lexically greatest, if
+	// LinkLatest) that matches LinkSelector (CSS, default
+	// "a[href]") and LinkRegex; or, with IndexFeed, fetch an
+	// RSS/Atom feed and use the enclosure (or link) of the newest
+	// entry. The value is available as {{.index}} in URL
+	// templates; if no URL is given, it is the download URL.
+	IndexURL      string
+	IndexJSONPath string
+	LinkSelector  string
+	LinkRegex     string
+	LinkLatest    bool
+	IndexFeed     bool
+
+	mirrors     []mirror
+	checksumt   *template.Template
+	signaturet  *template.Template
+	indext      *template.Template
+	index       string // value found by IndexURL
+	linkSel     cascadia.Selector
+	linkRx      *regexp.Regexp
+	gpgKeys     openpgp.EntityList
+	minisignKey *minisignKey
+	rewriters   []rewriteFunc
+	mustMatch   *regexp.Regexp
+	mustNot     *regexp.Regexp
+	freshnessRx *regexp.Regexp
+	sshConfig   *ssh.ClientConfig
+	s3client    *s3.Client
+	client      *http.Client
+	proxy       func(*url.URL) (*url.URL, error)
+	tlsConfig   *tls.Config
 	ttl         time.Duration
+	splay       time.Duration
+	weekdays    weekdaySet // empty means every day
+	daysOfMonth dayOfMonthSet
+	months      monthSet
+	windows     []timeWindow
+	schedule    cron.Schedule
+	loc         *time.Location
 	lastSuccess time.Time
 	failCount   prometheus.Counter
 	failGauge   prometheus.Gauge
 	failSince   time.Time
+	failStreak  int // consecutive failures
+	retryGauge  prometheus.Gauge
+	retryDelay  time.Duration
+	retryAt     time.Time
+	retryAfter  time.Time // from last Retry-After response header
+	deferUntil  time.Time // retryAt, if set by Retry-After
+	deferGauge  prometheus.Gauge
+
+	attemptCount     prometheus.Counter
+	bytesCount       prometheus.Counter
+	durationHist     prometheus.Observer
+	lastSuccessGauge prometheus.Gauge
+	spaceFailCount   prometheus.Counter
+	uid, gid         int // -1 means unchanged
+	retryInterval    time.Duration
+	checkInterval    time.Duration
+	connectTimeout   time.Duration
+	headerTimeout    time.Duration
+	downloadTimeout  time.Duration
+	maxRetryInterval time.Duration
+	hedgeAfter       time.Duration
+	freshnessMaxAge  time.Duration
+	alignTo          time.Duration
+	staleAfter       time.Duration
+	staleRetry       time.Duration
+	etag             string // ETag of last successful response
+	modtime          string // Last-Modified of last successful response
+	lastError        string
+	partialValidator string // ETag or Last-Modified of content in partial file
+
+	minSpeed       float64 // bytes per second (see MinSpeed)
+	minSpeedWindow time.Duration
+	progress       sync.Map     // *os.File => *atomic.Int64 (see progressCounter)
+	checkInBy      atomic.Int64 // see checkIn
+
+	resolveTo map[string]string // lower-case ResolveTo keys
+	resolver  *net.Resolver     // nil unless DNSServers is set
+
+	mirrorUploads []mirrorUpload
+	reloadUnit    string // ReloadUnit, with ".service" added if needed
+
+	skipDates     map[string]bool // from SkipDates and SkipDatesFile
+	holidays      map[string]bool // from HolidayCalendars, protected by mtx
+	holidaysCheck time.Time       // next time to fetch HolidayCalendars
+
+	// SHA-256 hash of each file read by Setup (see readSetupFile)
+	setupFiles map[string][sha256.Size]byte
+
+	stateChanged chan struct{} // notified after each attempt (see Manager.StateFile)
+	limiter      *limiter      // limits concurrent downloads (see Manager.MaxConcurrent)
+	paused       atomic.Bool   // see Manager.Pause
+
+	// Set by Manager.Update (see linkDependencies), and protected
+	// by mtx.
+	deps       []*Getter
+	dependents []*Getter
+
+	// mtx protects state that is read by other goroutines (see
+	// status()). Such state is only written by the check goroutine.
+	mtx         sync.Mutex
+	downloading bool
+	updates     int // number of times the output file has been replaced
+	trigger     chan struct{}
+	wake        chan struct{} // re-check schedule (see wakeDependents)
+	depUpdated  chan struct{} // a dependency's output was updated
+	done        chan struct{} // closed when removed from scheduler
+
+	// Set by Manager.Update.
+	sched *scheduler
+
+	// Only used by the check goroutine.
+	depPending bool // dependency updated, download when allowed
+}
+
+// splayOffset returns a pseudo-random duration in [0, max) that is
+// always the same for a given key.
+func splayOffset(max time.Duration, key string) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	io.WriteString(h, key)
+	return time.Duration(h.Sum64() % uint64(max))
 }
 
-const defaultConfigPath = "/etc/getlatest.yaml"
+// logger returns a logger that labels entries with the target's
+// output path.
+func (g *Getter) logger() *slog.Logger {
+	return slog.With("target", g.Output)
+}
+
+// A mirror is one of the URLs a Getter can download from.
+type mirror struct {
+	config string // URL template as given in config
+	urlt   *template.Template
+}
+
+// allURLs returns URL (if any) followed by URLs.
+func (g *Getter) allURLs() []string {
+	var all []string
+	if g.URL != "" {
+		all = append(all, g.URL)
+	}
+	return append(all, g.URLs...)
+}
+
+// mirrorOrder returns the mirrors in the order they should be tried.
+func (g *Getter) mirrorOrder() []mirror {
+	mirrors := append([]mirror(nil), g.mirrors...)
+	if g.RandomizeMirrors {
+		rand.Shuffle(len(mirrors), func(i, j int) {
+			mirrors[i], mirrors[j] = mirrors[j], mirrors[i]
+		})
+	}
+	return mirrors
+}
 
-var umask = func() os.FileMode {
-	umask := syscall.Umask(0)
-	syscall.Umask(umask)
-	return os.FileMode(umask)
-}()
+// readSetupFile reads a file (e.g., a key or certificate) whose
+// content is loaded by Setup, and records its hash, so a config reload
+// can tell whether the file has changed (see sameConfig).
+func (g *Getter) readSetupFile(path string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if g.setupFiles == nil {
+		g.setupFiles = map[string][sha256.Size]byte{}
+	}
+	g.setupFiles[path] = sha256.Sum256(buf)
+	return buf, nil
+}
 
-func main() {
-	log.SetFlags(0)
+func (g *Getter) expand(t *template.Template) (string, error) {
+	data := map[string]interface{}{}
+	for k, v := range g.Vars {
+		// Like index, these come from the config and are
+		// used verbatim.
+		data[k] = template.HTML(v)
+	}
+	data["time"] = time.Now()
+	// Already a URL (or part of one), so don't HTML-escape it.
+	data["index"] = template.HTML(g.index)
+	var buf bytes.Buffer
+	err := t.Execute(&buf, data)
+	return buf.String(), err
+}
 
-	installService := flag.Bool("install-service", false, "install systemd service")
-	configPath := flag.String("config", defaultConfigPath, "configuration `file`")
-	metrics := flag.String("metrics", ":", "serve metrics at http://`[address]:port`/metrics")
-	flag.Parse()
-	if *installService {
-		err := ioutil.WriteFile("/lib/systemd/system/getlatest.service", systemdUnitFile, 0666)
+func (g *Getter) Setup() error {
+	g.setupFiles = nil
+	for _, d := range []struct {
+		name   string
+		config string
+		def    time.Duration
+		dst    *time.Duration
+	}{
+		{"ConnectTimeout", g.ConnectTimeout, 30 * time.Second, &g.connectTimeout},
+		{"ResponseHeaderTimeout", g.ResponseHeaderTimeout, time.Minute, &g.headerTimeout},
+		{"DownloadTimeout", g.DownloadTimeout, time.Hour, &g.downloadTimeout},
+	} {
+		if d.config == "" {
+			*d.dst = d.def
+		} else if v, err := time.ParseDuration(d.config); err != nil {
+			return fmt.Errorf("%q: error parsing %s value %q: %s", g.Output, d.name, d.config, err)
+		} else if v <= 0 {
+			return fmt.Errorf("%q: %s value %q must be positive", g.Output, d.name, d.config)
+		} else {
+			*d.dst = v
+		}
+	}
+	if g.URL == "" && len(g.URLs) == 0 && g.IndexURL == "" {
+		return fmt.Errorf("%q: no URL specified", g.Output)
+	}
+	if err := g.setupProxy(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupTLS(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupDNS(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if _, err := g.netrcLogin(""); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	for k := range g.Vars {
+		if k == "time" || k == "index" {
+			return fmt.Errorf("%q: cannot use reserved name %q in Vars", g.Output, k)
+		}
+	}
+	g.mirrors = nil
+	schemes := map[string]bool{}
+	for _, rawurl := range g.allURLs() {
+		t, err := template.New("url").Parse(rawurl)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		for _, cmd := range []*exec.Cmd{
-			exec.Command("systemctl", "daemon-reload"),
-			exec.Command("systemctl", "enable", "--now", "getlatest.service"),
-		} {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err = cmd.Run()
-			if err != nil {
-				log.Fatalf("%q: %s", cmd.Args, err)
+		urlstr, err := g.expand(t)
+		if err != nil {
+			return err
+		}
+		url, err := url.Parse(urlstr)
+		if err != nil {
+			return err
+		} else if url.Scheme == "" {
+			return fmt.Errorf("%q: cannot use URL %q with no protocol scheme", g.Output, rawurl)
+		} else if url.Scheme == "exec" {
+			if err := g.setupExec(urlstr); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if schemes[url.Scheme] {
+			// already set up
+		} else if url.Scheme == "sftp" {
+			if err := g.setupSFTP(url); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
 			}
+		} else if url.Scheme == "oci" {
+			if err := g.setupOCI(urlstr); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if url.Scheme == "file" {
+			if err := g.setupFile(url); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if url.Scheme == "ftp" || url.Scheme == "ftps" {
+			if err := g.setupFTP(url); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if url.Scheme == "s3" {
+			if err := g.setupS3(url); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if url.Scheme == "github-release" {
+			if err := g.setupGitHub(url); err != nil {
+				return fmt.Errorf("%q: %s", g.Output, err)
+			}
+		} else if url.Scheme != "http" && url.Scheme != "https" {
+			return fmt.Errorf("%q: unsupported protocol scheme %q in URL %q", g.Output, url.Scheme, rawurl)
 		}
-		return
+		if g.Resume && url.Scheme != "http" && url.Scheme != "https" {
+			return fmt.Errorf("%q: Resume is only supported for http(s) URLs", g.Output)
+		}
+		if g.UnixSocket != "" && url.Scheme != "http" && url.Scheme != "https" {
+			return fmt.Errorf("%q: UnixSocket is only supported for http(s) URLs", g.Output)
+		}
+		if g.Chunks > 1 && url.Scheme != "http" && url.Scheme != "https" {
+			return fmt.Errorf("%q: Chunks is only supported for http(s) URLs", g.Output)
+		}
+		schemes[url.Scheme] = true
+		g.mirrors = append(g.mirrors, mirror{config: rawurl, urlt: t})
+	}
+	if err := g.setupNotify(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupReload(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupIndex(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupHTTP(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if err := g.setupLogin(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(*metrics, nil)
+	if g.SHA256 != "" && g.ChecksumURL != "" {
+		return fmt.Errorf("%q: cannot use both SHA256 and ChecksumURL", g.Output)
+	} else if g.SHA256 != "" {
+		g.SHA256 = strings.ToLower(g.SHA256)
+		if b, err := hex.DecodeString(g.SHA256); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("%q: invalid SHA256 value %q", g.Output, g.SHA256)
+		}
+	} else if g.ChecksumURL != "" {
+		if t, err := template.New("checksum").Parse(g.ChecksumURL); err != nil {
+			return fmt.Errorf("%q: error parsing ChecksumURL %q: %s", g.Output, g.ChecksumURL, err)
+		} else {
+			g.checksumt = t
+		}
+	}
 
-	var getters map[string]*getter
-	buf, err := ioutil.ReadFile(*configPath)
-	if err != nil {
-		log.Fatal(err)
+	if err := g.setupSignature(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
 	}
-	err = yaml.Unmarshal(buf, &getters)
-	if err != nil {
-		log.Fatal(err)
+	g.rewriters = nil
+	if g.Decompress != "" {
+		rw, err := decompressor(g.Decompress)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.rewriters = append(g.rewriters, rw)
 	}
-	for output, g := range getters {
-		g.Output = output
-		err = g.setup()
+	g.hedgeAfter = 0
+	if g.HedgeAfter != "" {
+		d, err := time.ParseDuration(g.HedgeAfter)
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("%q: error parsing HedgeAfter value %q: %s", g.Output, g.HedgeAfter, err)
+		} else if d <= 0 {
+			return fmt.Errorf("%q: HedgeAfter value %q must be positive", g.Output, g.HedgeAfter)
+		} else if g.Resume {
+			return fmt.Errorf("%q: cannot use HedgeAfter with Resume", g.Output)
 		}
+		g.hedgeAfter = d
 	}
-	for _, g := range getters {
-		go g.run()
+	if g.Chunks < 0 || g.Chunks > maxChunks {
+		return fmt.Errorf("%q: invalid Chunks %d (maximum %d)", g.Output, g.Chunks, maxChunks)
+	} else if g.Chunks > 1 && g.Resume {
+		return fmt.Errorf("%q: cannot use Chunks with Resume", g.Output)
 	}
-	<-(chan bool)(nil)
-}
-
-func (g *getter) url() (string, error) {
-	var buf bytes.Buffer
-	err := g.urlt.Execute(&buf, map[string]interface{}{"time": time.Now()})
-	return buf.String(), err
-}
-
-func (g *getter) setup() error {
-	if urlt, err := template.New("url").Parse(g.URL); err != nil {
-		return err
+	g.minSpeed = 0
+	if g.MinSpeed != "" {
+		speed, window, err := parseMinSpeed(g.MinSpeed)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.minSpeed, g.minSpeedWindow = speed, window
+	}
+	if g.MinFreeSpace < 0 {
+		return fmt.Errorf("%q: invalid MinFreeSpace %d", g.Output, g.MinFreeSpace)
+	}
+	if g.MaximumSize < 0 || (g.MaximumSize > 0 && g.MaximumSize < g.MinimumSize) {
+		return fmt.Errorf("%q: invalid MaximumSize %d", g.Output, g.MaximumSize)
+	}
+	if _, ok := fileTypes[g.ExpectFileType]; !ok && g.ExpectFileType != "" {
+		return fmt.Errorf("%q: invalid ExpectFileType %q (must be one of %s)", g.Output, g.ExpectFileType, fileTypeNames())
+	}
+	if _, ok := formatCheckers[g.ValidateFormat]; !ok && g.ValidateFormat != "" {
+		return fmt.Errorf("%q: invalid ValidateFormat %q (must be json, yaml, xml, or csv)", g.Output, g.ValidateFormat)
+	}
+	if g.ExpectContentType != "" {
+		if _, _, err := mime.ParseMediaType(g.ExpectContentType); err != nil {
+			return fmt.Errorf("%q: invalid ExpectContentType %q: %s", g.Output, g.ExpectContentType, err)
+		}
+	}
+	for _, re := range []struct {
+		name string
+		expr string
+		dst  **regexp.Regexp
+	}{
+		{"MustMatch", g.MustMatch, &g.mustMatch},
+		{"MustNotMatch", g.MustNotMatch, &g.mustNot},
+	} {
+		*re.dst = nil
+		if re.expr == "" {
+			continue
+		}
+		rx, err := regexp.Compile(re.expr)
+		if err != nil {
+			return fmt.Errorf("%q: invalid %s %q: %s", g.Output, re.name, re.expr, err)
+		}
+		*re.dst = rx
+	}
+	if g.MatchLimit < 0 {
+		return fmt.Errorf("%q: invalid MatchLimit %d", g.Output, g.MatchLimit)
+	}
+	if err := g.setupFreshness(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if g.FileMode&^os.ModePerm != 0 {
+		return fmt.Errorf("%q: invalid FileMode %o", g.Output, g.FileMode)
+	}
+	if uid, gid, err := lookupOwner(g.Owner, g.Group); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
 	} else {
-		g.urlt = urlt
+		g.uid, g.gid = uid, gid
 	}
-	if urlstr, err := g.url(); err != nil {
-		return err
-	} else if url, err := url.Parse(urlstr); err != nil {
-		return err
-	} else if url.Scheme == "" {
-		return fmt.Errorf("%q: cannot use URL %q with no protocol scheme", g.Output, g.URL)
+	for _, dep := range g.DependsOn {
+		if dep == g.Output {
+			return fmt.Errorf("%q: cannot depend on itself", g.Output)
+		}
+	}
+	if g.FailureThreshold < 0 {
+		return fmt.Errorf("%q: invalid FailureThreshold %d", g.Output, g.FailureThreshold)
+	}
+	if g.KeepVersions < 0 {
+		return fmt.Errorf("%q: invalid KeepVersions %d", g.Output, g.KeepVersions)
+	}
+	if g.ArchiveFilter != "" {
+		rw, err := archiveExtractor(g.ArchiveFilter)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.rewriters = append(g.rewriters, rw)
+	}
+	encodingTo := ""
+	if g.ConvertEncoding != "" {
+		from, to, toName, err := parseConvertEncoding(g.ConvertEncoding)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.rewriters = append(g.rewriters, encodingConverter(from, to))
+		encodingTo = toName
+	}
+	if g.Transform != "" {
+		rw, err := transformer(g.Transform)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.rewriters = append(g.rewriters, rw)
+	}
+	if g.LineEndings != "" {
+		if strings.HasPrefix(encodingTo, "utf-16") {
+			return fmt.Errorf("%q: cannot use LineEndings with ConvertEncoding to %s", g.Output, encodingTo)
+		}
+		rw, err := lineEndingConverter(g.LineEndings)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.rewriters = append(g.rewriters, rw)
+	}
+	alsoWrite := map[string]bool{g.Output: true}
+	for _, path := range g.AlsoWrite {
+		if path == "" || alsoWrite[path] {
+			return fmt.Errorf("%q: invalid AlsoWrite path %q", g.Output, path)
+		}
+		alsoWrite[path] = true
+	}
+	if err := g.setupMirrorUploads(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if g.PipeTo != "" {
+		for _, conflict := range []struct {
+			name string
+			set  bool
+		}{
+			{"Unpack", g.Unpack},
+			{"Versioned", g.Versioned},
+			{"KeepVersions", g.KeepVersions > 0},
+			{"SkipUnchanged", g.SkipUnchanged},
+			{"AlsoWrite", len(g.AlsoWrite) > 0},
+		} {
+			if conflict.set {
+				return fmt.Errorf("%q: cannot use PipeTo with %s", g.Output, conflict.name)
+			}
+		}
+	}
+	if g.Unpack {
+		for _, conflict := range []struct {
+			name string
+			set  bool
+		}{
+			{"ArchiveFilter", g.ArchiveFilter != ""},
+			{"KeepVersions (without Versioned)", g.KeepVersions > 0 && !g.Versioned},
+			{"SkipUnchanged", g.SkipUnchanged},
+			{"AlsoWrite", len(g.AlsoWrite) > 0},
+		} {
+			if conflict.set {
+				return fmt.Errorf("%q: cannot use Unpack with %s", g.Output, conflict.name)
+			}
+		}
 	}
 
-	if fi, err := os.Stat(g.Output); err == nil {
+	if fi, err := os.Stat(g.Output); err == nil && g.PreserveModTime {
+		// The mtime is the upstream Last-Modified time, not
+		// the time of the last download, but it is still
+		// usable for a conditional request.
+		g.modtime = fi.ModTime().UTC().Format(http.TimeFormat)
+	} else if err == nil {
 		g.lastSuccess = fi.ModTime()
 	}
-	if t, err := time.Parse("15:04", g.NotBefore); err != nil && g.NotBefore != "" {
-		return fmt.Errorf("%q: error parsing NotBefore value %q: %s", g.Output, g.NotBefore, err)
-	} else if err == nil {
-		g.NotBefore = t.Format("15:04")
+	if g.Timezone != "" {
+		loc, err := time.LoadLocation(g.Timezone)
+		if err != nil {
+			return fmt.Errorf("%q: error loading Timezone %q: %s", g.Output, g.Timezone, err)
+		}
+		g.loc = loc
 	}
-	if t, err := time.Parse("15:04", g.NotAfter); err != nil && g.NotAfter != "" {
-		return fmt.Errorf("%q: error parsing NotAfter value %q: %s", g.Output, g.NotAfter, err)
-	} else if err == nil {
-		g.NotAfter = t.Format("15:04")
+	g.windows = nil
+	if len(g.Windows) > 0 && (g.NotBefore != "" || g.NotAfter != "") {
+		return fmt.Errorf("%q: cannot use Windows with NotBefore/NotAfter", g.Output)
+	} else if g.NotBefore != "" || g.NotAfter != "" {
+		w := timeWindow{0, 24*60 - 1}
+		for _, c := range []struct {
+			name   string
+			config string
+			dst    *int
+		}{
+			{"NotBefore", g.NotBefore, &w.start},
+			{"NotAfter", g.NotAfter, &w.end},
+		} {
+			if c.config == "" {
+				continue
+			}
+			m, err := parseClock(c.config)
+			if err != nil {
+				return fmt.Errorf("%q: error parsing %s value %q: %s", g.Output, c.name, c.config, err)
+			}
+			*c.dst = m
+		}
+		g.windows = []timeWindow{w}
 	}
-	if d, err := time.ParseDuration(g.TTL); g.TTL == "" {
+	for _, s := range g.Windows {
+		w, err := parseWindow(s)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.windows = append(g.windows, w)
+	}
+	if g.Schedule != "" {
+		if g.TTL != "" {
+			return fmt.Errorf("%q: cannot use both TTL and Schedule", g.Output)
+		}
+		sched, err := cronParser.Parse(g.Schedule)
+		if err != nil {
+			return fmt.Errorf("%q: error parsing Schedule value %q: %s", g.Output, g.Schedule, err)
+		}
+		g.schedule = sched
+	} else if d, err := time.ParseDuration(g.TTL); g.TTL == "" {
 		g.ttl = time.Hour
-		log.Printf("%q: using default TTL %s", g.Output, g.ttl)
+		if !g.Once {
+			g.logger().Info("using default TTL", "ttl", g.ttl.String())
+		}
 	} else if err != nil {
 		return fmt.Errorf("%q: error parsing TTL value %q: %s", g.Output, g.TTL, err)
 	} else {
 		g.ttl = d
 	}
-	if g.Weekdays = strings.TrimSpace(g.Weekdays); g.Weekdays != "" {
-		g.Weekdays = " " + strings.ToLower(g.Weekdays)
+	if g.AlignTo != "" && g.schedule != nil {
+		return fmt.Errorf("%q: cannot use both AlignTo and Schedule", g.Output)
+	} else if d, err := parseAlignTo(g.AlignTo); err != nil {
+		return fmt.Errorf("%q: error parsing AlignTo value %q: %s", g.Output, g.AlignTo, err)
+	} else {
+		g.alignTo = d
+	}
+	if d, err := time.ParseDuration(g.Splay); g.Splay == "" {
+		g.splay = 0
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing Splay value %q: %s", g.Output, g.Splay, err)
+	} else if d < 0 {
+		return fmt.Errorf("%q: Splay value %q must not be negative", g.Output, g.Splay)
+	} else {
+		hostname, _ := os.Hostname()
+		g.splay = splayOffset(d, hostname+"\x00"+g.Output)
+	}
+	if d, err := time.ParseDuration(g.CheckInterval); g.CheckInterval == "" {
+		g.checkInterval = time.Hour
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing CheckInterval value %q: %s", g.Output, g.CheckInterval, err)
+	} else if d < time.Second {
+		return fmt.Errorf("%q: CheckInterval value %q must be at least 1s", g.Output, g.CheckInterval)
+	} else {
+		g.checkInterval = d
+	}
+	if d, err := time.ParseDuration(g.RetryInterval); g.RetryInterval == "" {
+		g.retryInterval = time.Minute
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing RetryInterval value %q: %s", g.Output, g.RetryInterval, err)
+	} else {
+		g.retryInterval = d
+	}
+	if d, err := time.ParseDuration(g.MaxRetryInterval); g.MaxRetryInterval == "" {
+		g.maxRetryInterval = g.ttl
+		if g.schedule != nil {
+			g.maxRetryInterval = time.Hour
+		}
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing MaxRetryInterval value %q: %s", g.Output, g.MaxRetryInterval, err)
+	} else {
+		g.maxRetryInterval = d
+	}
+	if g.maxRetryInterval < g.retryInterval {
+		g.maxRetryInterval = g.retryInterval
+	}
+	if d, err := time.ParseDuration(g.StaleAfter); g.StaleAfter == "" {
+		g.staleAfter = 0
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing StaleAfter value %q: %s", g.Output, g.StaleAfter, err)
+	} else if d <= 0 {
+		return fmt.Errorf("%q: StaleAfter value %q must be positive", g.Output, g.StaleAfter)
+	} else {
+		g.staleAfter = d
+	}
+	if d, err := time.ParseDuration(g.StaleRetryInterval); g.StaleRetryInterval == "" {
+		g.staleRetry = g.retryInterval
+	} else if err != nil {
+		return fmt.Errorf("%q: error parsing StaleRetryInterval value %q: %s", g.Output, g.StaleRetryInterval, err)
+	} else if g.StaleAfter == "" {
+		return fmt.Errorf("%q: StaleRetryInterval requires StaleAfter", g.Output)
+	} else {
+		g.staleRetry = d
+	}
+	if g.RetryBackoff == 0 {
+		g.RetryBackoff = 1
+	} else if g.RetryBackoff < 1 {
+		return fmt.Errorf("%q: RetryBackoff value %v must be at least 1", g.Output, g.RetryBackoff)
+	}
+	if err := g.setupSkipDates(); err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if g.Weekdays == "" {
+		g.weekdays = 0
+	} else if set, err := parseWeekdays(g.Weekdays); err != nil {
+		return fmt.Errorf("%q: error parsing Weekdays value %q: %s", g.Output, g.Weekdays, err)
+	} else {
+		g.weekdays = set
+	}
+	if g.DaysOfMonth == "" {
+		g.daysOfMonth = 0
+	} else if set, err := parseDaysOfMonth(g.DaysOfMonth); err != nil {
+		return fmt.Errorf("%q: error parsing DaysOfMonth value %q: %s", g.Output, g.DaysOfMonth, err)
+	} else {
+		g.daysOfMonth = set
+	}
+	if g.Months == "" {
+		g.months = 0
+	} else if set, err := parseMonths(g.Months); err != nil {
+		return fmt.Errorf("%q: error parsing Months value %q: %s", g.Output, g.Months, err)
+	} else {
+		g.months = set
 	}
 
 	if fg, err := failGaugeVec.GetMetricWithLabelValues(g.Output); err != nil {
 		return err
 	} else {
-		fg.Set(0)
 		g.failGauge = fg
 	}
 	if fc, err := failCountVec.GetMetricWithLabelValues(g.Output); err != nil {
@@ -180,115 +1022,1215 @@ func (g *getter) setup() error {
 		fc.Add(0)
 		g.failCount = fc
 	}
+	if rg, err := retryGaugeVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		g.retryGauge = rg
+	}
+	if dg, err := deferGaugeVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		g.deferGauge = dg
+	}
+	if ac, err := attemptCountVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		ac.Add(0)
+		g.attemptCount = ac
+	}
+	if bc, err := bytesCountVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		bc.Add(0)
+		g.bytesCount = bc
+	}
+	if sc, err := spaceFailCountVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		sc.Add(0)
+		g.spaceFailCount = sc
+	}
+	if dh, err := durationVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		g.durationHist = dh
+	}
+	if lg, err := lastSuccessGaugeVec.GetMetricWithLabelValues(g.Output); err != nil {
+		return err
+	} else {
+		g.lastSuccessGauge = lg
+		g.setLastSuccessGauge()
+	}
 
+	g.trigger = make(chan struct{}, 1)
+	g.wake = make(chan struct{}, 1)
+	g.depUpdated = make(chan struct{}, 1)
+	g.done = make(chan struct{})
 	return nil
 }
 
-func (g *getter) run() {
-	g.download()
-	for range time.NewTicker(time.Minute).C {
-		g.download()
-	}
-}
-
-func (g *getter) should(t time.Time) bool {
-	if t.Sub(g.lastSuccess) < g.ttl {
-		return false
+// check attempts a download if one is due, or has been requested by
+// TriggerNow or a dependency, and returns the time to wait before
+// checking again (see nextCheck). Cancelling ctx aborts a download in
+// progress. It must only be called by the check goroutine (see
+// scheduler).
+//
+// When a dependency's output is updated, the next download is
+// attempted without waiting for TTL/Schedule, but only when the rest
+// of the schedule (Disabled, Pause, Once, time windows, dates) allows.
+func (g *Getter) check(ctx context.Context) time.Duration {
+	g.checkIn(time.Now().Add(holidaysTimeout))
+	select {
+	case <-g.trigger:
+		g.download(ctx, true)
+	default:
 	}
-	now := t.Format("15:04")
-	if g.NotBefore != "" && strings.Compare(now, g.NotBefore) < 0 {
-		return false
+	select {
+	case <-g.wake:
+	default:
 	}
-	if g.NotAfter != "" && strings.Compare(now, g.NotAfter) > 0 {
-		return false
+	select {
+	case <-g.depUpdated:
+		g.depPending = true
+	default:
 	}
-	if g.Weekdays != "" && !strings.Contains(g.Weekdays, " "+strings.ToLower(t.Format("Mon"))) {
-		return false
+	if attempted, _ := g.download(ctx, false); attempted {
+		g.depPending = false
+	} else if g.depPending && g.allowed(time.Now(), false) && g.depsReady() {
+		g.depPending = false
+		g.download(ctx, true)
 	}
-	return true
+	return g.nextCheck(time.Now())
 }
 
-func (g *getter) download() {
-	if !g.should(time.Now()) {
-		return
+// signal sends on ch (g.trigger, g.wake, or g.depUpdated) unless a
+// signal is already pending, and tells the scheduler to check g right
+// away.
+func (g *Getter) signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
 	}
-	err := g.trydownload()
-	if err != nil {
-		if g.failSince.IsZero() {
-			g.failSince = time.Now()
-		}
-		log.Print(err)
-		g.failGauge.Set(time.Now().Sub(g.failSince).Seconds())
-		g.failCount.Inc()
-	} else {
-		g.failSince = time.Time{}
-		g.failGauge.Set(0)
+	if g.sched != nil {
+		g.sched.wake(g)
 	}
 }
 
-func (g *getter) trydownload() error {
-	url, err := g.url()
-	if err != nil {
-		return fmt.Errorf("%q: error getting url: %s", g.Output, err)
+// livenessGrace is added to each checkIn deadline, to allow for
+// hooks, notifications, slow disks, etc.
+var livenessGrace = time.Minute
+
+// checkIn records that g is expected to check in again (i.e., call
+// checkIn, or start its next check) before t. The zero time means
+// there is no such deadline, e.g., while waiting for other targets'
+// downloads to finish (see MaxConcurrent).
+func (g *Getter) checkIn(t time.Time) {
+	if t.IsZero() {
+		g.checkInBy.Store(0)
+	} else {
+		g.checkInBy.Store(t.Add(livenessGrace).UnixNano())
 	}
-	log.Printf("%q: downloading %q", g.Output, url)
-	outdir, outfile := filepath.Split(g.Output)
-	f, err := ioutil.TempFile(outdir, "."+outfile+".")
-	if err != nil {
-		return fmt.Errorf("%q: error creating tempfile: %s", g.Output, err)
+}
+
+// stuck returns true if g has missed its checkIn deadline, e.g.,
+// because a download or hook has hung despite DownloadTimeout.
+func (g *Getter) stuck(now time.Time) bool {
+	t := g.checkInBy.Load()
+	return t != 0 && now.UnixNano() > t
+}
+
+// minCheckWait is the shortest time a getter waits between checks,
+// even if a download is due sooner.
+var minCheckWait = time.Second
+
+// nextCheck returns the time to wait before checking whether a
+// download is due. It must only be called by the check goroutine.
+func (g *Getter) nextCheck(now time.Time) time.Duration {
+	wait := g.checkInterval
+	if next := g.nextEligible(now); !next.IsZero() && next.Sub(now) < wait {
+		wait = next.Sub(now)
 	}
-	defer os.Remove(f.Name())
-	defer f.Close()
+	if wait < minCheckWait {
+		wait = minCheckWait
+	}
+	return wait
+}
+
+func (g *Getter) status() Status {
+	var size int64
+	if fi, err := os.Stat(g.Output); err == nil {
+		size = fi.Size()
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return Status{
+		Output:       g.Output,
+		URL:          g.mirrors[0].config,
+		LastSuccess:  g.lastSuccess,
+		FailSince:    g.failSince,
+		LastError:    g.lastError,
+		RetryAt:      g.retryAt,
+		NextEligible: g.nextEligible(time.Now()),
+		Size:         size,
+		Done:         g.Once && !g.lastSuccess.IsZero(),
+		Disabled:     g.Disabled,
+		Paused:       g.paused.Load(),
+
+		DeferredUntil: g.deferUntil,
+	}
+}
+
+// nextEligible returns the earliest time at or after now when should()
+// will return true, checking the earliest time allowed by TTL/Schedule
+// and retry delay, then one-minute intervals (the granularity of time
+// windows) up to 8 days ahead. It returns the zero time if there is no
+// such time. The caller must hold g.mtx, or be the check goroutine.
+func (g *Getter) nextEligible(now time.Time) time.Time {
+	t := now
+	if g.schedule != nil {
+		if next := g.schedule.Next(g.lastSuccess.In(g.location())).Add(g.splay); next.After(t) {
+			t = next
+		}
+	} else if next := g.ttlDue(); next.After(t) {
+		t = next
+	}
+	retryAt := g.nextRetry(now)
+	if staleAt := g.lastSuccess.Add(g.staleAfter); g.staleAfter > 0 && !g.lastSuccess.IsZero() && staleAt.Before(retryAt) {
+		// Once the output is stale, a retry may be allowed
+		// sooner.
+		retryAt = staleAt
+	}
+	if retryAt.After(t) {
+		t = retryAt
+	}
+	for end := now.Add(8 * 24 * time.Hour); !t.After(end); t = t.Truncate(time.Minute).Add(time.Minute) {
+		if g.should(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
 
-	resp, err := http.Get(url)
+// ttlDue returns the time the next download is due according to
+// TTL, AlignTo, and Splay.
+func (g *Getter) ttlDue() time.Time {
+	if g.alignTo == 0 || g.lastSuccess.IsZero() {
+		return g.lastSuccess.Add(g.ttl + g.splay)
+	}
+	// Allow some slack before rounding up, so a download that
+	// finishes a few seconds after a boundary doesn't push the
+	// next one out by a whole interval, and one that finishes just
+	// before a boundary isn't repeated right away.
+	slack := min(g.ttl, g.alignTo) / 2
+	due := g.lastSuccess.In(g.location()).Add(g.ttl - slack)
+	return alignUp(due, g.alignTo).Add(g.splay)
+}
+
+// stale returns true if StaleAfter is set, and the last success is
+// older than that at time t.
+func (g *Getter) stale(t time.Time) bool {
+	return g.staleAfter > 0 && (g.lastSuccess.IsZero() || t.Sub(g.lastSuccess) >= g.staleAfter)
+}
+
+// nextRetry returns the time the next retry is allowed after a
+// failure. This is normally retryAt, but if the output has become
+// stale since the last failure, it may be sooner (unless the server
+// sent Retry-After).
+func (g *Getter) nextRetry(t time.Time) time.Time {
+	if g.retryAt.IsZero() || !g.deferUntil.IsZero() || !g.stale(t) {
+		return g.retryAt
+	}
+	if stale := g.retryAt.Add(g.staleRetry - g.retryDelay); stale.Before(g.retryAt) {
+		return stale
+	}
+	return g.retryAt
+}
+
+// location returns the configured Timezone, or the local time zone.
+func (g *Getter) location() *time.Location {
+	if g.loc != nil {
+		return g.loc
+	}
+	return time.Local
+}
+
+// should returns true if a download is due at time t.
+func (g *Getter) should(t time.Time) bool {
+	return g.allowed(t, true)
+}
+
+// allowed returns true if the schedule allows a download at time t.
+// If due is false, TTL and Schedule are not checked, i.e., the
+// existing output is not considered fresh.
+func (g *Getter) allowed(t time.Time, due bool) bool {
+	if g.Disabled || g.paused.Load() {
+		return false
+	}
+	if g.Once && !g.lastSuccess.IsZero() {
+		return false
+	}
+	if g.loc != nil {
+		t = t.In(g.loc)
+	}
+	if !due {
+		// Skip TTL/Schedule.
+	} else if g.schedule != nil {
+		if g.schedule.Next(g.lastSuccess.In(t.Location())).Add(g.splay).After(t) {
+			return false
+		}
+	} else if t.Before(g.ttlDue()) {
+		return false
+	}
+	if t.Before(g.nextRetry(t)) {
+		return false
+	}
+	// Date filters apply to the day a window starts, so a
+	// 22:00-02:00 window on Friday runs until 02:00 Saturday.
+	day := t
+	if len(g.windows) > 0 && !g.stale(t) {
+		ok := false
+		for _, w := range g.windows {
+			if w.contains(t) {
+				ok = true
+				day = w.startDay(t)
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if g.weekdays != 0 && !g.weekdays.has(day.Weekday()) {
+		return false
+	}
+	if g.daysOfMonth != 0 && !g.daysOfMonth.has(day) {
+		return false
+	}
+	if g.months != 0 && !g.months.has(day.Month()) {
+		return false
+	}
+	if g.skipDate(day) {
+		return false
+	}
+	return true
+}
+
+// download attempts a download if the schedule allows it, or if force
+// is true. It returns false if no attempt was made.
+//
+// An attempt that is aborted because ctx is cancelled (e.g., during
+// shutdown) is not counted as a failure.
+func (g *Getter) download(ctx context.Context, force bool) (bool, error) {
+	if !force {
+		g.refreshHolidays(ctx, time.Now())
+	}
+	if !force && (!g.should(time.Now()) || !g.depsReady()) {
+		return false, nil
+	}
+	g.mtx.Lock()
+	g.downloading = true
+	wasFailing := !g.failSince.IsZero()
+	updates := g.updates
+	g.mtx.Unlock()
+	defer func() {
+		g.mtx.Lock()
+		g.downloading = false
+		g.mtx.Unlock()
+	}()
+	g.checkIn(time.Time{})
+	if err := g.limiter.acquire(ctx, g.Priority); err != nil {
+		return false, err
+	}
+	defer g.limiter.release()
+	g.checkIn(time.Now().Add(g.downloadTimeout))
+	g.attemptCount.Inc()
+	t0 := time.Now()
+	err := g.trydownload(ctx)
+	g.durationHist.Observe(time.Since(t0).Seconds())
+	if err != nil && ctx.Err() != nil {
+		g.logger().Warn("download aborted", "error", err, "duration", time.Since(t0).Seconds())
+	} else if err != nil {
+		g.logger().Error("download failed", "error", err, "duration", time.Since(t0).Seconds())
+		if g.failed(time.Now(), err) == max(g.FailureThreshold, 1) {
+			g.runOnFailure(err)
+		}
+		if !wasFailing {
+			g.notify("failure", "download failed: "+err.Error())
+		}
+	} else {
+		g.succeeded()
+		if wasFailing {
+			g.notify("recovery", "download succeeded after failures")
+		}
+		g.mtx.Lock()
+		updated := g.updates != updates
+		g.downloading = false
+		g.mtx.Unlock()
+		g.wakeDependents(updated)
+	}
+	select {
+	case g.stateChanged <- struct{}{}:
+	default:
+	}
+	return true, err
+}
+
+// failed updates failure metrics and schedules the next retry. It
+// returns the number of consecutive failures.
+func (g *Getter) failed(t time.Time, err error) int {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.lastError = err.Error()
+	g.failStreak++
+	if g.failSince.IsZero() {
+		g.failSince = t
+		g.retryDelay = g.retryInterval
+	} else {
+		g.retryDelay = time.Duration(float64(g.retryDelay) * g.RetryBackoff)
+		if g.retryDelay > g.maxRetryInterval {
+			g.retryDelay = g.maxRetryInterval
+		}
+	}
+	if g.stale(t) {
+		g.retryDelay = g.staleRetry
+	}
+	g.retryAt = t.Add(g.retryDelay)
+	g.deferUntil = time.Time{}
+	if ra := g.retryAfter; ra.After(g.retryAt) {
+		// The server asked us to wait longer (but not
+		// unreasonably long).
+		if limit := t.Add(24 * time.Hour); ra.After(limit) {
+			ra = limit
+		}
+		g.retryAt = ra
+		g.deferUntil = ra
+	}
+	g.retryAfter = time.Time{}
+	if g.deferUntil.IsZero() {
+		g.deferGauge.Set(0)
+	} else {
+		g.deferGauge.Set(float64(g.deferUntil.Unix()))
+	}
+	g.failGauge.Set(t.Sub(g.failSince).Seconds())
+	g.failCount.Inc()
+	g.retryGauge.Set(g.retryDelay.Seconds())
+	return g.failStreak
+}
+
+// succeeded resets failure metrics and backoff state.
+func (g *Getter) succeeded() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.lastError = ""
+	g.failStreak = 0
+	g.failSince = time.Time{}
+	g.retryDelay = 0
+	g.retryAt = time.Time{}
+	g.retryAfter = time.Time{}
+	g.deferUntil = time.Time{}
+	g.failGauge.Set(0)
+	g.retryGauge.Set(0)
+	g.deferGauge.Set(0)
+	g.setLastSuccessGauge()
+}
+
+// setLastSuccessGauge updates the last success metric. The caller
+// must hold g.mtx, or be the only goroutine using g.
+func (g *Getter) setLastSuccessGauge() {
+	if !g.lastSuccess.IsZero() {
+		g.lastSuccessGauge.Set(float64(g.lastSuccess.UnixNano()) / 1e9)
+	}
+}
+
+func (g *Getter) trydownload(ctx context.Context) error {
+	t0 := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, g.downloadTimeout)
+	defer cancel()
+	if g.MinFreeSpace > 0 {
+		if err := g.checkFreeSpace(0); err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+	}
+	if g.Login != nil {
+		if err := g.login(ctx); err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+	}
+	if g.indext != nil {
+		index, err := g.resolveIndex(ctx)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		g.logger().Info("found index entry", "value", index)
+		g.index = index
+	}
+	var f *os.File
+	var err error
+	if g.Resume {
+		f, err = os.OpenFile(g.partialPath(), os.O_RDWR|os.O_CREATE, 0600)
+	} else {
+		f, err = g.tempFile()
+	}
 	if err != nil {
-		return fmt.Errorf("%q: %q: %s", g.Output, url, err)
+		return fmt.Errorf("%q: error creating tempfile: %s", g.Output, err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%q: %q: non-OK response: %d %q", g.Output, url, resp.StatusCode, resp.Status)
+	keepPartial := false
+	defer func() {
+		if !keepPartial {
+			os.Remove(f.Name())
+		}
+	}()
+	// f may be replaced by fetchHedged, so don't evaluate it yet.
+	defer func() { f.Close() }()
+
+	var url string
+	var fetched fetched
+	mirrors := g.mirrorOrder()
+	if g.hedgeAfter > 0 && len(mirrors) > 1 {
+		var m mirror
+		f, url, m, fetched, err = g.fetchHedged(ctx, f, mirrors)
+		if err == nil || err == errNotModified {
+			g.logger().Info("using mirror", "mirror", m.config)
+			mirrorSuccessVec.WithLabelValues(g.Output, m.config).Inc()
+		} else if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("DownloadTimeout (%s) exceeded: %s", g.downloadTimeout, err)
+		}
+	} else {
+		for i, m := range mirrors {
+			if i > 0 {
+				g.logger().Warn("trying next mirror", "error", err)
+				if !g.Resume {
+					_, err = f.Seek(0, io.SeekStart)
+					if err == nil {
+						err = f.Truncate(0)
+					}
+					if err != nil {
+						return fmt.Errorf("%q: error truncating tempfile: %s", g.Output, err)
+					}
+				}
+			}
+			url, err = g.expand(m.urlt)
+			if err != nil {
+				err = fmt.Errorf("error getting url: %s", err)
+				continue
+			}
+			g.logger().Info("downloading", "url", url)
+			fetched, err = g.fetchMinSpeed(ctx, f, url)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("DownloadTimeout (%s) exceeded: %s", g.downloadTimeout, err)
+				break
+			} else if err != nil && ctx.Err() != nil {
+				// cancelled, don't try other mirrors
+				break
+			}
+			if err == nil || err == errNotModified {
+				if len(mirrors) > 1 {
+					g.logger().Info("using mirror", "mirror", m.config)
+					mirrorSuccessVec.WithLabelValues(g.Output, m.config).Inc()
+				}
+				break
+			}
+		}
 	}
-	n, err := io.Copy(f, resp.Body)
+	if err != nil && g.Resume && g.partialValidator != "" {
+		// Keep the partial file so the next attempt
+		// can resume where this one left off.
+		keepPartial = true
+	} else {
+		g.partialValidator = ""
+	}
+	if err == errNotModified && g.RequireChange {
+		return fmt.Errorf("%q: RequireChange: source not modified", g.Output)
+	} else if err == errNotModified {
+		g.mtx.Lock()
+		g.lastSuccess = time.Now()
+		g.mtx.Unlock()
+		g.logger().Info("success, not modified", "url", url, "duration", time.Since(t0).Seconds())
+		if g.WriteMetadata {
+			g.touchMetadata()
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	g.bytesCount.Add(float64(fetched.size))
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("%q: writing tempfile: %s", g.Output, err)
+	}
+	err = g.verifyChecksum(ctx, f.Name(), url)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.verifySignature(ctx, f.Name())
 	if err != nil {
-		return fmt.Errorf("%q: downloading %q to tempfile: %s", g.Output, url, err)
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	tmpname, n := f.Name(), fetched.size
+	for _, rw := range g.rewriters {
+		tmpname, n, err = g.rewrite(tmpname, rw)
+		if err != nil {
+			return fmt.Errorf("%q: %s", g.Output, err)
+		}
+		defer os.Remove(tmpname)
 	}
 	if n < g.MinimumSize {
 		return fmt.Errorf("%q: response body too small: %d bytes < MinimumSize %d", g.Output, n, g.MinimumSize)
+	} else if g.MaximumSize > 0 && n > g.MaximumSize {
+		return fmt.Errorf("%q: output too large: %d bytes > MaximumSize %d", g.Output, n, g.MaximumSize)
 	}
-	err = f.Close()
+	err = g.checkContent(tmpname)
 	if err != nil {
-		return fmt.Errorf("%q: writing tempfile: %s", g.Output, err)
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.checkFreshness(tmpname)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.checkFileType(tmpname)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.checkArchive(tmpname)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.checkFormat(tmpname)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	err = g.runValidate(ctx, tmpname, url)
+	if err != nil {
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	if g.SkipUnchanged || g.RequireChange {
+		same, err := sameContent(tmpname, g.Output)
+		if err != nil {
+			return fmt.Errorf("%q: error comparing with existing output: %s", g.Output, err)
+		}
+		if same && g.RequireChange {
+			return fmt.Errorf("%q: RequireChange: content is identical to existing output", g.Output)
+		} else if same {
+			g.mtx.Lock()
+			g.lastSuccess = time.Now()
+			g.etag = fetched.etag
+			g.modtime = fetched.modtime
+			g.mtx.Unlock()
+			g.logger().Info("success, content unchanged", "url", url, "bytes", n, "duration", time.Since(t0).Seconds())
+			if g.WriteMetadata {
+				g.touchMetadata()
+			}
+			return nil
+		}
+	}
+	if g.PipeTo != "" {
+		err = g.runPipeTo(ctx, tmpname, url)
+	} else if g.Unpack {
+		err = g.unpackOutput(tmpname, fetched.modtime)
+	} else {
+		err = g.installOutput(tmpname, fetched)
 	}
-	mode := 0666 & ^umask
-	err = os.Chmod(f.Name(), mode)
 	if err != nil {
-		return fmt.Errorf("%q: chmod %o tempfile: %s", g.Output, mode, err)
+		return fmt.Errorf("%q: %s", g.Output, err)
+	}
+	contentPath := g.Output
+	if g.PipeTo != "" || g.Unpack {
+		// There is no output file, only the content as
+		// downloaded.
+		contentPath = tmpname
 	}
-	err = os.Rename(f.Name(), g.Output)
+	err = g.uploadMirrors(ctx, contentPath)
 	if err != nil {
-		return fmt.Errorf("%q: renaming tempfile: %s", g.Output, err)
+		return fmt.Errorf("%q: %s", g.Output, err)
 	}
+	for _, path := range g.AlsoWrite {
+		// If this fails, the next attempt downloads the
+		// content again (the ETag is not updated) and
+		// retries all copies.
+		err = g.copyOutput(g.Output, path)
+		if err != nil {
+			return fmt.Errorf("%q: AlsoWrite %q: %s", g.Output, path, err)
+		}
+		if !g.NoSync {
+			if err := syncDir(filepath.Dir(path)); err != nil {
+				g.logger().Warn("error syncing AlsoWrite directory", "path", path, "error", err)
+			}
+		}
+	}
+	if g.WriteMetadata {
+		err = g.writeMetadata(contentPath, url, fetched)
+		if err != nil {
+			return fmt.Errorf("%q: error writing metadata file: %s", g.Output, err)
+		}
+	}
+	g.mtx.Lock()
 	g.lastSuccess = time.Now()
-	log.Printf("%q: success, wrote %d bytes", g.Output, n)
+	g.etag = fetched.etag
+	g.modtime = fetched.modtime
+	g.updates++
+	g.mtx.Unlock()
+	g.logger().Info("success", "url", url, "bytes", n, "duration", time.Since(t0).Seconds())
+	g.reloadConsumers()
+	g.runOnSuccess(url)
+	g.notify("success", fmt.Sprintf("updated from %s (%d bytes)", url, n))
 	return nil
 }
 
-var systemdUnitFile = []byte(`
-[Unit]
-Description=getlatest
-After=network.target
-StartLimitIntervalSec=0
-ConditionPathExists=` + defaultConfigPath + `
+// installOutput sets the mode, ownership, and mtime of the
+// downloaded tempfile, and renames it to the output file.
+func (g *Getter) installOutput(tmpname string, fetched fetched) error {
+	// Changing the mode, owner, or mtime of a hard link would
+	// change the source file too.
+	linked := fetched.linked && len(g.rewriters) == 0
+	if !linked {
+		mode := 0666 & ^umask
+		if g.FileMode != 0 {
+			mode = g.FileMode
+		}
+		if err := os.Chmod(tmpname, mode); err != nil {
+			return fmt.Errorf("chmod %o tempfile: %s", mode, err)
+		}
+		if g.uid >= 0 || g.gid >= 0 {
+			if err := os.Chown(tmpname, g.uid, g.gid); err != nil {
+				return fmt.Errorf("chown tempfile: %s", err)
+			}
+		}
+	}
+	if g.PreserveModTime && fetched.modtime != "" && !linked {
+		if t, err := http.ParseTime(fetched.modtime); err != nil {
+			g.logger().Warn("cannot parse Last-Modified time", "modtime", fetched.modtime, "error", err)
+		} else if err := os.Chtimes(tmpname, time.Now(), t); err != nil {
+			return fmt.Errorf("setting tempfile mtime: %s", err)
+		}
+	}
+	if g.KeepVersions > 0 && !g.Versioned {
+		if err := g.keepVersion(); err != nil {
+			return err
+		}
+	}
+	if !g.NoSync {
+		// Otherwise, after a crash, the rename might be
+		// persisted without the content.
+		if err := syncFile(tmpname); err != nil {
+			return fmt.Errorf("syncing tempfile: %s", err)
+		}
+	}
+	if g.Versioned {
+		vpath, err := g.newVersionPath()
+		if err != nil {
+			return err
+		}
+		if err := g.renameOutput(tmpname, vpath); err != nil {
+			return fmt.Errorf("renaming tempfile: %s", err)
+		}
+		return g.switchVersion(vpath)
+	}
+	if err := g.renameOutput(tmpname, g.Output); err != nil {
+		return fmt.Errorf("renaming tempfile: %s", err)
+	}
+	if !g.NoSync {
+		if err := syncDir(filepath.Dir(g.Output)); err != nil {
+			g.logger().Warn("error syncing output directory", "error", err)
+		}
+	}
+	return nil
+}
 
-[Service]
-Type=simple
-ExecStart=/usr/bin/env getlatest
-RestartSec=60
-Restart=always
-SyslogIdentifier=getlatest
+// tempFile creates a new tempfile in TempDir, or next to the output
+// file if TempDir is not set.
+func (g *Getter) tempFile() (*os.File, error) {
+	outdir, outfile := filepath.Split(g.Output)
+	if g.TempDir != "" {
+		outdir = g.TempDir
+	}
+	return ioutil.TempFile(outdir, "."+outfile+".")
+}
+
+// renameOutput renames tmpname to target (the output file, or a
+// Versioned version file). If they are on different filesystems
+// (e.g., TempDir is a tmpfs), it copies tmpname to a new tempfile
+// next to target -- preserving mode, ownership, and mtime -- and
+// renames that instead.
+func (g *Getter) renameOutput(tmpname, target string) error {
+	err := os.Rename(tmpname, target)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	err = g.copyOutput(tmpname, target)
+	if err != nil {
+		return fmt.Errorf("copying tempfile to output directory: %s", err)
+	}
+	return nil
+}
+
+// copyOutput copies srcpath to a new tempfile next to target --
+// preserving mode, ownership, and mtime -- and renames it to target.
+func (g *Getter) copyOutput(srcpath, target string) error {
+	src, err := os.Open(srcpath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	outdir, outfile := filepath.Split(target)
+	dst, err := ioutil.TempFile(outdir, "."+outfile+".")
+	if err != nil {
+		return fmt.Errorf("error creating tempfile: %s", err)
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Chmod(fi.Mode().Perm())
+	}
+	if err == nil && (g.uid >= 0 || g.gid >= 0) {
+		err = dst.Chown(g.uid, g.gid)
+	}
+	if err == nil && !g.NoSync {
+		err = dst.Sync()
+	}
+	if err == nil {
+		err = dst.Close()
+	}
+	if err == nil {
+		err = os.Chtimes(dst.Name(), fi.ModTime(), fi.ModTime())
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), target)
+}
+
+// syncFile flushes the named file's content to stable storage.
+func syncFile(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the named directory to stable storage, so a
+// preceding rename survives a crash. It is a no-op on Windows, where
+// directories cannot be synced.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// sameContent returns true if the files at the given paths have
+// identical content. A nonexistent file at path b is not an error.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else if fa.Size() != fb.Size() {
+		return false, nil
+	}
+	ha, err := sha256File(a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := sha256File(b)
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
+
+// A rewriteFunc reads downloaded content from src and writes
+// transformed content (e.g., decompressed) to w.
+type rewriteFunc func(w io.Writer, src *os.File) error
+
+// rewrite creates a new tempfile next to the output file containing
+// the result of applying rw to the content of srcpath. It returns the
+// new tempfile's name and size. If rw fails, the new tempfile is
+// removed.
+func (g *Getter) rewrite(srcpath string, rw rewriteFunc) (string, int64, error) {
+	src, err := os.Open(srcpath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+	dst, err := g.tempFile()
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating tempfile: %s", err)
+	}
+	err = rw(dst, src)
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", 0, err
+	}
+	fi, err := os.Stat(dst.Name())
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", 0, err
+	}
+	return dst.Name(), fi.Size(), nil
+}
+
+// copyBody copies downloaded content from r to f, which already
+// contains offset bytes (e.g., from a resumed download). If the total
+// would exceed MaximumSize, it stops copying and returns an error.
+func (g *Getter) copyBody(f io.Writer, r io.Reader, offset int64) (int64, error) {
+	if file, ok := f.(*os.File); ok && g.minSpeed > 0 {
+		f = progressWriter{w: f, n: g.progressCounter(file)}
+	}
+	if g.MaximumSize <= 0 {
+		return io.Copy(f, r)
+	}
+	n, err := io.Copy(f, io.LimitReader(r, g.MaximumSize-offset+1))
+	if err == nil {
+		err = g.checkMaximumSize(offset + n)
+	}
+	return n, err
+}
+
+// checkFreeSpace returns an error if writing size more bytes to the
+// output directory would leave less than MinFreeSpace bytes
+// available. If free space cannot be determined, it returns nil.
+func (g *Getter) checkFreeSpace(size int64) error {
+	free, err := diskFree(filepath.Dir(g.Output))
+	if err != nil {
+		return nil
+	}
+	if size < 0 {
+		size = 0
+	}
+	if free-size < g.MinFreeSpace || free < size {
+		g.spaceFailCount.Inc()
+		return fmt.Errorf("insufficient disk space in %q: %d bytes available, need %d + MinFreeSpace %d", filepath.Dir(g.Output), free, size, g.MinFreeSpace)
+	}
+	return nil
+}
+
+// checkContent returns an error if the content of the named file
+// does not satisfy MustMatch and MustNotMatch.
+func (g *Getter) checkContent(name string) error {
+	if g.mustMatch == nil && g.mustNot == nil {
+		return nil
+	}
+	limit := g.MatchLimit
+	if limit == 0 {
+		limit = 1 << 24
+	}
+	for _, check := range []struct {
+		rx   *regexp.Regexp
+		want bool
+		name string
+	}{
+		{g.mustMatch, true, "MustMatch"},
+		{g.mustNot, false, "MustNotMatch"},
+	} {
+		if check.rx == nil {
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		match := check.rx.MatchReader(bufio.NewReader(io.LimitReader(f, limit)))
+		f.Close()
+		if match && !check.want {
+			return fmt.Errorf("output matches %s %q", check.name, check.rx)
+		} else if !match && check.want {
+			return fmt.Errorf("output does not match %s %q", check.name, check.rx)
+		}
+	}
+	return nil
+}
+
+// checkContentType returns an error if ExpectContentType is set and
+// does not match the given Content-Type.
+func (g *Getter) checkContentType(ctype string) error {
+	if g.ExpectContentType == "" {
+		return nil
+	}
+	want, _, _ := mime.ParseMediaType(g.ExpectContentType)
+	got, _, err := mime.ParseMediaType(ctype)
+	if err == nil {
+		if want == got {
+			return nil
+		}
+		if prefix := strings.TrimSuffix(want, "*"); prefix != want && strings.HasPrefix(got, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected Content-Type %q (ExpectContentType %q)", ctype, g.ExpectContentType)
+}
+
+// checkMaximumSize returns an error if size exceeds MaximumSize.
+func (g *Getter) checkMaximumSize(size int64) error {
+	if g.MaximumSize > 0 && size > g.MaximumSize {
+		return fmt.Errorf("response body too large: more than MaximumSize %d bytes", g.MaximumSize)
+	}
+	return nil
+}
+
+// errNotModified is returned by a fetch func if the source has not
+// changed since the last successful download.
+var errNotModified = errors.New("not modified")
+
+// fetched describes the content written to a tempfile by a fetch
+// func.
+type fetched struct {
+	size    int64
+	etag    string // ETag header or equivalent
+	modtime string // Last-Modified header or equivalent
+	linked  bool   // tempfile is a hard link to the source file
+}
+
+// fetch writes the content of the given URL to f.
+func (g *Getter) fetch(ctx context.Context, f *os.File, url string) (fetched, error) {
+	switch {
+	case strings.HasPrefix(url, "sftp://"):
+		return g.fetchSFTP(ctx, f, url)
+	case strings.HasPrefix(url, "exec:"):
+		return g.fetchExec(ctx, f, url)
+	case strings.HasPrefix(url, "oci://"):
+		return g.fetchOCI(ctx, f, url)
+	case strings.HasPrefix(url, "file://"):
+		return g.fetchFile(ctx, f, url)
+	case strings.HasPrefix(url, "ftp://"), strings.HasPrefix(url, "ftps://"):
+		return g.fetchFTP(ctx, f, url)
+	case strings.HasPrefix(url, "s3://"):
+		return g.fetchS3(ctx, f, url)
+	case strings.HasPrefix(url, "github-release://"):
+		return g.fetchGitHubRelease(ctx, f, url)
+	default:
+		return g.fetchHTTP(ctx, f, url, nil)
+	}
+}
+
+// partialPath returns the path where a partial download is kept
+// between attempts when Resume is enabled.
+func (g *Getter) partialPath() string {
+	return g.Output + ".partial"
+}
+
+// haveOutput returns true if the output file exists, i.e., the
+// etag/modtime of the last successful download are still relevant.
+func (g *Getter) haveOutput() bool {
+	if g.PipeTo != "" {
+		// There is no output file, but the last
+		// successful download was piped to the command.
+		g.mtx.Lock()
+		defer g.mtx.Unlock()
+		return !g.lastSuccess.IsZero()
+	}
+	_, err := os.Stat(g.Output)
+	return err == nil
+}
+
+// hookTimeout is the maximum run time of an OnSuccess or OnFailure
+// command.
+var hookTimeout = time.Hour
+
+// runOnFailure runs the OnFailure command, if any. Errors are
+// logged but otherwise ignored.
+func (g *Getter) runOnFailure(dlerr error) {
+	if g.OnFailure == "" {
+		return
+	}
+	g.checkIn(time.Now().Add(hookTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", g.OnFailure)
+	cmd.Env = append(os.Environ(),
+		"GETLATEST_OUTPUT="+g.Output,
+		"GETLATEST_ERROR="+dlerr.Error(),
+		fmt.Sprintf("GETLATEST_FAILURES=%d", max(g.FailureThreshold, 1)))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		g.logger().Error("OnFailure command failed", "command", g.OnFailure, "error", err)
+	}
+}
+
+// runValidate runs the ValidateCommand, if any, with the tempfile
+// path as $1, and returns an error if it fails.
+func (g *Getter) runValidate(ctx context.Context, tmpname, url string) error {
+	if g.ValidateCommand == "" {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", g.ValidateCommand, "getlatest-validate", tmpname)
+	cmd.Env = append(os.Environ(),
+		"GETLATEST_OUTPUT="+g.Output,
+		"GETLATEST_TEMPFILE="+tmpname,
+		"GETLATEST_URL="+url)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 1000 {
+			msg = msg[:1000] + "..."
+		}
+		return fmt.Errorf("ValidateCommand failed: %s: %q", err, msg)
+	}
+	return nil
+}
+
+// runOnSuccess runs the OnSuccess command, if any. Errors are logged
+// but do not make the download count as a failure, since the output
+// file has already been replaced.
+func (g *Getter) runOnSuccess(url string) {
+	if g.OnSuccess == "" {
+		return
+	}
+	g.checkIn(time.Now().Add(hookTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", g.OnSuccess)
+	cmd.Env = append(os.Environ(),
+		"GETLATEST_OUTPUT="+g.Output,
+		"GETLATEST_URL="+url)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		g.logger().Error("OnSuccess command failed", "command", g.OnSuccess, "error", err)
+	}
+}
+
+// verifyChecksum returns an error if the SHA256 hash of the given
+// file does not match the configured SHA256 or the hash obtained from
+// ChecksumURL. It returns nil if no checksum is configured.
+func (g *Getter) verifyChecksum(ctx context.Context, path, srcurl string) error {
+	want := g.SHA256
+	if g.checksumt != nil {
+		sumurl, err := g.expand(g.checksumt)
+		if err != nil {
+			return fmt.Errorf("error getting checksum url: %s", err)
+		}
+		want, err = g.fetchChecksum(ctx, sumurl, srcurl)
+		if err != nil {
+			return err
+		}
+	}
+	if want == "" {
+		return nil
+	}
+	got, err := sha256File(path)
+	if err != nil {
+		return fmt.Errorf("error reading tempfile: %s", err)
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch: got sha256 %s, expected %s", got, want)
+	}
+	return nil
+}
+
+// sha256File returns the hex-encoded sha256 hash of the content of
+// the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
 
-[Install]
-WantedBy=multi-user.target
-`)
+// fetchChecksum retrieves a checksum file from sumurl and returns the
+// hash it lists for srcurl.
+func (g *Getter) fetchChecksum(ctx context.Context, sumurl, srcurl string) (string, error) {
+	buf, err := g.fetchAux(ctx, sumurl)
+	if err != nil {
+		return "", err
+	}
+	filename := srcurl
+	if u, err := url.Parse(srcurl); err == nil {
+		filename = u.Path
+	}
+	hash, err := parseChecksum(string(buf), path.Base(filename))
+	if err != nil {
+		return "", fmt.Errorf("%q: %s", sumurl, err)
+	}
+	return hash, nil
+}
+
+// parseChecksum finds the hash for the given filename in the content
+// of a checksum file. The file can be a bare hash, sha256sum output
+// ("hash  filename" or "hash *filename"), or BSD-style output
+// ("SHA256 (filename) = hash"). If there is only one hash in the
+// file, the filename does not need to match.
+func parseChecksum(content, filename string) (string, error) {
+	var hashes, names []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "SHA256 (") {
+			if i := strings.LastIndex(line, ") = "); i > 8 {
+				names = append(names, line[8:i])
+				hashes = append(hashes, line[i+4:])
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		hashes = append(hashes, fields[0])
+		if len(fields) > 1 {
+			names = append(names, path.Base(strings.TrimPrefix(fields[1], "*")))
+		} else {
+			names = append(names, "")
+		}
+	}
+	var found string
+	if len(hashes) == 1 {
+		found = hashes[0]
+	} else {
+		for i, name := range names {
+			if name == filename {
+				found = hashes[i]
+				break
+			}
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no checksum found for %q", filename)
+	}
+	found = strings.ToLower(found)
+	if b, err := hex.DecodeString(found); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %q", found)
+	}
+	return found, nil
+}
+
+// cronParser accepts standard 5-field cron expressions, an optional
+// leading seconds field, and descriptors like "@daily".
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
 
 var (
 	failGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
@@ -296,7 +2238,44 @@ var (
 		Help: "consecutive seconds of failures",
 	}, []string{"target"})
 	failCountVec = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "getlatest_failures",
+		Name: "getlatest_failures_total",
 		Help: "number of failed attempts",
 	}, []string{"target"})
+	attemptCountVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "getlatest_attempts_total",
+		Help: "number of download attempts",
+	}, []string{"target"})
+	bytesCountVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "getlatest_download_bytes_total",
+		Help: "number of bytes downloaded",
+	}, []string{"target"})
+	durationVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "getlatest_download_duration_seconds",
+		Help:    "time taken by download attempts",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+	}, []string{"target"})
+	spaceFailCountVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "getlatest_insufficient_space_total",
+		Help: "number of attempts that failed due to insufficient disk space",
+	}, []string{"target"})
+	lastSuccessGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "getlatest_last_success_timestamp_seconds",
+		Help: "time of the last successful download (unix epoch)",
+	}, []string{"target"})
+	mirrorSuccessVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "getlatest_mirror_successes_total",
+		Help: "number of successful attempts using each mirror",
+	}, []string{"target", "mirror"})
+	httpResponseCountVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "getlatest_http_responses_total",
+		Help: "number of http(s) responses received using each protocol",
+	}, []string{"target", "protocol"})
+	retryGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "getlatest_retry_delay_seconds",
+		Help: "current delay between retries after a failure (0 if not failing)",
+	}, []string{"target"})
+	deferGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "getlatest_retry_deferred_until_timestamp_seconds",
+		Help: "time before which the upstream server asked not to retry, via Retry-After (unix epoch, 0 if none)",
+	}, []string{"target"})
 )
@@ -1,29 +1,44 @@
-package main
+package getlatest
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestShouldAtTime(t *testing.T) {
-	defaults := getter{}
-	beforework := getter{
-		NotBefore: "07:00",
-		NotAfter:  "09:00",
-		Weekdays:  "Mon Tue Wed Thu Fri",
+	defaults := func() *Getter { return &Getter{} }
+	beforework := func() *Getter {
+		return &Getter{
+			NotBefore: "07:00",
+			NotAfter:  "09:00",
+			Weekdays:  "Mon Tue Wed Thu Fri",
+		}
 	}
 	for _, trial := range []struct {
 		should bool
 		t      string
-		g      getter
+		g      *Getter
 	}{
-		{false, "2019-08-28T04:00:00-07:00", beforework},
-		{true, "2019-08-28T07:00:00-07:00", beforework},
-		{true, "2019-08-28T08:59:00-07:00", beforework},
-		{false, "2019-08-28T09:15:00-07:00", beforework},
-		{false, "2019-08-31T08:59:00-07:00", beforework},
-		{true, "2019-08-31T01:23:45-07:00", defaults},
-		{false, "2019-08-10T01:23:45-07:00", getter{lastSuccess: time.Now()}},
+		{false, "2019-08-28T04:00:00-07:00", beforework()},
+		{true, "2019-08-28T07:00:00-07:00", beforework()},
+		{true, "2019-08-28T08:59:00-07:00", beforework()},
+		{false, "2019-08-28T09:15:00-07:00", beforework()},
+		{false, "2019-08-31T08:59:00-07:00", beforework()},
+		{true, "2019-08-31T01:23:45-07:00", defaults()},
+		{false, "2019-08-10T01:23:45-07:00", &Getter{lastSuccess: time.Now()}},
 	} {
 		now, err := time.Parse(time.RFC3339, trial.t)
 		if err != nil {
@@ -32,13 +47,1052 @@ func TestShouldAtTime(t *testing.T) {
 		g := trial.g
 		g.URL = "http://host.example/foo"
 		g.TTL = "1h"
-		err = g.setup()
+		err = g.Setup()
 		if err != nil {
 			t.Errorf("setup fail: %s", err)
 			continue
 		}
 		if trial.should != g.should(now) {
-			t.Errorf("fail: %#v", trial)
+			t.Errorf("fail: should=%v t=%s g=%+v", trial.should, trial.t, g)
+		}
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	var reqs []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req)
+		if req.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Wed, 28 Aug 2019 07:00:00 GMT")
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if h := reqs[0].Header.Get("If-None-Match"); h != "" {
+		t.Errorf("unexpected If-None-Match %q in first request", h)
+	}
+	if h := reqs[1].Header.Get("If-Modified-Since"); h != "Wed, 28 Aug 2019 07:00:00 GMT" {
+		t.Errorf("wrong If-Modified-Since %q in second request", h)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+
+	// If the output file disappears, we need a full download.
+	os.Remove(g.Output)
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := reqs[2].Header.Get("If-None-Match"); h != "" {
+		t.Errorf("unexpected If-None-Match %q after removing output", h)
+	}
+	if _, err := os.Stat(g.Output); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	const hashA = "3b6a07d0d404fab4e23b6d34bc6696a6a312dd92821332385e5af7c01c421351"
+	const hashB = "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"
+	for _, trial := range []struct {
+		content  string
+		filename string
+		expect   string
+	}{
+		{hashA + "\n", "foo.tgz", hashA},
+		{hashA + "  other.tgz\n", "foo.tgz", hashA},
+		{hashA + "  other.tgz\n" + hashB + " *foo.tgz\n", "foo.tgz", strings.ToLower(hashB)},
+		{"SHA256 (other.tgz) = " + hashA + "\nSHA256 (foo.tgz) = " + hashB + "\n", "foo.tgz", strings.ToLower(hashB)},
+		{hashA + "  other.tgz\n" + hashB + "  another.tgz\n", "foo.tgz", ""},
+		{"abcdef  foo.tgz\n", "foo.tgz", ""},
+	} {
+		got, err := parseChecksum(trial.content, trial.filename)
+		if trial.expect == "" && err == nil {
+			t.Errorf("%q: expected error, got %q", trial.content, got)
+		} else if trial.expect != "" && got != trial.expect {
+			t.Errorf("%q: expected %q, got %q, %v", trial.content, trial.expect, got, err)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/SHA256SUMS":
+			// sha256 of "hello\n"
+			w.Write([]byte("5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  foo.txt\n"))
+		case "/foo.txt":
+			w.Write([]byte("hullo\n"))
+		}
+	}))
+	defer srv.Close()
+
+	g := Getter{
+		URL:         srv.URL + "/foo.txt",
+		ChecksumURL: srv.URL + "/SHA256SUMS",
+		Output:      filepath.Join(t.TempDir(), "foo"),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(g.Output); !os.IsNotExist(err) {
+		t.Errorf("output file should not exist: %v", err)
+	}
+}
+
+func TestOnSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := Getter{
+		URL:       srv.URL + "/foo",
+		Output:    filepath.Join(tmpdir, "foo"),
+		OnSuccess: `echo "$GETLATEST_OUTPUT $GETLATEST_URL" >"$GETLATEST_OUTPUT.hook"`,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(g.Output + ".hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := g.Output + " " + srv.URL + "/foo\n"; string(buf) != expect {
+		t.Errorf("hook wrote %q, expected %q", buf, expect)
+	}
+}
+
+func TestOnFailure(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	hookfile := filepath.Join(tmpdir, "hook")
+	g := Getter{
+		URL:              srv.URL + "/foo",
+		Output:           filepath.Join(tmpdir, "foo"),
+		OnFailure:        `echo "$GETLATEST_FAILURES $GETLATEST_ERROR" >>` + hookfile,
+		FailureThreshold: 3,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooklines := func() int {
+		buf, _ := ioutil.ReadFile(hookfile)
+		return strings.Count(string(buf), "\n")
+	}
+	fail.Store(true)
+	for i, expect := range []int{0, 0, 1, 1, 1} {
+		g.download(context.Background(), true)
+		if n := hooklines(); n != expect {
+			t.Errorf("after failure %d: hook ran %d times, expected %d", i+1, n, expect)
+		}
+	}
+	fail.Store(false)
+	g.download(context.Background(), true)
+	fail.Store(true)
+	for i := 0; i < 3; i++ {
+		g.download(context.Background(), true)
+	}
+	if n := hooklines(); n != 2 {
+		t.Errorf("after recovery and 3 more failures: hook ran %d times, expected 2", n)
+	}
+	buf, _ := ioutil.ReadFile(hookfile)
+	if !strings.HasPrefix(string(buf), "3 ") || !strings.Contains(string(buf), "500") {
+		t.Errorf("unexpected hook output %q", buf)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		command string
+		ok      bool
+	}{
+		{`grep -q hello "$1"`, true},
+		{`test "$1" = "$GETLATEST_TEMPFILE" && test "$1" != "$GETLATEST_OUTPUT"`, true},
+		{`grep -q goodbye "$1"`, false},
+		{`echo >&2 "bad file"; exit 3`, false},
+	} {
+		g := Getter{
+			URL:             srv.URL + "/foo",
+			Output:          filepath.Join(t.TempDir(), "foo"),
+			ValidateCommand: trial.command,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%q: %s", trial.command, err)
+		} else if !trial.ok {
+			if err == nil {
+				t.Errorf("%q: expected error", trial.command)
+			}
+			if _, err := os.Stat(g.Output); !os.IsNotExist(err) {
+				t.Errorf("%q: output should not exist, got %v", trial.command, err)
+			}
+		}
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := Getter{
+		URL:      srv.URL + "/foo",
+		Output:   filepath.Join(t.TempDir(), "foo"),
+		FileMode: 0640,
+		Owner:    fmt.Sprint(os.Getuid()),
+		Group:    fmt.Sprint(os.Getgid()),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(g.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("got mode %o, expected 0640", fi.Mode().Perm())
+	}
+
+	g = Getter{URL: srv.URL, Output: g.Output, Owner: "no-such-user-getlatest"}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for nonexistent Owner")
+	}
+}
+
+func TestPreserveModTime(t *testing.T) {
+	published := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var reqs, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs++
+		if req.Header.Get("If-Modified-Since") != "" {
+			notModified++
+		}
+		http.ServeContent(w, req, "foo", published, strings.NewReader("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:             srv.URL + "/foo",
+		Output:          filepath.Join(t.TempDir(), "foo"),
+		PreserveModTime: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(g.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(published) {
+		t.Errorf("got mtime %s, expected %s", fi.ModTime(), published)
+	}
+	if time.Since(g.lastSuccess) > time.Minute {
+		t.Errorf("lastSuccess %s should be the download time", g.lastSuccess)
+	}
+
+	// A new Getter should not mistake the upstream time for the
+	// last download time, but should still send a conditional
+	// request.
+	g = &Getter{
+		URL:             srv.URL + "/foo",
+		Output:          g.Output,
+		PreserveModTime: true,
+	}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.lastSuccess.IsZero() {
+		t.Errorf("lastSuccess %s should be zero", g.lastSuccess)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reqs != 2 || notModified != 1 {
+		t.Errorf("reqs %d, notModified %d", reqs, notModified)
+	}
+}
+
+func TestTempDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tempdirs := []string{t.TempDir()}
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		// Probably a different filesystem, which exercises
+		// the copy fallback.
+		dir, err := ioutil.TempDir("/dev/shm", "getlatest-test-")
+		if err == nil {
+			defer os.RemoveAll(dir)
+			tempdirs = append(tempdirs, dir)
+		}
+	}
+	for _, tempdir := range tempdirs {
+		g := Getter{
+			URL:             srv.URL + "/foo",
+			Output:          filepath.Join(t.TempDir(), "foo"),
+			TempDir:         tempdir,
+			FileMode:        0640,
+			ValidateCommand: `test "$(dirname "$1")" = "` + tempdir + `"`,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Errorf("%s: %s", tempdir, err)
+			continue
+		}
+		fi, err := os.Stat(g.Output)
+		if err != nil {
+			t.Errorf("%s: %s", tempdir, err)
+		} else if fi.Mode().Perm() != 0640 {
+			t.Errorf("%s: got mode %o, expected 0640", tempdir, fi.Mode().Perm())
+		}
+		for _, dir := range []string{tempdir, filepath.Dir(g.Output)} {
+			ents, _ := ioutil.ReadDir(dir)
+			for _, ent := range ents {
+				if ent.Name() != "foo" {
+					t.Errorf("%s: leftover file %s in %s", tempdir, ent.Name(), dir)
+				}
+			}
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	g := Getter{
+		URL:              "http://host.example/foo",
+		Output:           "/tmp/retry-backoff-test",
+		RetryInterval:    "1m",
+		RetryBackoff:     3,
+		MaxRetryInterval: "20m",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, expect := range []time.Duration{time.Minute, 3 * time.Minute, 9 * time.Minute, 20 * time.Minute, 20 * time.Minute} {
+		g.failed(now, errors.New("test"))
+		if g.retryDelay != expect {
+			t.Errorf("expected delay %s, got %s", expect, g.retryDelay)
+		}
+		if g.should(now.Add(expect - time.Second)) {
+			t.Errorf("should not retry before %s", expect)
+		}
+		now = now.Add(expect)
+		if !g.should(now) {
+			t.Errorf("should retry after %s", expect)
+		}
+	}
+	g.succeeded()
+	g.failed(now, errors.New("test"))
+	if g.retryDelay != time.Minute {
+		t.Errorf("expected delay to reset after success, got %s", g.retryDelay)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	for _, trial := range []struct {
+		should      bool
+		schedule    string
+		lastSuccess string
+		t           string
+	}{
+		{true, "0 2 1 * *", "", "2019-08-28T04:00:00Z"},
+		{false, "0 2 1 * *", "2019-08-01T02:00:10Z", "2019-08-28T04:00:00Z"},
+		{false, "0 2 1 * *", "2019-08-01T02:00:10Z", "2019-09-01T01:59:00Z"},
+		{true, "0 2 1 * *", "2019-08-01T02:00:10Z", "2019-09-01T02:00:00Z"},
+		{false, "*/15 6-9 * * *", "2019-08-28T06:00:10Z", "2019-08-28T06:14:59Z"},
+		{true, "*/15 6-9 * * *", "2019-08-28T06:00:10Z", "2019-08-28T06:15:00Z"},
+		{false, "*/15 6-9 * * *", "2019-08-28T09:45:10Z", "2019-08-28T10:15:00Z"},
+		{true, "30 * * * * *", "2019-08-28T09:45:10Z", "2019-08-28T09:45:30Z"},
+		{true, "@daily", "2019-08-28T09:45:10Z", "2019-08-29T00:00:00Z"},
+	} {
+		g := &Getter{
+			URL:      "http://host.example/foo",
+			Schedule: trial.schedule,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trial.lastSuccess != "" {
+			g.lastSuccess, err = time.Parse(time.RFC3339, trial.lastSuccess)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		now, err := time.Parse(time.RFC3339, trial.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trial.should != g.should(now) {
+			t.Errorf("fail: %+v", trial)
+		}
+	}
+	g := &Getter{URL: "http://host.example/foo", Schedule: "@daily", TTL: "1h"}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error using both Schedule and TTL")
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	for _, trial := range []struct {
+		should bool
+		t      string
+	}{
+		// CEST, UTC+2
+		{false, "2019-08-28T04:59:00Z"},
+		{true, "2019-08-28T05:00:00Z"},
+		{true, "2019-08-28T06:59:00Z"},
+		{false, "2019-08-28T07:01:00Z"},
+		// CET, UTC+1
+		{false, "2019-12-04T05:30:00Z"},
+		{true, "2019-12-04T06:00:00Z"},
+		{true, "2019-12-04T07:30:00Z"},
+		// Saturday in Berlin, Friday in Los Angeles
+		{false, "2019-08-31T08:30:00+02:00"},
+		{false, "2019-08-30T22:30:00-07:00"},
+		// Friday in Berlin, Thursday in Los Angeles
+		{true, "2019-08-29T22:30:00-07:00"},
+	} {
+		g := &Getter{
+			URL:       "http://host.example/foo",
+			NotBefore: "07:00",
+			NotAfter:  "09:00",
+			Weekdays:  "mon tue wed thu fri",
+			Timezone:  "Europe/Berlin",
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now, err := time.Parse(time.RFC3339, trial.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trial.should != g.should(now) {
+			t.Errorf("fail: %+v", trial)
+		}
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	content := "hello\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:           srv.URL + "/foo",
+		Output:        filepath.Join(t.TempDir(), "foo"),
+		SkipUnchanged: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(g.Output, old, old)
+	before, err := os.Stat(g.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.lastSuccess = time.Time{}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(g.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(old) {
+		t.Errorf("output file was replaced even though content is unchanged")
+	}
+	if g.lastSuccess.IsZero() {
+		t.Errorf("lastSuccess not updated")
+	}
+
+	content = "hullo\n"
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != content {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+}
+
+func TestOnce(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "not yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	output := filepath.Join(t.TempDir(), "foo")
+	g := &Getter{
+		URL:           srv.URL + "/foo",
+		Output:        output,
+		Once:          true,
+		RetryInterval: "1ns",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Failures are retried as usual.
+	for i, expectErr := range []bool{true, false} {
+		time.Sleep(time.Millisecond)
+		attempted, err := g.download(context.Background(), false)
+		if !attempted || (err != nil) != expectErr {
+			t.Errorf("attempt %d: attempted %v, err %v", i, attempted, err)
+		}
+	}
+	if st := g.status(); !st.Done || !st.NextEligible.IsZero() {
+		t.Errorf("status after success: %+v", st)
+	}
+	if attempted, _ := g.download(context.Background(), false); attempted {
+		t.Error("attempted another download after success")
+	}
+	if attempted, err := g.download(context.Background(), true); !attempted || err != nil {
+		t.Errorf("forced download: attempted %v, err %v", attempted, err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	// If the output file already exists, it is not replaced.
+	g = &Getter{URL: srv.URL + "/foo", Output: output, Once: true}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.should(time.Now()) {
+		t.Error("should() returned true with existing output file")
+	}
+}
+
+func TestRequireChange(t *testing.T) {
+	content := "hello\n"
+	etag := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+			if req.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	for _, withETag := range []bool{false, true} {
+		content = "hello\n"
+		etag = ""
+		if withETag {
+			etag = `"1"`
+		}
+		g := &Getter{
+			URL:           srv.URL + "/foo",
+			Output:        filepath.Join(t.TempDir(), "foo"),
+			RequireChange: true,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "RequireChange") {
+			t.Errorf("withETag=%v: expected RequireChange error, got %v", withETag, err)
+		}
+
+		content = "hullo\n"
+		if withETag {
+			etag = `"2"`
+		}
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != content {
+			t.Errorf("output file: %q, %v", buf, err)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if _, err := g.download(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	g.URL = srv.URL + "/fail"
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.download(context.Background(), true); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, trial := range []struct {
+		name   string
+		c      prometheus.Collector
+		expect float64
+	}{
+		{"attempts", g.attemptCount, 2},
+		{"failures", g.failCount, 1},
+		{"bytes", g.bytesCount, 6},
+	} {
+		if got := testutil.ToFloat64(trial.c); got != trial.expect {
+			t.Errorf("%s: expected %v, got %v", trial.name, trial.expect, got)
+		}
+	}
+	if got := testutil.ToFloat64(g.lastSuccessGauge); got < float64(before.Unix()) {
+		t.Errorf("last success timestamp %v < %v", got, before.Unix())
+	}
+	if n := testutil.CollectAndCount(durationVec, "getlatest_download_duration_seconds"); n < 1 {
+		t.Errorf("no duration metrics collected")
+	}
+}
+
+func TestNextEligible(t *testing.T) {
+	for _, trial := range []struct {
+		g           *Getter
+		lastSuccess string
+		now         string
+		expect      string
+	}{
+		// due now
+		{&Getter{TTL: "1h"}, "2019-08-28T04:00:00Z", "2019-08-28T06:00:00Z", "2019-08-28T06:00:00Z"},
+		// TTL
+		{&Getter{TTL: "1h"}, "2019-08-28T04:00:00Z", "2019-08-28T04:30:00Z", "2019-08-28T05:00:00Z"},
+		// TTL, then wait for window
+		{&Getter{TTL: "1h", NotBefore: "07:00", Timezone: "UTC"}, "2019-08-28T04:00:00Z", "2019-08-28T04:30:00Z", "2019-08-28T07:00:00Z"},
+		// wait for window and weekday
+		{&Getter{TTL: "1h", NotBefore: "07:00", NotAfter: "09:00", Weekdays: "mon", Timezone: "UTC"}, "2019-08-28T08:00:00Z", "2019-08-28T08:30:00Z", "2019-09-02T07:00:00Z"},
+		// schedule
+		{&Getter{Schedule: "0 2 1 * *", Timezone: "UTC"}, "2019-08-01T02:00:10Z", "2019-08-28T04:00:00Z", "2019-09-01T02:00:00Z"},
+		// TTL aligned to the hour
+		{&Getter{TTL: "1h", AlignTo: "hour"}, "2019-08-28T04:00:05Z", "2019-08-28T04:30:00Z", "2019-08-28T05:00:00Z"},
+		{&Getter{TTL: "90m", AlignTo: "hour"}, "2019-08-28T04:00:05Z", "2019-08-28T04:30:00Z", "2019-08-28T06:00:00Z"},
+		{&Getter{TTL: "15m", AlignTo: "15m"}, "2019-08-28T04:14:59Z", "2019-08-28T04:15:00Z", "2019-08-28T04:30:00Z"},
+		// TTL aligned to midnight in Timezone
+		{&Getter{TTL: "24h", AlignTo: "day", Timezone: "America/New_York"}, "2019-08-28T15:00:00Z", "2019-08-28T16:00:00Z", "2019-08-29T04:00:00Z"},
+		// never within 8 days
+		{&Getter{TTL: "240h"}, "2019-08-28T04:00:00Z", "2019-08-28T06:00:00Z", ""},
+	} {
+		g := trial.g
+		g.URL = "http://host.example/foo"
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.lastSuccess, _ = time.Parse(time.RFC3339, trial.lastSuccess)
+		now, _ := time.Parse(time.RFC3339, trial.now)
+		var expect time.Time
+		if trial.expect != "" {
+			expect, _ = time.Parse(time.RFC3339, trial.expect)
+		}
+		if got := g.nextEligible(now); !got.Equal(expect) {
+			t.Errorf("%+v: expected %s, got %s", trial, expect, got)
+		}
+	}
+}
+
+func TestStaleAfter(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	g := &Getter{
+		URL:                "http://host.example/foo",
+		TTL:                "1h",
+		NotBefore:          "07:00",
+		NotAfter:           "09:00",
+		Timezone:           "UTC",
+		RetryInterval:      "1h",
+		RetryBackoff:       2,
+		StaleAfter:         "24h",
+		StaleRetryInterval: "5m",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.lastSuccess = at("2019-08-27T08:30:00Z")
+	for _, trial := range []struct {
+		time   string
+		should bool
+	}{
+		{"2019-08-28T06:00:00Z", false}, // outside window
+		{"2019-08-28T07:00:00Z", true},
+		{"2019-08-28T09:30:00Z", true}, // stale, ignore window
+	} {
+		if got := g.should(at(trial.time)); got != trial.should {
+			t.Errorf("%s: expected %v, got %v", trial.time, trial.should, got)
+		}
+	}
+
+	// Failure before the output is stale: normal retry delay,
+	// until it becomes stale.
+	g.failed(at("2019-08-28T08:00:00Z"), errors.New("fail"))
+	if g.should(at("2019-08-28T08:20:00Z")) {
+		t.Error("should() returned true before retry delay")
+	}
+	if !g.should(at("2019-08-28T08:30:00Z")) {
+		t.Error("should() returned false after output became stale")
+	}
+	if next, expect := g.nextEligible(at("2019-08-28T08:20:00Z")), at("2019-08-28T08:30:00Z"); !next.Equal(expect) {
+		t.Errorf("nextEligible: expected %s, got %s", expect, next)
+	}
+
+	// Failures while stale: StaleRetryInterval, without backoff.
+	for _, ts := range []string{"2019-08-28T10:00:00Z", "2019-08-28T10:05:00Z"} {
+		g.failed(at(ts), errors.New("fail"))
+		if g.retryDelay != 5*time.Minute {
+			t.Errorf("%s: expected retry delay 5m, got %s", ts, g.retryDelay)
+		}
+	}
+	if g.should(at("2019-08-28T10:09:00Z")) || !g.should(at("2019-08-28T10:10:00Z")) {
+		t.Error("stale retry not scheduled correctly")
+	}
+
+	for _, g := range []*Getter{
+		{StaleAfter: "-1h"},
+		{StaleAfter: "1 day"},
+		{StaleRetryInterval: "5m"},
+	} {
+		g.URL = "http://host.example/foo"
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected error", g)
+		}
+	}
+}
+
+func TestSplay(t *testing.T) {
+	offsets := map[time.Duration]bool{}
+	for _, key := range []string{"host1\x00/tmp/foo", "host2\x00/tmp/foo", "host1\x00/tmp/bar"} {
+		d := splayOffset(10*time.Minute, key)
+		if d < 0 || d >= 10*time.Minute {
+			t.Errorf("%q: offset %s out of range", key, d)
+		}
+		if d != splayOffset(10*time.Minute, key) {
+			t.Errorf("%q: offset is not stable", key)
+		}
+		offsets[d] = true
+	}
+	if len(offsets) < 2 {
+		t.Errorf("offsets are not distributed: %v", offsets)
+	}
+
+	g := &Getter{URL: "http://host.example/foo", TTL: "1h", Splay: "10m"}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.splay = 5 * time.Minute
+	g.lastSuccess = time.Date(2019, 8, 28, 4, 0, 0, 0, time.UTC)
+	if g.should(g.lastSuccess.Add(time.Hour + 4*time.Minute)) {
+		t.Error("should wait for splay")
+	}
+	if !g.should(g.lastSuccess.Add(time.Hour + 5*time.Minute)) {
+		t.Error("should run after TTL + splay")
+	}
+}
+
+func TestMaximumSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/chunked" {
+			// no Content-Length
+			w.Write([]byte("hello "))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("world\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path string
+		max  int64
+		ok   bool
+	}{
+		{"/foo", 6, true},
+		{"/foo", 5, false},
+		{"/chunked", 12, true},
+		{"/chunked", 11, false},
+	} {
+		g := &Getter{
+			URL:         srv.URL + trial.path,
+			Output:      filepath.Join(t.TempDir(), "foo"),
+			MaximumSize: trial.max,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok && (err == nil || !strings.Contains(err.Error(), "MaximumSize")) {
+			t.Errorf("%+v: expected MaximumSize error, got %v", trial, err)
+		}
+		if _, err := os.Stat(g.Output); trial.ok == os.IsNotExist(err) {
+			t.Errorf("%+v: output file exists = %v", trial, !trial.ok)
+		}
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/huge" {
+			w.Header().Set("Content-Length", fmt.Sprint(int64(1)<<60))
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path         string
+		minFreeSpace int64
+		ok           bool
+	}{
+		{"/foo", 0, true},
+		{"/foo", 1 << 60, false},
+		{"/huge", 0, false},
+	} {
+		g := &Getter{
+			URL:          srv.URL + trial.path,
+			Output:       filepath.Join(t.TempDir(), "foo"),
+			MinFreeSpace: trial.minFreeSpace,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := testutil.ToFloat64(g.spaceFailCount)
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok && (err == nil || !strings.Contains(err.Error(), "insufficient disk space")) {
+			t.Errorf("%+v: expected insufficient space error, got %v", trial, err)
+		} else if !trial.ok && testutil.ToFloat64(g.spaceFailCount) != before+1 {
+			t.Errorf("%+v: metric not incremented", trial)
+		}
+	}
+}
+
+func TestMustMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/login" {
+			w.Write([]byte("<html><form>Please log in</form></html>\n"))
+			return
+		}
+		w.Write([]byte("id,name\n1,foo\n2,bar\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path         string
+		mustMatch    string
+		mustNotMatch string
+		matchLimit   int64
+		ok           bool
+	}{
+		{"/data", `^id,name\n`, "", 0, true},
+		{"/login", `^id,name\n`, "", 0, false},
+		{"/data", "", `(?i)log in`, 0, true},
+		{"/login", "", `(?i)log in`, 0, false},
+		{"/data", `2,bar`, "", 0, true},
+		{"/data", `2,bar`, "", 10, false},
+	} {
+		output := filepath.Join(t.TempDir(), "foo")
+		g := &Getter{
+			URL:          srv.URL + trial.path,
+			Output:       output,
+			MustMatch:    trial.mustMatch,
+			MustNotMatch: trial.mustNotMatch,
+			MatchLimit:   trial.matchLimit,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			if _, err := os.Stat(output); !os.IsNotExist(err) {
+				t.Errorf("%+v: output should not exist, got %v", trial, err)
+			}
+		}
+	}
+
+	g := &Getter{URL: srv.URL, Output: filepath.Join(t.TempDir(), "foo"), MustMatch: "("}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for invalid MustMatch")
+	}
+}
+
+func TestAlsoWrite(t *testing.T) {
+	content := "hello\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:       srv.URL + "/foo",
+		Output:    filepath.Join(tmpdir, "foo"),
+		AlsoWrite: []string{filepath.Join(tmpdir, "bar"), filepath.Join(t.TempDir(), "baz")},
+		FileMode:  0640,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content = range []string{"hello\n", "hullo\n"} {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		outfi, err := os.Stat(g.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range g.AlsoWrite {
+			if buf, err := ioutil.ReadFile(path); err != nil || string(buf) != content {
+				t.Errorf("%s: %q, %v", path, buf, err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != outfi.Mode() || !fi.ModTime().Equal(outfi.ModTime()) || os.SameFile(fi, outfi) {
+				t.Errorf("%s: mode %s mtime %s, expected separate file with mode %s mtime %s", path, fi.Mode(), fi.ModTime(), outfi.Mode(), outfi.ModTime())
+			}
+		}
+	}
+
+	g.AlsoWrite = []string{filepath.Join(tmpdir, "nonexistent", "bar")}
+	g.lastSuccess = time.Time{}
+	content = "hallo\n"
+	if err := g.trydownload(context.Background()); err == nil {
+		t.Error("expected error writing to nonexistent directory")
+	}
+
+	for _, paths := range [][]string{{""}, {g.Output}, {"/tmp/x", "/tmp/x"}} {
+		g := &Getter{URL: srv.URL, Output: g.Output, AlsoWrite: paths}
+		if err := g.Setup(); err == nil {
+			t.Errorf("AlsoWrite %q: expected Setup error", paths)
 		}
 	}
 }
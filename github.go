@@ -0,0 +1,116 @@
+package getlatest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+type githubRelease struct {
+	TagName    string        `json:"tag_name"`
+	Draft      bool          `json:"draft"`
+	Prerelease bool          `json:"prerelease"`
+	Assets     []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	UpdatedAt          string `json:"updated_at"`
+}
+
+// parseGitHubReleaseURL splits a github-release://owner/repo/glob URL
+// into its parts.
+func parseGitHubReleaseURL(u *url.URL) (owner, repo, glob string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if u.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("github-release URL %q must be of the form github-release://owner/repo/asset-glob", u.Redacted())
+	}
+	if _, err := path.Match(parts[1], ""); err != nil {
+		return "", "", "", fmt.Errorf("github-release URL %q: invalid asset glob %q: %s", u.Redacted(), parts[1], err)
+	}
+	return u.Host, parts[0], parts[1], nil
+}
+
+// setupGitHub checks a github-release URL.
+func (g *Getter) setupGitHub(u *url.URL) error {
+	_, _, _, err := parseGitHubReleaseURL(u)
+	return err
+}
+
+// fetchGitHubRelease finds the newest release of the given repo with
+// an asset matching the glob, and downloads that asset.
+func (g *Getter) fetchGitHubRelease(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	u, err := url.Parse(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	owner, repo, glob, err := parseGitHubReleaseURL(u)
+	if err != nil {
+		return fetched{}, err
+	}
+	api := strings.TrimSuffix(g.GitHubAPI, "/")
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	var releases []githubRelease
+	if g.GitHubPrerelease {
+		buf, err := g.fetchAux(ctx, fmt.Sprintf("%s/repos/%s/%s/releases?per_page=20", api, owner, repo))
+		if err != nil {
+			return fetched{}, err
+		}
+		err = json.Unmarshal(buf, &releases)
+		if err != nil {
+			return fetched{}, fmt.Errorf("error parsing GitHub releases: %s", err)
+		}
+	} else {
+		var rel githubRelease
+		buf, err := g.fetchAux(ctx, fmt.Sprintf("%s/repos/%s/%s/releases/latest", api, owner, repo))
+		if err != nil {
+			return fetched{}, err
+		}
+		err = json.Unmarshal(buf, &rel)
+		if err != nil {
+			return fetched{}, fmt.Errorf("error parsing GitHub release: %s", err)
+		}
+		releases = append(releases, rel)
+	}
+	for _, rel := range releases {
+		if rel.Draft || (rel.Prerelease && !g.GitHubPrerelease) {
+			continue
+		}
+		for _, asset := range rel.Assets {
+			if ok, _ := path.Match(glob, asset.Name); !ok {
+				continue
+			}
+			// The asset ID changes if the asset is
+			// replaced, and updated_at changes if it is
+			// re-uploaded.
+			etag := fmt.Sprintf("%d-%s", asset.ID, asset.UpdatedAt)
+			if g.haveOutput() && etag == g.etag {
+				return fetched{}, errNotModified
+			}
+			g.logger().Info("found GitHub release asset", "tag", rel.TagName, "asset", asset.Name)
+			dlurl, hdr := asset.BrowserDownloadURL, http.Header(nil)
+			if g.BearerToken != "" || g.BearerTokenFile != "" {
+				// Private repo assets are only available
+				// through the API.
+				dlurl, hdr = asset.URL, http.Header{"Accept": {"application/octet-stream"}}
+			}
+			result, err := g.fetchHTTP(ctx, f, dlurl, hdr)
+			if err != nil {
+				return fetched{}, err
+			}
+			result.etag = etag
+			return result, nil
+		}
+	}
+	return fetched{}, fmt.Errorf("%q: no release asset matching %q", srcurl, glob)
+}
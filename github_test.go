@@ -0,0 +1,109 @@
+package getlatest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHubRelease(t *testing.T) {
+	var srv *httptest.Server
+	downloads := 0
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		asset := func(id int64, name string) githubAsset {
+			return githubAsset{
+				ID:                 id,
+				Name:               name,
+				URL:                srv.URL + "/api-asset/" + name,
+				BrowserDownloadURL: srv.URL + "/dl/" + name,
+				UpdatedAt:          "2024-01-02T03:04:05Z",
+			}
+		}
+		stable := githubRelease{TagName: "v1.0", Assets: []githubAsset{
+			asset(1, "tool-linux-amd64.tar.gz"),
+			asset(2, "tool-darwin-arm64.tar.gz"),
+		}}
+		pre := githubRelease{TagName: "v1.1-rc1", Prerelease: true, Assets: []githubAsset{
+			asset(3, "tool-linux-amd64-rc.tar.gz"),
+		}}
+		switch {
+		case req.URL.Path == "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(stable)
+		case req.URL.Path == "/repos/owner/repo/releases":
+			json.NewEncoder(w).Encode([]githubRelease{{TagName: "v2-draft", Draft: true}, pre, stable})
+		case strings.HasPrefix(req.URL.Path, "/dl/"):
+			downloads++
+			w.Write([]byte("content of " + strings.TrimPrefix(req.URL.Path, "/dl/")))
+		case strings.HasPrefix(req.URL.Path, "/api-asset/"):
+			if req.Header.Get("Accept") != "application/octet-stream" || req.Header.Get("Authorization") != "Bearer s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			downloads++
+			w.Write([]byte("private " + strings.TrimPrefix(req.URL.Path, "/api-asset/")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		glob       string
+		prerelease bool
+		token      string
+		expect     string
+	}{
+		{"*-linux-amd64*", false, "", "content of tool-linux-amd64.tar.gz"},
+		{"*-linux-amd64*", true, "", "content of tool-linux-amd64-rc.tar.gz"},
+		{"*-darwin-*", true, "", "content of tool-darwin-arm64.tar.gz"},
+		{"*-linux-amd64*", false, "s3cr3t", "private tool-linux-amd64.tar.gz"},
+		{"*.zip", false, "", ""},
+	} {
+		downloads = 0
+		g := &Getter{
+			URL:              "github-release://owner/repo/" + trial.glob,
+			Output:           filepath.Join(t.TempDir(), "tool.tar.gz"),
+			GitHubAPI:        srv.URL,
+			GitHubPrerelease: trial.prerelease,
+			BearerToken:      trial.token,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil || !strings.Contains(err.Error(), "no release asset") {
+				t.Errorf("%+v: expected no-match error, got %v", trial, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+			continue
+		}
+		buf, _ := ioutil.ReadFile(g.Output)
+		if string(buf) != trial.expect {
+			t.Errorf("%+v: got %q", trial, buf)
+		}
+		// Same asset: don't download again.
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		}
+		if downloads != 1 {
+			t.Errorf("%+v: downloaded %d times", trial, downloads)
+		}
+	}
+
+	for _, bad := range []string{"github-release://owner/repo", "github-release://owner//x", "github-release://owner/repo/[x"} {
+		g := &Getter{URL: bad, Output: filepath.Join(t.TempDir(), "x")}
+		if err := g.Setup(); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// fetchHedged tries mirrors in order, like trydownload, except that
+// if the most recently started attempt hasn't received a response
+// header within HedgeAfter, the next mirror is started in parallel
+// (into a separate tempfile) without cancelling the earlier
+// attempts. When an attempt fails, the next mirror is started right
+// away. The first attempt to succeed wins, and the others are
+// cancelled.
+//
+// It returns the tempfile holding the winning download, which is
+// either f or a new tempfile. All other tempfiles, including f if it
+// isn't the winner, are closed and removed.
+func (g *Getter) fetchHedged(ctx context.Context, f *os.File, mirrors []mirror) (*os.File, string, mirror, fetched, error) {
+	type result struct {
+		i       int
+		url     string
+		fetched fetched
+		err     error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(mirrors))
+	headers := make(chan int, len(mirrors)) // index of each attempt that gets a response header
+	var files []*os.File
+	var finished, gotHeader []bool
+	running := 0
+	start := func() error {
+		i := len(files)
+		af := f
+		if i > 0 {
+			var err error
+			af, err = g.tempFile()
+			if err != nil {
+				return fmt.Errorf("error creating tempfile: %s", err)
+			}
+		}
+		files = append(files, af)
+		finished = append(finished, false)
+		gotHeader = append(gotHeader, false)
+		var once sync.Once
+		actx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotFirstResponseByte: func() { once.Do(func() { headers <- i }) },
+		})
+		running++
+		go func() {
+			url, err := g.expand(mirrors[i].urlt)
+			if err != nil {
+				results <- result{i: i, err: fmt.Errorf("error getting url: %s", err)}
+				return
+			}
+			g.logger().Info("downloading", "url", url)
+			fetched, err := g.fetchMinSpeed(actx, af, url)
+			results <- result{i, url, fetched, err}
+		}()
+		return nil
+	}
+
+	var winner *result
+	var err error
+	if err := start(); err != nil {
+		return f, "", mirror{}, fetched{}, err
+	}
+	timer := time.NewTimer(g.hedgeAfter)
+	defer timer.Stop()
+	for running > 0 {
+		select {
+		case i := <-headers:
+			gotHeader[i] = true
+			if !finished[i] {
+				// Don't start any more attempts while
+				// this one is receiving the response
+				// body.
+				timer.Stop()
+			}
+		case <-timer.C:
+			if winner == nil && len(files) < len(mirrors) {
+				g.logger().Warn("no response yet, also trying next mirror", "mirror", mirrors[len(files)].config, "hedgeAfter", g.hedgeAfter)
+				if err := start(); err != nil {
+					g.logger().Warn("cannot start hedged request", "error", err)
+				} else {
+					timer.Reset(g.hedgeAfter)
+				}
+			}
+		case r := <-results:
+			running--
+			finished[r.i] = true
+			if winner != nil {
+				continue
+			} else if r.err == nil || r.err == errNotModified {
+				winner = &r
+				cancel()
+				continue
+			}
+			err = r.err
+			if len(files) < len(mirrors) && ctx.Err() == nil {
+				g.logger().Warn("trying next mirror", "error", err)
+				if err := start(); err != nil {
+					if running == 0 {
+						return g.keepFile(files, 0), "", mirror{}, fetched{}, err
+					}
+					g.logger().Warn("cannot start next mirror", "error", err)
+					continue
+				}
+				// Resume hedging unless another
+				// attempt is receiving a response body.
+				receiving := false
+				for i := range files {
+					receiving = receiving || (gotHeader[i] && !finished[i])
+				}
+				if !receiving {
+					timer.Reset(g.hedgeAfter)
+				}
+			}
+		}
+	}
+	if winner == nil {
+		return g.keepFile(files, 0), "", mirror{}, fetched{}, err
+	}
+	return g.keepFile(files, winner.i), winner.url, mirrors[winner.i], winner.fetched, winner.err
+}
+
+// keepFile closes and removes all of the given files except
+// files[keep], and returns files[keep].
+func (g *Getter) keepFile(files []*os.File, keep int) *os.File {
+	for i, f := range files {
+		if i != keep {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	return files[keep]
+}
@@ -0,0 +1,142 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow":
+			select {
+			case <-time.After(5 * time.Second):
+			case <-req.Context().Done():
+				return
+			}
+			w.Write([]byte("slow\n"))
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/truncated":
+			// Fail after sending the response header.
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		default:
+			w.Write([]byte(req.URL.Path[1:] + "\n"))
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		urls   []string
+		expect string // "" means error
+	}{
+		{[]string{"/slow", "/fast"}, "fast\n"},
+		{[]string{"/fail", "/slow", "/fast"}, "fast\n"},
+		{[]string{"/fast", "/slow"}, "fast\n"},
+		{[]string{"/fail", "/fail"}, ""},
+		// The next mirror is started when an attempt fails,
+		// even if another one is still running.
+		{[]string{"/slow", "/truncated", "/fast"}, "fast\n"},
+	} {
+		dir := t.TempDir()
+		g := &Getter{
+			URL:        srv.URL + trial.urls[0],
+			Output:     filepath.Join(dir, "out"),
+			HedgeAfter: "100ms",
+		}
+		for _, u := range trial.urls[1:] {
+			g.URLs = append(g.URLs, srv.URL+u)
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		t0 := time.Now()
+		err := g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("%v: expected error", trial.urls)
+			}
+		} else if err != nil {
+			t.Errorf("%v: %s", trial.urls, err)
+		} else if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.expect {
+			t.Errorf("%v: output %q, %v", trial.urls, buf, err)
+		}
+		if d := time.Since(t0); d > 2*time.Second {
+			t.Errorf("%v: took %s", trial.urls, d)
+		}
+		// Tempfiles from the cancelled attempts should be
+		// removed.
+		ents, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trial.expect != "" && len(ents) != 1 || trial.expect == "" && len(ents) != 0 {
+			for _, ent := range ents {
+				t.Errorf("%v: leftover file %q", trial.urls, ent.Name())
+			}
+		}
+	}
+
+	g := &Getter{URL: srv.URL, Output: filepath.Join(t.TempDir(), "out"), HedgeAfter: "1s", Resume: true}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error using HedgeAfter with Resume")
+	}
+}
+
+func TestHedgeMinSpeed(t *testing.T) {
+	var trickleCancelled atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/trickle":
+			time.Sleep(200 * time.Millisecond)
+			for {
+				w.Write([]byte("."))
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(50 * time.Millisecond):
+				case <-req.Context().Done():
+					trickleCancelled.Store(true)
+					return
+				}
+			}
+		case "/big":
+			chunk := make([]byte, 8192)
+			for i := 0; i < 30; i++ {
+				w.Write(chunk)
+				w.(http.Flusher).Flush()
+				time.Sleep(100 * time.Millisecond)
+			}
+			if !trickleCancelled.Load() {
+				t.Error("trickle attempt was not cancelled by MinSpeed")
+			}
+		}
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:        srv.URL + "/trickle",
+		URLs:       []string{srv.URL + "/big"},
+		Output:     filepath.Join(t.TempDir(), "out"),
+		HedgeAfter: "100ms",
+		MinSpeed:   "10KB/s over 1s",
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(g.Output); err != nil || fi.Size() != 30*8192 {
+		t.Errorf("output %v, %v", fi, err)
+	}
+}
@@ -0,0 +1,239 @@
+package getlatest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const skipDateFormat = "2006-01-02"
+
+var (
+	// holidaysRefresh is the time between HolidayCalendars
+	// fetches. After a failure, the next fetch is attempted after
+	// holidaysRetry.
+	holidaysRefresh = 24 * time.Hour
+	holidaysRetry   = time.Hour
+	holidaysTimeout = time.Minute
+
+	// holidaysMaxSize is the maximum size of a HolidayCalendars
+	// file.
+	holidaysMaxSize int64 = 16 << 20
+)
+
+// setupSkipDates parses SkipDates and SkipDatesFile, and checks
+// HolidayCalendars.
+func (g *Getter) setupSkipDates() error {
+	g.skipDates = nil
+	dates := g.SkipDates
+	if g.SkipDatesFile != "" {
+		buf, err := g.readSetupFile(g.SkipDatesFile)
+		if err != nil {
+			return fmt.Errorf("error reading SkipDatesFile: %s", err)
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				dates = append(dates, line)
+			}
+		}
+	}
+	for _, s := range dates {
+		d, err := time.Parse(skipDateFormat, strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid skip date %q (should be like 2006-01-02)", s)
+		}
+		if g.skipDates == nil {
+			g.skipDates = map[string]bool{}
+		}
+		g.skipDates[d.Format(skipDateFormat)] = true
+	}
+	for _, s := range g.HolidayCalendars {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid HolidayCalendars URL %q (must be http or https)", s)
+		}
+	}
+	return nil
+}
+
+// skipDate returns true if t (which should already be in
+// g.location()) falls on a SkipDates or HolidayCalendars date. The
+// caller must hold g.mtx, or be the check goroutine.
+func (g *Getter) skipDate(t time.Time) bool {
+	if g.skipDates == nil && g.holidays == nil {
+		return false
+	}
+	date := t.Format(skipDateFormat)
+	return g.skipDates[date] || g.holidays[date]
+}
+
+// refreshHolidays fetches HolidayCalendars if they have not been
+// fetched recently. If any of them can't be fetched or parsed, the
+// error is logged and the previously fetched dates (if any) are kept.
+func (g *Getter) refreshHolidays(ctx context.Context, now time.Time) {
+	if len(g.HolidayCalendars) == 0 || now.Before(g.holidaysCheck) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, holidaysTimeout)
+	defer cancel()
+	holidays := map[string]bool{}
+	for _, s := range g.HolidayCalendars {
+		err := g.fetchHolidays(ctx, s, holidays)
+		if err != nil {
+			g.logger().Error("error fetching holiday calendar", "error", err)
+			g.holidaysCheck = now.Add(holidaysRetry)
+			return
+		}
+	}
+	g.logger().Info("fetched holiday calendars", "dates", len(holidays))
+	g.mtx.Lock()
+	g.holidays = holidays
+	g.mtx.Unlock()
+	g.holidaysCheck = now.Add(holidaysRefresh)
+}
+
+// fetchHolidays downloads an iCalendar file and adds the dates of its
+// events to holidays. Calendar URLs are usually public (or contain a
+// secret token), so the target's authentication headers are not
+// sent.
+func (g *Getter) fetchHolidays(ctx context.Context, calurl string, holidays map[string]bool) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", calurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+	resp, err := (&http.Client{Transport: g.transport()}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%q: %s", req.URL.Redacted(), resp.Status)
+	}
+	err = parseICalendar(io.LimitReader(resp.Body, holidaysMaxSize), g.location(), holidays)
+	if err != nil {
+		return fmt.Errorf("%q: %s", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// parseICalendar adds the dates covered by each VEVENT in an
+// iCalendar (RFC 5545) file to dates. All-day events cover the dates
+// from DTSTART up to, but not including, DTEND. Events with a time
+// of day cover the dates (in loc) from their start to end times.
+// Recurrence rules are not expanded, but published holiday calendars
+// normally list each occurrence as a separate event.
+func parseICalendar(r io.Reader, loc *time.Location, dates map[string]bool) error {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			// Unfold a continuation line.
+			lines[len(lines)-1] += line[1:]
+		} else {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return fmt.Errorf("not an iCalendar file")
+	}
+	inEvent := false
+	var start, end time.Time
+	var allDay bool
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent = true
+				start, end, allDay = time.Time{}, time.Time{}, false
+			}
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			t, date, err := parseICalendarTime(value, params, loc)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, value, err)
+			}
+			if strings.EqualFold(name, "DTSTART") {
+				start, allDay = t, date
+			} else {
+				end = t
+			}
+		case "END":
+			if !inEvent || !strings.EqualFold(value, "VEVENT") {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				continue
+			}
+			if allDay {
+				if !end.After(start) {
+					end = start.AddDate(0, 0, 1)
+				}
+				end = end.AddDate(0, 0, -1)
+			} else if end.After(start) {
+				// DTEND is exclusive.
+				end = end.Add(-time.Nanosecond)
+			} else {
+				end = start
+			}
+			// Limit the number of dates added by a single
+			// (bogus) long event.
+			for d, n := start, 0; !d.After(end) && n < 366; d, n = d.AddDate(0, 0, 1), n+1 {
+				dates[d.Format(skipDateFormat)] = true
+			}
+			if !allDay {
+				dates[end.Format(skipDateFormat)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// parseICalendarTime parses a DTSTART or DTEND value, which is
+// either a date (20061225) or a date-time (20061225T150405, with a Z
+// suffix for UTC or a TZID parameter). It returns the time in loc,
+// and whether the value is a date. Date values are returned as
+// midnight in loc.
+func parseICalendarTime(value, params string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.In(loc), false, err
+	}
+	tzloc := loc
+	for _, param := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(param, "=")
+		if strings.EqualFold(k, "TZID") {
+			if l, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+				tzloc = l
+			}
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, tzloc)
+	return t.In(loc), false, err
+}
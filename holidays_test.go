@@ -0,0 +1,176 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSkipDates(t *testing.T) {
+	datesFile := filepath.Join(t.TempDir(), "dates")
+	ioutil.WriteFile(datesFile, []byte("# holidays\n2019-12-25\n\n2019-12-26 # boxing day\n"), 0666)
+	g := &Getter{
+		URL:           "http://host.example/foo",
+		Timezone:      "America/New_York",
+		SkipDates:     []string{"2019-12-24", "2020-01-01"},
+		SkipDatesFile: datesFile,
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, trial := range []struct {
+		time   string
+		should bool
+	}{
+		{"2019-12-23T12:00:00Z", true},
+		{"2019-12-24T12:00:00Z", false},
+		{"2019-12-25T12:00:00Z", false},
+		{"2019-12-26T12:00:00Z", false},
+		{"2019-12-27T02:00:00Z", false}, // still 12-26 in New York
+		{"2019-12-27T12:00:00Z", true},
+		{"2020-01-01T12:00:00Z", false},
+	} {
+		now, err := time.Parse(time.RFC3339, trial.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.should(now); got != trial.should {
+			t.Errorf("%s: expected %v, got %v", trial.time, trial.should, got)
+		}
+	}
+	if next, expect := g.nextEligible(time.Date(2019, 12, 24, 12, 0, 0, 0, time.UTC)), time.Date(2019, 12, 27, 5, 0, 0, 0, time.UTC); !next.Equal(expect) {
+		t.Errorf("nextEligible: expected %s, got %s", expect, next)
+	}
+
+	for _, g := range []*Getter{
+		{SkipDates: []string{"12/25/2019"}},
+		{SkipDates: []string{"2019-02-30"}},
+		{SkipDatesFile: filepath.Join(t.TempDir(), "nonexistent")},
+		{HolidayCalendars: []string{"/etc/holidays.ics"}},
+	} {
+		g.URL = "http://host.example/foo"
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected error", g)
+		}
+	}
+}
+
+func TestParseICalendar(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics := strings.Replace(`BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20191225
+DTEND;VALUE=DATE:20191226
+SUMMARY:Christmas Day
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20191231
+DTEND;VALUE=DATE:20200102
+SUMMARY:A long
+ folded summary
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20200120
+SUMMARY:No DTEND
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20200215T230000Z
+DTEND:20200216T010000Z
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;TZID=Europe/London:20200301T090000
+DTEND;TZID=Europe/London:20200302T000000
+END:VEVENT
+END:VCALENDAR
+`, "\n", "\r\n", -1)
+	dates := map[string]bool{}
+	err = parseICalendar(strings.NewReader(ics), loc, dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for d := range dates {
+		got = append(got, d)
+	}
+	sort.Strings(got)
+	expect := []string{"2019-12-25", "2019-12-31", "2020-01-01", "2020-01-20", "2020-02-15", "2020-03-01"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+
+	err = parseICalendar(strings.NewReader("<html>\n"), loc, dates)
+	if err == nil {
+		t.Error("expected error for non-iCalendar input")
+	}
+	err = parseICalendar(strings.NewReader("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\nEND:VCALENDAR\n"), loc, dates)
+	if err == nil {
+		t.Error("expected error for invalid DTSTART")
+	}
+}
+
+func TestHolidayCalendars(t *testing.T) {
+	status := http.StatusOK
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("Authorization") != "" {
+			t.Error("calendar request has Authorization header")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20191225\nEND:VEVENT\nEND:VCALENDAR\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:              "http://host.example/foo",
+		Timezone:         "UTC",
+		BearerToken:      "secret",
+		HolidayCalendars: []string{srv.URL + "/holidays.ics"},
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 12, 24, 12, 0, 0, 0, time.UTC)
+	christmas := now.Add(24 * time.Hour)
+	g.refreshHolidays(context.Background(), now)
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+	if g.should(christmas) {
+		t.Error("should() returned true on holiday")
+	}
+	if !g.should(now) {
+		t.Error("should() returned false on non-holiday")
+	}
+
+	// Not refreshed again until holidaysRefresh has passed.
+	g.refreshHolidays(context.Background(), now.Add(time.Hour))
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+
+	// Previous dates are kept after a failed refresh.
+	status = http.StatusInternalServerError
+	g.refreshHolidays(context.Background(), now.Add(holidaysRefresh))
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if g.should(christmas) {
+		t.Error("should() returned true on holiday after failed refresh")
+	}
+	g.refreshHolidays(context.Background(), now.Add(holidaysRefresh+holidaysRetry/2))
+	if requests != 2 {
+		t.Errorf("expected retry after holidaysRetry, got %d requests", requests)
+	}
+}
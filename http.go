@@ -0,0 +1,578 @@
+package getlatest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth2 configures the OAuth2 client credentials flow. Tokens are
+// obtained from TokenURL and refreshed automatically when they
+// expire.
+type OAuth2 struct {
+	TokenURL         string
+	ClientID         string
+	ClientSecret     string
+	ClientSecretFile string
+	Scopes           []string
+}
+
+// AWSSigV4 configures AWS Signature Version 4 signing of http(s)
+// requests, e.g., for API Gateway or OpenSearch endpoints.
+// Credentials are found using the standard AWS credential chain.
+type AWSSigV4 struct {
+	Region  string
+	Service string // e.g., "execute-api", "es", or "s3"
+}
+
+// setupHTTP prepares the http client used for http(s) URLs and
+// auxiliary files (checksums, etc.).
+func (g *Getter) setupHTTP() error {
+	if g.MaxRedirects < -1 {
+		return fmt.Errorf("invalid MaxRedirects %d", g.MaxRedirects)
+	}
+	if g.UnixSocket != "" && g.Proxy != "" {
+		return fmt.Errorf("cannot use Proxy with UnixSocket")
+	}
+	var rt http.RoundTripper = g.transport()
+	switch g.HTTPVersion {
+	case "", "1.1":
+	case "3":
+		if g.Proxy != "" || g.UnixSocket != "" {
+			return fmt.Errorf("cannot use Proxy or UnixSocket with HTTPVersion 3")
+		}
+		rt = g.http3Transport(rt)
+	default:
+		return fmt.Errorf("invalid HTTPVersion %q (must be 1.1 or 3)", g.HTTPVersion)
+	}
+	g.client = &http.Client{Transport: rt}
+	n := 0
+	for _, s := range []string{g.BearerToken, g.BearerTokenFile} {
+		if s != "" {
+			n++
+		}
+	}
+	if g.OAuth2 != nil {
+		n++
+	}
+	if g.AWSSigV4 != nil {
+		n++
+	}
+	if g.Auth != nil {
+		n++
+	}
+	if n > 1 {
+		return fmt.Errorf("cannot use more than one of BearerToken, BearerTokenFile, OAuth2, AWSSigV4, Auth")
+	}
+	if o := g.OAuth2; o != nil {
+		if o.TokenURL == "" || o.ClientID == "" {
+			return fmt.Errorf("OAuth2 requires TokenURL and ClientID")
+		}
+		secret := o.ClientSecret
+		if o.ClientSecretFile != "" {
+			buf, err := g.readSetupFile(o.ClientSecretFile)
+			if err != nil {
+				return fmt.Errorf("error reading OAuth2 ClientSecretFile: %s", err)
+			}
+			secret = strings.TrimSpace(string(buf))
+		}
+		cc := clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: secret,
+			TokenURL:     o.TokenURL,
+			Scopes:       o.Scopes,
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, g.client)
+		g.client = cc.Client(ctx)
+	}
+	if g.Auth != nil {
+		rt, err := g.setupHTTPAuth(g.client.Transport)
+		if err != nil {
+			return err
+		}
+		g.client.Transport = rt
+	}
+	g.client.CheckRedirect = g.checkRedirect
+	if s := g.AWSSigV4; s != nil {
+		if s.Region == "" || s.Service == "" {
+			return fmt.Errorf("AWSSigV4 requires Region and Service")
+		}
+		cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s.Region))
+		if err != nil {
+			return fmt.Errorf("error loading AWS config: %s", err)
+		}
+		g.client.Transport = &sigv4Transport{
+			base:    g.client.Transport,
+			creds:   cfg.Credentials,
+			signer:  v4.NewSigner(),
+			region:  s.Region,
+			service: s.Service,
+		}
+	}
+	return nil
+}
+
+// checkRedirect returns an error if MaxRedirects or
+// ForbidRedirectToOtherHost prohibit following a redirect to req.
+// via holds the requests made so far, oldest first.
+func (g *Getter) checkRedirect(req *http.Request, via []*http.Request) error {
+	limit := g.MaxRedirects
+	if limit == 0 {
+		limit = 10
+	}
+	if limit < 0 {
+		return fmt.Errorf("redirect to %q refused (MaxRedirects is -1)", req.URL.Redacted())
+	} else if len(via) > limit {
+		return fmt.Errorf("stopped after %d redirects (MaxRedirects)", limit)
+	}
+	if g.ForbidRedirectToOtherHost && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("redirect to other host %q refused (ForbidRedirectToOtherHost)", req.URL.Host)
+	}
+	return nil
+}
+
+// emptyPayloadHash is the SHA256 hash of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sigv4Transport signs each request (including redirects and
+// retries) with AWS Signature Version 4 before sending it.
+type sigv4Transport struct {
+	base    http.RoundTripper
+	creds   aws.CredentialsProvider
+	signer  *v4.Signer
+	region  string
+	service string
+}
+
+func (t *sigv4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	creds, err := t.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting AWS credentials: %s", err)
+	}
+	// A RoundTripper must not modify the caller's request.
+	req = req.Clone(ctx)
+	if t.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	}
+	err = t.signer.SignHTTP(ctx, creds, req, emptyPayloadHash, t.service, t.region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error signing request: %s", err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// setupProxy prepares the proxy func used by transport().
+func (g *Getter) setupProxy() error {
+	if g.Proxy == "" && g.NoProxy == "" {
+		g.proxy = nil
+		return nil
+	}
+	cfg := httpproxy.FromEnvironment()
+	if g.Proxy != "" {
+		u, err := url.Parse(g.Proxy)
+		if err != nil {
+			return fmt.Errorf("error parsing Proxy %q: %s", g.Proxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported Proxy scheme %q (must be http, https, or socks5)", u.Scheme)
+		}
+		cfg.HTTPProxy = g.Proxy
+		cfg.HTTPSProxy = g.Proxy
+	}
+	if g.NoProxy != "" {
+		cfg.NoProxy = g.NoProxy
+	}
+	g.proxy = cfg.ProxyFunc()
+	return nil
+}
+
+// setupTLS prepares the TLS config used by transport().
+func (g *Getter) setupTLS() error {
+	g.tlsConfig = nil
+	if (g.TLSCert == "") != (g.TLSKey == "") {
+		return fmt.Errorf("TLSCert and TLSKey must be used together")
+	}
+	if g.TLSCert == "" && g.TLSCACert == "" && len(g.PinnedSPKIHashes) == 0 {
+		return nil
+	}
+	cfg := &tls.Config{}
+	if len(g.PinnedSPKIHashes) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range g.PinnedSPKIHashes {
+			pin = strings.TrimPrefix(pin, "sha256/")
+			if buf, err := base64.StdEncoding.DecodeString(pin); err != nil || len(buf) != sha256.Size {
+				return fmt.Errorf("invalid PinnedSPKIHashes entry %q (must be a base64-encoded SHA-256 hash)", pin)
+			}
+			pins[pin] = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPinnedSPKI(cs, pins)
+		}
+	}
+	if g.TLSCert != "" {
+		certPEM, err := g.readSetupFile(g.TLSCert)
+		if err != nil {
+			return fmt.Errorf("error loading TLSCert/TLSKey: %s", err)
+		}
+		keyPEM, err := g.readSetupFile(g.TLSKey)
+		if err != nil {
+			return fmt.Errorf("error loading TLSCert/TLSKey: %s", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("error loading TLSCert/TLSKey: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if g.TLSCACert != "" {
+		buf, err := g.readSetupFile(g.TLSCACert)
+		if err != nil {
+			return fmt.Errorf("error reading TLSCACert: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("no PEM certificates found in TLSCACert %q", g.TLSCACert)
+		}
+		cfg.RootCAs = pool
+	}
+	g.tlsConfig = cfg
+	return nil
+}
+
+// checkPinnedSPKI returns an error unless one of the certificates sent
+// by the server, or in the verified chain (which may include a root
+// CA), has a public key whose hash is in pins.
+func checkPinnedSPKI(cs tls.ConnectionState, pins map[string]bool) error {
+	certs := cs.PeerCertificates
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if pins[base64.StdEncoding.EncodeToString(hash[:])] {
+			return nil
+		}
+	}
+	return fmt.Errorf("server certificate chain does not match PinnedSPKIHashes")
+}
+
+// transport returns an http.RoundTripper with the configured
+// timeouts.
+func (g *Getter) transport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = g.dialContext
+	tr.TLSHandshakeTimeout = g.connectTimeout
+	tr.ResponseHeaderTimeout = g.headerTimeout
+	if g.HTTPVersion == "1.1" {
+		tr.Protocols = new(http.Protocols)
+		tr.Protocols.SetHTTP1(true)
+	}
+	if g.tlsConfig != nil {
+		tr.TLSClientConfig = g.tlsConfig.Clone()
+	}
+	if g.proxy != nil {
+		proxy := g.proxy
+		tr.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+	return tr
+}
+
+// newRequest returns a GET request for the given URL, with
+// authorization headers as configured.
+func (g *Getter) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+	for k, v := range g.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	token := g.BearerToken
+	if g.BearerTokenFile != "" {
+		// Read the file every time, so the token can be
+		// rotated without reloading the config.
+		buf, err := ioutil.ReadFile(g.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading BearerTokenFile: %s", err)
+		}
+		token = strings.TrimSpace(string(buf))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if g.OAuth2 == nil && g.AWSSigV4 == nil && g.Auth == nil && req.URL.User == nil {
+		netrc, err := g.netrcLogin(req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		if netrc != nil {
+			req.SetBasicAuth(netrc.login, netrc.password)
+		}
+	}
+	return req, nil
+}
+
+// fetchAux retrieves a small auxiliary file (checksum, signature,
+// etc.) into memory.
+func (g *Getter) fetchAux(ctx context.Context, url string) ([]byte, error) {
+	req, err := g.newRequest(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", url, err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%q: non-OK response: %d %q", url, resp.StatusCode, resp.Status)
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", url, err)
+	}
+	return buf, nil
+}
+
+// fetchHTTP downloads url to f. Headers in hdr, if any, are added to
+// the request.
+func (g *Getter) fetchHTTP(ctx context.Context, f *os.File, url string, hdr http.Header) (fetched, error) {
+	req, err := g.newRequest(ctx, url)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", url, err)
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	if g.HeadCheck && g.haveOutput() && (g.etag != "" || g.modtime != "") && g.headUnchanged(req) {
+		return fetched{}, errNotModified
+	}
+	if g.haveOutput() {
+		if g.etag != "" {
+			req.Header.Set("If-None-Match", g.etag)
+		}
+		if g.modtime != "" {
+			req.Header.Set("If-Modified-Since", g.modtime)
+		}
+	}
+	if g.Chunks > 1 {
+		fetched, ok, err := g.fetchChunks(ctx, f, req)
+		if ok {
+			return fetched, err
+		}
+	}
+	var offset int64
+	if g.Resume && g.partialValidator != "" {
+		offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return fetched{}, fmt.Errorf("error seeking partial file: %s", err)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", g.partialValidator)
+		}
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", url, err)
+	}
+	defer resp.Body.Close()
+	g.logger().Debug("response", "url", url, "status", resp.StatusCode, "protocol", resp.Proto)
+	httpResponseCountVec.WithLabelValues(g.Output, resp.Proto).Inc()
+	if resp.Request.URL.String() != url {
+		g.logger().Info("followed redirect", "url", url, "finalURL", resp.Request.URL.Redacted())
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if g.Resume {
+			g.partialValidator = ""
+		}
+		return fetched{}, errNotModified
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		if err := g.checkResponseHeaders(resp.Header); err != nil {
+			return fetched{}, fmt.Errorf("%q: %s", url, err)
+		}
+	}
+	if resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp) != offset {
+		// The partial file can't be resumed from here, and
+		// retrying the same range would fail the same way.
+		g.logger().Warn("unexpected Content-Range, discarding partial download", "url", url, "offset", offset, "contentRange", resp.Header.Get("Content-Range"))
+		resp.Body.Close()
+		g.partialValidator = ""
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			err = f.Truncate(0)
+		}
+		if err != nil {
+			return fetched{}, fmt.Errorf("error truncating tempfile: %s", err)
+		}
+		return g.fetchHTTP(ctx, f, url, hdr)
+	} else if resp.StatusCode == http.StatusPartialContent && offset > 0 {
+		g.logger().Info("resuming download", "url", url, "offset", offset)
+	} else if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && g.Resume {
+			g.partialValidator = ""
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if t, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				g.logger().Warn("server requested retry delay", "url", url, "status", resp.StatusCode, "retryAfter", t)
+				// With HedgeAfter, other fetches may be
+				// running concurrently.
+				g.mtx.Lock()
+				g.retryAfter = t
+				g.mtx.Unlock()
+			}
+		}
+		return fetched{}, fmt.Errorf("%q: non-OK response: %d %q", url, resp.StatusCode, resp.Status)
+	} else {
+		// Full content: discard any partial download.
+		offset = 0
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			err = f.Truncate(0)
+		}
+		if err != nil {
+			return fetched{}, fmt.Errorf("error truncating tempfile: %s", err)
+		}
+	}
+	etag := resp.Header.Get("Etag")
+	modtime := resp.Header.Get("Last-Modified")
+	if g.Resume {
+		// Weak ETags cannot be used with If-Range.
+		if etag != "" && !strings.HasPrefix(etag, "W/") {
+			g.partialValidator = etag
+		} else {
+			g.partialValidator = modtime
+		}
+	}
+	if resp.ContentLength >= 0 {
+		if err := g.checkMaximumSize(offset + resp.ContentLength); err != nil {
+			return fetched{}, err
+		}
+		if err := g.checkFreeSpace(resp.ContentLength); err != nil {
+			return fetched{}, err
+		}
+	}
+	n, err := g.copyBody(f, resp.Body, offset)
+	if err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", url, err)
+	}
+	return fetched{
+		size:    offset + n,
+		etag:    etag,
+		modtime: modtime,
+	}, nil
+}
+
+// headUnchanged sends a HEAD request with the same URL and headers as
+// req, and returns true if the response indicates the existing output
+// file is already up to date. If the HEAD request fails, it returns
+// false, so the caller proceeds with a normal GET request.
+func (g *Getter) headUnchanged(req *http.Request) bool {
+	req = req.Clone(req.Context())
+	req.Method = http.MethodHead
+	resp, err := g.client.Do(req)
+	if err != nil {
+		g.logger().Warn("HEAD request failed", "url", req.URL.Redacted(), "error", err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		g.logger().Warn("HEAD request failed", "url", req.URL.Redacted(), "status", resp.StatusCode)
+		return false
+	}
+	if etag := resp.Header.Get("Etag"); g.etag != "" && etag != "" {
+		if etag != g.etag {
+			return false
+		}
+	} else if modtime := resp.Header.Get("Last-Modified"); g.modtime != "" && modtime != "" {
+		if modtime != g.modtime {
+			return false
+		}
+	} else {
+		return false
+	}
+	if resp.ContentLength >= 0 && len(g.rewriters) == 0 && !g.Unpack && g.PipeTo == "" {
+		// If the content is rewritten (e.g., Decompress),
+		// unpacked, or piped, the output size is not
+		// comparable.
+		fi, err := os.Stat(g.Output)
+		if err != nil || fi.Size() != resp.ContentLength {
+			return false
+		}
+	}
+	g.logger().Debug("HEAD response matches existing output", "url", req.URL.Redacted())
+	return true
+}
+
+// checkResponseHeaders returns an error if the response headers do
+// not satisfy ExpectContentType and ExpectHeaders.
+func (g *Getter) checkResponseHeaders(h http.Header) error {
+	if err := g.checkContentType(h.Get("Content-Type")); err != nil {
+		return err
+	}
+	for k, want := range g.ExpectHeaders {
+		got, ok := h[http.CanonicalHeaderKey(k)]
+		if !ok {
+			return fmt.Errorf("missing expected response header %q", k)
+		}
+		if want != "" && (len(got) == 0 || got[0] != want) {
+			return fmt.Errorf("unexpected response header %s: %q (expected %q)", k, strings.Join(got, ", "), want)
+		}
+	}
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func parseRetryAfter(hdr string, now time.Time) (time.Time, bool) {
+	if hdr == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.ParseInt(hdr, 10, 64); err == nil && secs >= 0 {
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	if t, err := http.ParseTime(hdr); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// contentRangeStart returns the first byte offset indicated by the
+// response's Content-Range header, or -1 if the header is missing or
+// unparseable.
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end, size int64
+	cr := strings.Replace(resp.Header.Get("Content-Range"), "/*", "/-1", 1)
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return -1
+	}
+	return start
+}
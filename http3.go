@@ -0,0 +1,51 @@
+package getlatest
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Transport returns a RoundTripper that uses HTTP/3 for https
+// requests, and fallback for plain http requests (e.g., after a
+// redirect).
+func (g *Getter) http3Transport(fallback http.RoundTripper) http.RoundTripper {
+	cfg := &tls.Config{}
+	if g.tlsConfig != nil {
+		cfg = g.tlsConfig.Clone()
+	}
+	h3 := &http3.Transport{
+		TLSClientConfig: cfg,
+		QUICConfig: &quic.Config{
+			HandshakeIdleTimeout: g.connectTimeout,
+		},
+	}
+	if g.dialOverrides() {
+		h3.Dial = g.dialQUIC
+	}
+	return &h3Transport{h3: h3, fallback: fallback}
+}
+
+// dialQUIC is like dialContext, for HTTP/3 connections.
+func (g *Getter) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	addr, err := g.lookupAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+}
+
+type h3Transport struct {
+	h3       *http3.Transport
+	fallback http.RoundTripper
+}
+
+func (t *h3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.h3.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
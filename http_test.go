@@ -0,0 +1,833 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestAuth(t *testing.T) {
+	var tokenRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			tokenRequests++
+			if id, secret, _ := req.BasicAuth(); id != "myid" || secret != "mysecret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"oauthtoken","token_type":"bearer","expires_in":3600}`))
+		case "/foo":
+			if req.Header.Get("Authorization") != "Bearer "+req.URL.Query().Get("expect") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("hello\n"))
+		}
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	tokenfile := filepath.Join(tmpdir, "token")
+	err := ioutil.WriteFile(tokenfile, []byte("filetoken\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*Getter{
+		{URL: srv.URL + "/foo?expect=statictoken", BearerToken: "statictoken"},
+		{URL: srv.URL + "/foo?expect=filetoken", BearerTokenFile: tokenfile},
+		{URL: srv.URL + "/foo?expect=oauthtoken", OAuth2: &OAuth2{
+			TokenURL:     srv.URL + "/token",
+			ClientID:     "myid",
+			ClientSecret: "mysecret",
+		}},
+	} {
+		g.Output = filepath.Join(tmpdir, "foo")
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err = g.trydownload(context.Background())
+			if err != nil {
+				t.Errorf("%s: %s", g.URL, err)
+			}
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, got %d", tokenRequests)
+	}
+}
+
+func TestAWSSigV4(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		auths = append(auths, auth)
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") ||
+			!strings.Contains(auth, "/us-west-2/execute-api/aws4_request") ||
+			req.Header.Get("X-Amz-Date") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if req.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:      srv.URL + "/foo",
+		Output:   filepath.Join(t.TempDir(), "foo"),
+		AWSSigV4: &AWSSigV4{Region: "us-west-2", Service: "execute-api"},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(auths) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(auths))
+	}
+	// Conditional headers are added before signing.
+	if !strings.Contains(auths[1], "if-none-match") {
+		t.Errorf("If-None-Match not signed: %q", auths[1])
+	}
+
+	for _, g := range []*Getter{
+		{URL: srv.URL, Output: "/tmp/foo", AWSSigV4: &AWSSigV4{Service: "execute-api"}},
+		{URL: srv.URL, Output: "/tmp/foo", AWSSigV4: &AWSSigV4{Region: "us-west-2", Service: "es"}, BearerToken: "x"},
+	} {
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected Setup error", g.AWSSigV4)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var reqs []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req)
+		w.Header().Set("ETag", `"v1"`)
+		if len(reqs) == 1 {
+			// Send half of the content, then drop the
+			// connection.
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+		Resume: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	if fi, err := os.Stat(g.partialPath()); err != nil || fi.Size() != int64(len(content)/2) {
+		t.Fatalf("partial file: %v, %v", fi, err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := reqs[1].Header.Get("Range"); h != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Errorf("wrong Range header %q", h)
+	}
+	if h := reqs[1].Header.Get("If-Range"); h != `"v1"` {
+		t.Errorf("wrong If-Range header %q", h)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || !bytes.Equal(buf, content) {
+		t.Errorf("output file has %d bytes, %v", len(buf), err)
+	}
+	if _, err := os.Stat(g.partialPath()); !os.IsNotExist(err) {
+		t.Errorf("partial file should not exist: %v", err)
+	}
+}
+
+func TestResumeWrongContentRange(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var reqs []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req)
+		w.Header().Set("ETag", `"v1"`)
+		switch {
+		case len(reqs) == 1:
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case req.Header.Get("Range") != "":
+			// Ignore the requested offset.
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content)
+		default:
+			w.Write(content)
+		}
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+		Resume: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.trydownload(context.Background()); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 3 || reqs[1].Header.Get("Range") == "" || reqs[2].Header.Get("Range") != "" {
+		t.Errorf("expected a Range request followed by a full request, got %d requests", len(reqs))
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || !bytes.Equal(buf, content) {
+		t.Errorf("output file has %d bytes, %v", len(buf), err)
+	}
+	if _, err := os.Stat(g.partialPath()); !os.IsNotExist(err) {
+		t.Errorf("partial file should not exist: %v", err)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slowheader" {
+			time.Sleep(time.Second)
+		}
+		w.Write([]byte("hello\n"))
+		w.(http.Flusher).Flush()
+		if req.URL.Path == "/slowbody" {
+			time.Sleep(time.Second)
+		}
+	}))
+	defer srv.Close()
+
+	for _, g := range []*Getter{
+		{URL: srv.URL + "/slowheader", ResponseHeaderTimeout: "100ms"},
+		{URL: srv.URL + "/slowbody", DownloadTimeout: "100ms"},
+	} {
+		g.Output = filepath.Join(t.TempDir(), "foo")
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t0 := time.Now()
+		err = g.trydownload(context.Background())
+		if err == nil {
+			t.Errorf("%s: expected timeout error", g.URL)
+		} else if time.Since(t0) > 900*time.Millisecond {
+			t.Errorf("%s: took too long to time out: %s", g.URL, err)
+		}
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	var reqs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req.URL.Path)
+		if req.URL.Path != "/mirror3" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:    srv.URL + "/mirror1",
+		URLs:   []string{srv.URL + "/mirror2", srv.URL + "/mirror3", srv.URL + "/mirror4"},
+		Output: filepath.Join(t.TempDir(), "foo"),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(reqs) != "[/mirror1 /mirror2 /mirror3]" {
+		t.Errorf("unexpected requests %q", reqs)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = append(proxied, req.URL.String())
+		w.Write([]byte("hello\n"))
+	}))
+	defer proxy.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:    "http://host.example/foo",
+		Output: filepath.Join(tmpdir, "foo"),
+		Proxy:  proxy.URL,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://host.example/foo" {
+		t.Errorf("unexpected proxied requests %q", proxied)
+	}
+
+	g = &Getter{
+		URL:            "http://host.example/foo",
+		Output:         filepath.Join(tmpdir, "bar"),
+		Proxy:          proxy.URL,
+		NoProxy:        "other.example,.example",
+		ConnectTimeout: "1s",
+	}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.trydownload(context.Background())
+	if len(proxied) != 1 {
+		t.Errorf("NoProxy host was proxied: %q", proxied)
+	}
+
+	for _, bad := range []string{"ftp://proxy.example", "::"} {
+		g = &Getter{URL: "http://host.example/foo", Proxy: bad}
+		if err := g.Setup(); err == nil {
+			t.Errorf("expected error with Proxy %q", bad)
+		}
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	tmpdir := t.TempDir()
+	certfile, keyfile, clientCert := writeTestCert(t, tmpdir)
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+	cafile := filepath.Join(tmpdir, "ca.pem")
+	err := ioutil.WriteFile(cafile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, trial := range []struct {
+		g  *Getter
+		ok bool
+	}{
+		{&Getter{TLSCert: certfile, TLSKey: keyfile, TLSCACert: cafile}, true},
+		{&Getter{TLSCACert: cafile}, false},
+		{&Getter{TLSCert: certfile, TLSKey: keyfile}, false},
+	} {
+		g := trial.g
+		g.URL = srv.URL + "/foo"
+		g.Output = filepath.Join(tmpdir, "foo")
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%+v: expected error", trial)
+		}
+	}
+
+	g := &Getter{URL: srv.URL + "/foo", TLSCert: certfile}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error using TLSCert without TLSKey")
+	}
+}
+
+// writeTestCert writes a self-signed client certificate and key to
+// PEM files in dir.
+func writeTestCert(t *testing.T, dir string) (certfile, keyfile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "getlatest-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certfile = filepath.Join(dir, "client.crt")
+	keyfile = filepath.Join(dir, "client.key")
+	err = ioutil.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Foo") != "bar" || req.Host != "virtual.example" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	g := &Getter{
+		URL:     srv.URL + "/foo",
+		Output:  filepath.Join(t.TempDir(), "foo"),
+		Headers: map[string]string{"X-Foo": "bar", "Host": "virtual.example"},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpectHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/error" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>Service unavailable</html>\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("X-Export", "complete")
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path          string
+		contentType   string
+		expectHeaders map[string]string
+		ok            bool
+	}{
+		{"/foo", "text/csv", nil, true},
+		{"/foo", "text/*", nil, true},
+		{"/foo", "application/json", nil, false},
+		{"/error", "text/csv", nil, false},
+		{"/foo", "", map[string]string{"x-export": "complete"}, true},
+		{"/foo", "", map[string]string{"X-Export": ""}, true},
+		{"/foo", "", map[string]string{"X-Export": "partial"}, false},
+		{"/error", "", map[string]string{"X-Export": ""}, false},
+	} {
+		output := filepath.Join(t.TempDir(), "foo")
+		g := &Getter{
+			URL:               srv.URL + trial.path,
+			Output:            output,
+			ExpectContentType: trial.contentType,
+			ExpectHeaders:     trial.expectHeaders,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			if _, err := os.Stat(output); !os.IsNotExist(err) {
+				t.Errorf("%+v: output should not exist, got %v", trial, err)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	retryAfter := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:           srv.URL + "/foo",
+		Output:        filepath.Join(t.TempDir(), "foo"),
+		RetryInterval: "1m",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trial := range []struct {
+		retryAfter string
+		expect     time.Duration // expected deferral, 0 if none
+	}{
+		{"3600", time.Hour},
+		{time.Now().Add(2 * time.Hour).UTC().Format(http.TimeFormat), 2 * time.Hour},
+		{"", 0},
+		{"30", 0}, // sooner than normal backoff
+		{"864000", 24 * time.Hour},
+		{"bogus", 0},
+	} {
+		retryAfter = trial.retryAfter
+		g.succeeded()
+		now := time.Now()
+		err = g.trydownload(context.Background())
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		g.failed(now, err)
+		st := g.status()
+		if trial.expect == 0 {
+			if !st.DeferredUntil.IsZero() {
+				t.Errorf("Retry-After %q: unexpected DeferredUntil %s", trial.retryAfter, st.DeferredUntil)
+			}
+			if st.RetryAt != now.Add(time.Minute) {
+				t.Errorf("Retry-After %q: expected normal backoff, got RetryAt %s", trial.retryAfter, st.RetryAt)
+			}
+			continue
+		}
+		if d := st.DeferredUntil.Sub(now) - trial.expect; d < -2*time.Second || d > 2*time.Second {
+			t.Errorf("Retry-After %q: expected DeferredUntil %s, got %s", trial.retryAfter, now.Add(trial.expect), st.DeferredUntil)
+		}
+		if st.RetryAt != st.DeferredUntil {
+			t.Errorf("Retry-After %q: RetryAt %s != DeferredUntil %s", trial.retryAfter, st.RetryAt, st.DeferredUntil)
+		}
+		if g.should(now.Add(trial.expect - 3*time.Second)) {
+			t.Errorf("Retry-After %q: should not retry before deferral ends", trial.retryAfter)
+		}
+		if got := testutil.ToFloat64(g.deferGauge); got != float64(st.DeferredUntil.Unix()) {
+			t.Errorf("Retry-After %q: deferred-until metric %v, expected %v", trial.retryAfter, got, st.DeferredUntil.Unix())
+		}
+	}
+	g.succeeded()
+	if got := testutil.ToFloat64(g.deferGauge); got != 0 {
+		t.Errorf("deferred-until metric %v after success, expected 0", got)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("other\n"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(req.URL.Path, "/hops/%d", &n); err == nil && n > 0 {
+			http.Redirect(w, req, fmt.Sprintf("/hops/%d", n-1), http.StatusFound)
+		} else if req.URL.Path == "/other" {
+			http.Redirect(w, req, other.URL+"/foo", http.StatusFound)
+		} else {
+			w.Write([]byte("hello\n"))
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path         string
+		maxRedirects int
+		forbidOther  bool
+		ok           bool
+	}{
+		{"/hops/0", -1, false, true},
+		{"/hops/1", -1, false, false},
+		{"/hops/10", 0, false, true},
+		{"/hops/11", 0, false, false},
+		{"/hops/30", 30, false, true},
+		{"/hops/3", 2, false, false},
+		{"/other", 0, false, true},
+		{"/other", 0, true, false},
+		{"/hops/3", 0, true, true},
+	} {
+		g := &Getter{
+			URL:                       srv.URL + trial.path,
+			Output:                    filepath.Join(t.TempDir(), "foo"),
+			MaxRedirects:              trial.maxRedirects,
+			ForbidRedirectToOtherHost: trial.forbidOther,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%+v: %s", trial, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%+v: expected error", trial)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = append(got, req.Header.Get("User-Agent"))
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		userAgent string
+		headers   map[string]string
+		expect    string
+	}{
+		{expect: "getlatest/" + version()},
+		{userAgent: "example/1.0", expect: "example/1.0"},
+		{userAgent: "example/1.0", headers: map[string]string{"User-Agent": "override/2.0"}, expect: "override/2.0"},
+	} {
+		got = nil
+		g := Getter{
+			URL:       srv.URL + "/foo",
+			Output:    filepath.Join(t.TempDir(), "foo"),
+			UserAgent: trial.userAgent,
+			Headers:   trial.headers,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != trial.expect {
+			t.Errorf("expected User-Agent %q, got %q", trial.expect, got)
+		}
+	}
+}
+
+func TestHTTPVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto + "\n"))
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	tmpdir := t.TempDir()
+	cafile := filepath.Join(tmpdir, "ca.pem")
+	err := ioutil.WriteFile(cafile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: srv.TLS.Certificates}),
+	}
+	go h3srv.Serve(udp)
+	defer h3srv.Close()
+	h3url := fmt.Sprintf("https://%s/foo", udp.LocalAddr())
+
+	for i, trial := range []struct {
+		url         string
+		httpVersion string
+		expect      string
+	}{
+		{srv.URL + "/foo", "", "HTTP/2.0"},
+		{srv.URL + "/foo", "1.1", "HTTP/1.1"},
+		{h3url, "3", "HTTP/3.0"},
+	} {
+		g := &Getter{
+			URL:         trial.url,
+			Output:      filepath.Join(tmpdir, fmt.Sprintf("out%d", i)),
+			TLSCACert:   cafile,
+			HTTPVersion: trial.httpVersion,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatalf("%+v: %s", trial, err)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.expect+"\n" {
+			t.Errorf("%+v: got %q, %v", trial, buf, err)
+		}
+		if n := testutil.ToFloat64(httpResponseCountVec.WithLabelValues(g.Output, trial.expect)); n != 1 {
+			t.Errorf("%+v: response count metric %v", trial, n)
+		}
+	}
+
+	for _, bad := range []*Getter{
+		{URL: srv.URL, HTTPVersion: "2.5"},
+		{URL: srv.URL, HTTPVersion: "3", Proxy: "http://proxy.example"},
+	} {
+		if err := bad.Setup(); err == nil {
+			t.Errorf("%+v: expected Setup error", bad)
+		}
+	}
+}
+
+func TestHeadCheck(t *testing.T) {
+	content := "hello\n"
+	etag := `"1"`
+	reqs := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Ignores If-None-Match
+		reqs[req.Method]++
+		w.Header().Set("Etag", etag)
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:       srv.URL + "/foo",
+		Output:    filepath.Join(t.TempDir(), "foo"),
+		HeadCheck: true,
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, trial := range []struct {
+		content string
+		etag    string
+		head    int
+		get     int
+	}{
+		{"hello\n", `"1"`, 0, 1},  // no output file yet, no HEAD
+		{"hello\n", `"1"`, 1, 0},  // unchanged
+		{"hello!\n", `"1"`, 1, 1}, // same etag, different size
+		{"hello?\n", `"2"`, 1, 1}, // different etag
+	} {
+		content, etag = trial.content, trial.etag
+		reqs = map[string]int{}
+		if err := g.trydownload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if reqs["HEAD"] != trial.head || reqs["GET"] != trial.get {
+			t.Errorf("%+v: got requests %v", trial, reqs)
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != content {
+			t.Errorf("%+v: output %q, %v", trial, buf, err)
+		}
+	}
+}
+
+func TestPinnedSPKIHashes(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	tmpdir := t.TempDir()
+	cafile := filepath.Join(tmpdir, "ca.pem")
+	err := ioutil.WriteFile(cafile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	for _, trial := range []struct {
+		pins []string
+		ok   bool
+	}{
+		{[]string{pin}, true},
+		{[]string{"sha256/" + pin}, true},
+		{[]string{otherPin, pin}, true},
+		{[]string{otherPin}, false},
+	} {
+		g := &Getter{
+			URL:              srv.URL + "/foo",
+			Output:           filepath.Join(tmpdir, "foo"),
+			TLSCACert:        cafile,
+			PinnedSPKIHashes: trial.pins,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		err := g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%q: %s", trial.pins, err)
+		} else if !trial.ok && (err == nil || !strings.Contains(err.Error(), "PinnedSPKIHashes")) {
+			t.Errorf("%q: expected PinnedSPKIHashes error, got %v", trial.pins, err)
+		}
+	}
+
+	g := &Getter{URL: srv.URL, Output: filepath.Join(tmpdir, "foo"), PinnedSPKIHashes: []string{"abc"}}
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for invalid PinnedSPKIHashes entry")
+	}
+}
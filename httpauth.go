@@ -0,0 +1,249 @@
+package getlatest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// HTTPAuth configures challenge/response authentication for http(s)
+// URLs.
+type HTTPAuth struct {
+	Type         string // "digest" or "ntlm"
+	Username     string // for NTLM, optionally "DOMAIN\user"
+	Password     string
+	PasswordFile string
+}
+
+// setupHTTPAuth wraps base with a RoundTripper that performs the
+// configured authentication.
+func (g *Getter) setupHTTPAuth(base http.RoundTripper) (http.RoundTripper, error) {
+	a := g.Auth
+	if a.Username == "" {
+		return nil, fmt.Errorf("Auth requires Username")
+	}
+	password := a.Password
+	if a.PasswordFile != "" {
+		buf, err := g.readSetupFile(a.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Auth PasswordFile: %s", err)
+		}
+		password = strings.TrimSpace(string(buf))
+	}
+	switch strings.ToLower(a.Type) {
+	case "digest":
+		return &digestTransport{base: base, username: a.Username, password: password}, nil
+	case "ntlm":
+		return &ntlmTransport{
+			negotiator: ntlmssp.Negotiator{RoundTripper: base},
+			username:   a.Username,
+			password:   password,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid Auth Type %q (must be digest or ntlm)", a.Type)
+	}
+}
+
+// ntlmTransport performs NTLM (or Negotiate) authentication. The
+// NTLM handshake takes several requests on the same connection, so
+// it relies on the base transport's connection reuse.
+type ntlmTransport struct {
+	negotiator ntlmssp.Negotiator
+	username   string
+	password   string
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The negotiator gets credentials from the basic auth
+	// header, and only sends them if the server asks for basic
+	// auth.
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.negotiator.RoundTrip(req)
+}
+
+// digestTransport performs HTTP Digest authentication (RFC 7616).
+// After the first challenge, subsequent requests are authorized
+// preemptively using the same nonce, so they don't each need an
+// extra round trip.
+type digestTransport struct {
+	base     http.RoundTripper
+	username string
+	password string
+
+	mtx  sync.Mutex
+	chal *digestChallenge
+	nc   int // number of requests sent using chal.nonce
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string // "auth" or ""
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mtx.Lock()
+	chal := t.chal
+	t.nc++
+	nc := t.nc
+	t.mtx.Unlock()
+
+	send := func(chal *digestChallenge, nc int) (*http.Response, error) {
+		req := req.Clone(req.Context())
+		if chal != nil {
+			req.Header.Set("Authorization", chal.authorization(req, t.username, t.password, nc))
+		}
+		return t.base.RoundTrip(req)
+	}
+	resp, err := send(chal, nc)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	newChal := parseDigestChallenge(resp.Header.Values("Www-Authenticate"))
+	if newChal == nil || (chal != nil && newChal.nonce == chal.nonce) {
+		// Not a digest challenge, or our credentials were
+		// rejected.
+		return resp, nil
+	}
+	resp.Body.Close()
+	t.mtx.Lock()
+	t.chal = newChal
+	t.nc = 1
+	t.mtx.Unlock()
+	return send(newChal, 1)
+}
+
+// baseAlgorithm returns the upper-cased hash algorithm name, without
+// any "-sess" suffix.
+func (c *digestChallenge) baseAlgorithm() string {
+	return strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS")
+}
+
+// authorization returns the Authorization header value for req.
+func (c *digestChallenge) authorization(req *http.Request, username, password string, nc int) string {
+	cnonceBytes := make([]byte, 16)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	ncstr := fmt.Sprintf("%08x", nc)
+	uri := req.URL.RequestURI()
+	response := c.response(req.Method, uri, username, password, ncstr, cnonce)
+	hdr := fmt.Sprintf(`Digest username=%q, realm=%q, nonce=%q, uri=%q, response=%q`, username, c.realm, c.nonce, uri, response)
+	if c.algorithm != "" {
+		hdr += ", algorithm=" + c.algorithm
+	}
+	if c.opaque != "" {
+		hdr += fmt.Sprintf(", opaque=%q", c.opaque)
+	}
+	if c.qop == "auth" {
+		hdr += fmt.Sprintf(", qop=auth, nc=%s, cnonce=%q", ncstr, cnonce)
+	}
+	return hdr
+}
+
+// response returns the digest response value for the given request
+// method and URI.
+func (c *digestChallenge) response(method, uri, username, password, nc, cnonce string) string {
+	var newHash func() hash.Hash
+	switch c.baseAlgorithm() {
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		newHash = md5.New
+	}
+	h := func(s string) string {
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	if c.qop == "auth" {
+		return h(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+	}
+	return h(ha1 + ":" + c.nonce + ":" + ha2)
+}
+
+// parseDigestChallenge returns the first supported Digest challenge
+// in the given WWW-Authenticate header values, or nil if there is
+// none.
+func parseDigestChallenge(hdrs []string) *digestChallenge {
+	for _, hdr := range hdrs {
+		if len(hdr) < 7 || !strings.EqualFold(hdr[:7], "digest ") {
+			continue
+		}
+		params := parseAuthParams(hdr[7:])
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		switch c.baseAlgorithm() {
+		case "", "MD5", "SHA-256":
+		default:
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				// only auth-int is offered
+				continue
+			}
+		}
+		if c.nonce != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseAuthParams parses a comma-separated list of key=value or
+// key="quoted value" parameters. Keys are converted to lower case.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			var buf strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			val = buf.String()
+			s = s[min(i+1, len(s)):]
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			val, s = strings.TrimSpace(s[:comma]), s[comma:]
+		} else {
+			val, s = strings.TrimSpace(s), ""
+		}
+		params[key] = val
+	}
+}
@@ -0,0 +1,102 @@
+package getlatest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDigestResponse(t *testing.T) {
+	// Example from RFC 2617 section 3.5
+	c := parseDigestChallenge([]string{`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`})
+	if c == nil {
+		t.Fatal("challenge not parsed")
+	}
+	if c.realm != "testrealm@host.com" || c.qop != "auth" || c.opaque != "5ccc069c403ebaf9f0171e9517f40e41" {
+		t.Errorf("challenge parsed incorrectly: %+v", c)
+	}
+	got := c.response("GET", "/dir/index.html", "Mufasa", "Circle Of Life", "00000001", "0a4f113b")
+	if want := "6629fae49393a05397450978507c4ef1"; got != want {
+		t.Errorf("got response %s, expected %s", got, want)
+	}
+
+	for _, hdr := range []string{
+		`Basic realm="x"`,
+		`Digest realm="x", nonce="abc", qop="auth-int"`,
+		`Digest realm="x", nonce="abc", algorithm=SHA-512-256`,
+	} {
+		if c := parseDigestChallenge([]string{hdr}); c != nil {
+			t.Errorf("%s: expected nil, got %+v", hdr, c)
+		}
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	var reqs int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs++
+		chal := &digestChallenge{realm: "test", nonce: "nonce1", algorithm: "SHA-256", qop: "auth"}
+		auth := req.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Digest ") {
+			p := parseAuthParams(auth[7:])
+			if p["username"] == "admin" && p["nonce"] == chal.nonce &&
+				p["response"] == chal.response(req.Method, p["uri"], "admin", "secret", p["nc"], p["cnonce"]) {
+				w.Write([]byte("hello\n"))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="test", nonce="nonce1", algorithm=SHA-256, qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		password string
+		ok       bool
+		reqs     int
+	}{
+		// First request gets a challenge, second request is
+		// authorized preemptively.
+		{"secret", true, 3},
+		{"wrong", false, 3},
+	} {
+		reqs = 0
+		g := &Getter{
+			URL:    srv.URL + "/foo",
+			Output: filepath.Join(t.TempDir(), "foo"),
+			Auth:   &HTTPAuth{Type: "digest", Username: "admin", Password: trial.password},
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err = g.trydownload(context.Background())
+			if trial.ok && err != nil {
+				t.Errorf("password %q: %s", trial.password, err)
+			} else if !trial.ok && err == nil {
+				t.Errorf("password %q: expected error", trial.password)
+			}
+		}
+		if reqs != trial.reqs {
+			t.Errorf("password %q: expected %d requests, got %d", trial.password, trial.reqs, reqs)
+		}
+	}
+
+	for _, a := range []*HTTPAuth{
+		{Type: "digest"},
+		{Type: "kerberos", Username: "admin"},
+	} {
+		g := &Getter{URL: srv.URL, Output: "/tmp/foo", Auth: a}
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected Setup error", a)
+		}
+	}
+	g := &Getter{URL: srv.URL, Output: "/tmp/foo", Auth: &HTTPAuth{Type: "ntlm", Username: `DOMAIN\admin`, Password: "x"}}
+	if err := g.Setup(); err != nil {
+		t.Errorf("ntlm: %s", err)
+	}
+}
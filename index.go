@@ -0,0 +1,255 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// setupIndex checks the IndexURL options. If no URL is configured,
+// the URL obtained from the index is used as the only mirror.
+func (g *Getter) setupIndex() error {
+	g.indext = nil
+	g.linkSel, g.linkRx = nil, nil
+	html := g.LinkSelector != "" || g.LinkRegex != ""
+	modes := 0
+	for _, set := range []bool{g.IndexJSONPath != "", html, g.IndexFeed} {
+		if set {
+			modes++
+		}
+	}
+	if g.IndexURL == "" {
+		if modes > 0 || g.LinkLatest {
+			return fmt.Errorf("IndexJSONPath, LinkSelector, LinkRegex, LinkLatest, and IndexFeed require IndexURL")
+		}
+		return nil
+	}
+	if modes == 0 {
+		return fmt.Errorf("IndexURL requires IndexJSONPath, LinkSelector, LinkRegex, or IndexFeed")
+	} else if modes > 1 {
+		return fmt.Errorf("cannot use more than one of IndexJSONPath, LinkSelector/LinkRegex, IndexFeed")
+	}
+	if g.LinkLatest && !html {
+		return fmt.Errorf("LinkLatest requires LinkSelector or LinkRegex")
+	}
+	if g.IndexJSONPath != "" {
+		if _, err := parseJSONPath(g.IndexJSONPath); err != nil {
+			return fmt.Errorf("invalid IndexJSONPath %q: %s", g.IndexJSONPath, err)
+		}
+	}
+	if g.LinkSelector != "" {
+		sel, err := cascadia.Compile(g.LinkSelector)
+		if err != nil {
+			return fmt.Errorf("invalid LinkSelector %q: %s", g.LinkSelector, err)
+		}
+		g.linkSel = sel
+	}
+	if g.LinkRegex != "" {
+		rx, err := regexp.Compile(g.LinkRegex)
+		if err != nil {
+			return fmt.Errorf("invalid LinkRegex %q: %s", g.LinkRegex, err)
+		}
+		g.linkRx = rx
+	}
+	t, err := template.New("index").Parse(g.IndexURL)
+	if err != nil {
+		return fmt.Errorf("error parsing IndexURL %q: %s", g.IndexURL, err)
+	}
+	g.indext = t
+	if g.URL == "" && len(g.URLs) == 0 {
+		g.mirrors = []mirror{{
+			config: "{{.index}}",
+			urlt:   template.Must(template.New("url").Parse("{{.index}}")),
+		}}
+	}
+	return nil
+}
+
+// resolveIndex fetches the index at IndexURL and returns the value
+// found at IndexJSONPath, the link found by LinkSelector and
+// LinkRegex, or the link to the newest feed entry. If no URL is configured, the
+// value is the download URL, and is resolved relative to IndexURL.
+func (g *Getter) resolveIndex(ctx context.Context) (string, error) {
+	indexurl, err := g.expand(g.indext)
+	if err != nil {
+		return "", fmt.Errorf("error getting index url: %s", err)
+	}
+	buf, err := g.fetchAux(ctx, indexurl)
+	if err != nil {
+		return "", fmt.Errorf("error fetching index: %s", err)
+	}
+	var value string
+	if g.IndexJSONPath != "" {
+		var doc interface{}
+		err = json.Unmarshal(buf, &doc)
+		if err != nil {
+			return "", fmt.Errorf("error parsing index %q: %s", indexurl, err)
+		}
+		steps, _ := parseJSONPath(g.IndexJSONPath)
+		value, err = lookupJSONPath(doc, steps)
+		if err != nil {
+			return "", fmt.Errorf("index %q: IndexJSONPath %q: %s", indexurl, g.IndexJSONPath, err)
+		}
+	} else if g.IndexFeed {
+		value, err = feedLink(buf)
+		if err != nil {
+			return "", fmt.Errorf("feed %q: %s", indexurl, err)
+		}
+	} else {
+		value, err = g.findLink(buf)
+		if err != nil {
+			return "", fmt.Errorf("index %q: %s", indexurl, err)
+		}
+	}
+	if g.URL == "" && len(g.URLs) == 0 {
+		return resolveLink(indexurl, value)
+	}
+	return value, nil
+}
+
+// findLink returns the href of the first (or, if LinkLatest is set,
+// the lexically greatest) element in the given HTML page that
+// matches LinkSelector (default "a[href]") and whose href matches
+// LinkRegex.
+func (g *Getter) findLink(buf []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return "", fmt.Errorf("error parsing HTML: %s", err)
+	}
+	sel := g.linkSel
+	if sel == nil {
+		sel = cascadia.MustCompile("a[href]")
+	}
+	var links []string
+	for _, node := range sel.MatchAll(doc) {
+		for _, attr := range node.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			if g.linkRx == nil || g.linkRx.MatchString(attr.Val) {
+				links = append(links, attr.Val)
+			}
+		}
+	}
+	if len(links) == 0 {
+		return "", fmt.Errorf("no matching link found")
+	}
+	if g.LinkLatest {
+		sort.Strings(links)
+		return links[len(links)-1], nil
+	}
+	return links[0], nil
+}
+
+// resolveLink resolves link relative to base, and checks that the
+// result is an http(s) URL.
+func resolveLink(base, link string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	u, err := b.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid link %q: %s", link, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported protocol scheme in link %q", link)
+	}
+	return u.String(), nil
+}
+
+// A jsonStep is one element of a parsed JSON path: an object key, or
+// (if key is empty) an array index.
+type jsonStep struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parses a simple JSON path like "$.assets[0].url" or
+// "latest.url". A negative index counts from the end of an array.
+func parseJSONPath(path string) ([]jsonStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var steps []jsonStep
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var idxs []string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("malformed index in %q", part)
+				}
+				idxs = append(idxs, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if key != "" {
+			steps = append(steps, jsonStep{key: key})
+		} else if len(idxs) == 0 {
+			return nil, fmt.Errorf("empty key")
+		}
+		for _, idx := range idxs {
+			n, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q", idx)
+			}
+			steps = append(steps, jsonStep{index: n})
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath returns the string or number found by following
+// steps from doc.
+func lookupJSONPath(doc interface{}, steps []jsonStep) (string, error) {
+	for _, step := range steps {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			if step.key == "" {
+				return "", fmt.Errorf("cannot index object with [%d]", step.index)
+			}
+			var ok bool
+			doc, ok = v[step.key]
+			if !ok {
+				return "", fmt.Errorf("key %q not found", step.key)
+			}
+		case []interface{}:
+			if step.key != "" {
+				return "", fmt.Errorf("cannot get key %q from array", step.key)
+			}
+			i := step.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return "", fmt.Errorf("index %d out of range (array length %d)", step.index, len(v))
+			}
+			doc = v[i]
+		default:
+			return "", fmt.Errorf("cannot look up %q in %T", step.key, doc)
+		}
+	}
+	switch v := doc.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("value is %T, not a string or number", doc)
+	}
+}
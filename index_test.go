@@ -0,0 +1,151 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/manifest.json":
+			w.Write([]byte(`{"latest":{"version":"1.2.3","files":[{"url":"/dl/a?x=1&y=2"},{"url":"https://elsewhere.example/b"}]}}`))
+		case "/dl/a":
+			if req.URL.RawQuery != "x=1&y=2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("file a\n"))
+		case "/v/1.2.3.tgz":
+			w.Write([]byte("version 1.2.3\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		url    string
+		path   string
+		expect string
+	}{
+		{"", "$.latest.files[0].url", "file a\n"},
+		{"", "latest.files[-2].url", "file a\n"},
+		{srv.URL + "/v/{{.index}}.tgz", "latest.version", "version 1.2.3\n"},
+		{"", "latest.version", ""},
+		{"", "latest.files[5].url", ""},
+		{"", "latest.nonexistent", ""},
+	} {
+		g := &Getter{
+			URL:           trial.url,
+			Output:        filepath.Join(t.TempDir(), "out"),
+			IndexURL:      srv.URL + "/manifest.json",
+			IndexJSONPath: trial.path,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+			continue
+		}
+		buf, _ := ioutil.ReadFile(g.Output)
+		if string(buf) != trial.expect {
+			t.Errorf("%+v: got %q", trial, buf)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	for _, path := range []string{"$.a", "a.b[0]", "a[1][-1].b", "[0].a"} {
+		if _, err := parseJSONPath(path); err != nil {
+			t.Errorf("%q: %s", path, err)
+		}
+	}
+	for _, path := range []string{"", "$", "a..b", "a[x]", "a[0", "a]0["} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("%q: expected error", path)
+		}
+	}
+}
+
+func TestIndexHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/downloads/":
+			w.Write([]byte(`<html><body>
+<a href="../">Parent</a>
+<a href="tool-1.9.tar.gz">tool-1.9.tar.gz</a>
+<a href="tool-1.10.tar.gz.sha256">checksum</a>
+<div class="stable"><a href="tool-1.8.tar.gz">stable</a></div>
+<a href="tool-1.10.tar.gz">tool-1.10.tar.gz</a>
+</body></html>`))
+		default:
+			w.Write([]byte("content of " + req.URL.Path))
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		selector string
+		regex    string
+		latest   bool
+		expect   string
+	}{
+		{"", `\.tar\.gz$`, false, "content of /downloads/tool-1.9.tar.gz"},
+		{"", `^tool-1\.[0-9]+\.tar\.gz$`, true, "content of /downloads/tool-1.9.tar.gz"},
+		{"", `tool-1\.10`, false, "content of /downloads/tool-1.10.tar.gz.sha256"},
+		{".stable a", "", false, "content of /downloads/tool-1.8.tar.gz"},
+		{".stable a", `\.zip$`, false, ""},
+	} {
+		g := &Getter{
+			Output:       filepath.Join(t.TempDir(), "out"),
+			IndexURL:     srv.URL + "/downloads/",
+			LinkSelector: trial.selector,
+			LinkRegex:    trial.regex,
+			LinkLatest:   trial.latest,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("%+v: expected error", trial)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%+v: %s", trial, err)
+			continue
+		}
+		buf, _ := ioutil.ReadFile(g.Output)
+		if string(buf) != trial.expect {
+			t.Errorf("%+v: got %q", trial, buf)
+		}
+	}
+
+	for _, bad := range []*Getter{
+		{IndexURL: srv.URL},
+		{IndexURL: srv.URL, LinkSelector: "a[", LinkRegex: "x"},
+		{IndexURL: srv.URL, LinkRegex: "("},
+		{IndexURL: srv.URL, LinkRegex: "x", IndexJSONPath: "a"},
+		{LinkRegex: "x", URL: srv.URL},
+	} {
+		bad.Output = filepath.Join(t.TempDir(), "out")
+		if err := bad.Setup(); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package getlatest
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// A limiter limits the number of concurrent downloads. When all slots
+// are in use, waiting downloads get the next available slot in order
+// of priority (highest first), then arrival. A nil *limiter imposes
+// no limit.
+type limiter struct {
+	mtx     sync.Mutex
+	max     int
+	active  int
+	waiting waitQueue
+	seq     uint64
+}
+
+func newLimiter(max int) *limiter {
+	return &limiter{max: max}
+}
+
+// acquire waits for a free slot, or returns ctx.Err() if ctx is
+// cancelled first.
+func (l *limiter) acquire(ctx context.Context, priority int) error {
+	if l == nil {
+		return nil
+	}
+	l.mtx.Lock()
+	if l.active < l.max && len(l.waiting) == 0 {
+		l.active++
+		l.mtx.Unlock()
+		return nil
+	}
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	l.seq++
+	heap.Push(&l.waiting, w)
+	l.mtx.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		select {
+		case <-w.ready:
+			// We were given a slot after all. Pass it on.
+			l.releaseLocked()
+		default:
+			heap.Remove(&l.waiting, w.index)
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees a slot obtained by acquire.
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.releaseLocked()
+}
+
+func (l *limiter) releaseLocked() {
+	if len(l.waiting) > 0 {
+		// Hand the slot directly to the next waiter.
+		w := heap.Pop(&l.waiting).(*waiter)
+		close(w.ready)
+	} else {
+		l.active--
+	}
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	index    int
+}
+
+// waitQueue implements heap.Interface.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return w
+}
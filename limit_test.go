@@ -0,0 +1,67 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1)
+	ctx := context.Background()
+	if err := l.acquire(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled waiter gives up without taking a slot.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(cctx, 100); err == nil {
+		t.Error("expected error from cancelled acquire")
+	}
+
+	waitFor := func(n int) {
+		for {
+			l.mtx.Lock()
+			waiting := len(l.waiting)
+			l.mtx.Unlock()
+			if waiting == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	order := make(chan string, 4)
+	for i, w := range []struct {
+		name string
+		prio int
+	}{{"a", 1}, {"b", 5}, {"c", 3}, {"d", 5}} {
+		go func(name string, prio int) {
+			if err := l.acquire(ctx, prio); err != nil {
+				t.Error(err)
+			}
+			order <- name
+			l.release()
+		}(w.name, w.prio)
+		waitFor(i + 1)
+	}
+	l.release()
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, <-order)
+	}
+	if expect := []string{"b", "d", "c", "a"}; fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("expected order %v, got %v", expect, got)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		l.mtx.Lock()
+		active := l.active
+		l.mtx.Unlock()
+		if active == 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected idle limiter, got active=%d", active)
+		}
+	}
+}
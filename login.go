@@ -0,0 +1,92 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// Login describes a request (e.g., submitting a login form) to make
+// before each download attempt. Cookies set by the response are sent
+// with the download request.
+type Login struct {
+	URL    string
+	Method string            // default POST
+	Form   map[string]string // form fields (application/x-www-form-urlencoded)
+	JSON   interface{}       // or a JSON request body
+}
+
+// setupLogin checks the Login config and gives the http client a
+// cookie jar.
+func (g *Getter) setupLogin() error {
+	l := g.Login
+	if l == nil {
+		return nil
+	}
+	if u, err := url.Parse(l.URL); err != nil {
+		return fmt.Errorf("error parsing Login URL %q: %s", l.URL, err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Login URL %q must be http or https", l.URL)
+	}
+	if l.Form != nil && l.JSON != nil {
+		return fmt.Errorf("cannot use both Form and JSON in Login")
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	g.client.Jar = jar
+	return nil
+}
+
+// login makes the Login request. It returns an error if the
+// response (after following redirects) is not 2xx.
+func (g *Getter) login(ctx context.Context) error {
+	l := g.Login
+	var body io.Reader
+	var contentType string
+	if l.Form != nil {
+		form := url.Values{}
+		for k, v := range l.Form {
+			form.Set(k, v)
+		}
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else if l.JSON != nil {
+		buf, err := json.Marshal(l.JSON)
+		if err != nil {
+			return fmt.Errorf("error encoding Login JSON: %s", err)
+		}
+		body = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+	method := l.Method
+	if method == "" {
+		method = "POST"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, l.URL, body)
+	if err != nil {
+		return fmt.Errorf("login %q: %s", l.URL, err)
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login %q: %s", l.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("login %q: non-2xx response: %d %q", l.URL, resp.StatusCode, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package getlatest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	var logins int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login-form":
+			if req.Method != "POST" || req.FormValue("user") != "alice" || req.FormValue("pw") != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		case "/login-json":
+			var body struct{ User, Pw string }
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.User != "alice" || body.Pw != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		case "/home":
+			w.Write([]byte("welcome\n"))
+			return
+		case "/export":
+			if c, err := req.Cookie("session"); err != nil || c.Value != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("hello\n"))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logins++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		// Like most login forms, redirect after success.
+		http.Redirect(w, req, "/home", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		login  *Login
+		ok     bool
+		logins int
+	}{
+		{nil, false, 0},
+		{&Login{URL: srv.URL + "/login-form", Form: map[string]string{"user": "alice", "pw": "secret"}}, true, 2},
+		{&Login{URL: srv.URL + "/login-json", JSON: map[string]interface{}{"user": "alice", "pw": "secret"}}, true, 2},
+		{&Login{URL: srv.URL + "/login-json", JSON: map[string]interface{}{"user": "alice", "pw": "wrong"}}, false, 0},
+	} {
+		logins = 0
+		g := &Getter{URL: srv.URL + "/export", Output: filepath.Join(t.TempDir(), "out"), Login: trial.login}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err := g.trydownload(context.Background())
+			if trial.ok && err != nil {
+				t.Errorf("%+v: %s", trial.login, err)
+			} else if !trial.ok && err == nil {
+				t.Errorf("%+v: expected error", trial.login)
+			}
+		}
+		if logins != trial.logins {
+			t.Errorf("%+v: expected %d logins, got %d", trial.login, trial.logins, logins)
+		}
+	}
+
+	g := &Getter{URL: srv.URL, Output: "/tmp/out", Login: &Login{URL: srv.URL, Form: map[string]string{}, JSON: "x"}}
+	if err := g.Setup(); err == nil {
+		t.Error("expected Setup error with both Form and JSON")
+	}
+}
@@ -0,0 +1,395 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Result is the outcome of a RunOnce call for a single Getter.
+type Result struct {
+	Output    string
+	Attempted bool // false if the getter was not due to run
+
+	// Err may be set even if Attempted is false, e.g., if a
+	// dependency failed or ctx was cancelled.
+	Err error
+}
+
+// RunOnce makes a single download attempt for each of the given
+// getters that is due according to its schedule. Attempts run
+// concurrently. RunOnce waits for all attempts to finish, and returns
+// the results sorted by output file.
+//
+// If maxConcurrent > 0, at most maxConcurrent attempts run at a
+// time, in order of priority. Cancelling ctx aborts any attempts in
+// progress.
+//
+// A getter with DependsOn waits for those getters to finish, and is
+// not attempted if any of them fails.
+func RunOnce(ctx context.Context, getters map[string]*Getter, maxConcurrent int) []Result {
+	var lim *limiter
+	if maxConcurrent > 0 {
+		lim = newLimiter(maxConcurrent)
+	}
+	deps := true
+	if err := checkDependencies(getters); err != nil {
+		slog.Error("ignoring DependsOn", "error", err)
+		deps = false
+	}
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var results []Result
+	done := map[string]chan struct{}{}
+	failed := map[string]bool{}
+	for output := range getters {
+		done[output] = make(chan struct{})
+	}
+	for _, g := range getters {
+		wg.Add(1)
+		g.limiter = lim
+		go func(g *Getter) {
+			defer wg.Done()
+			defer close(done[g.Output])
+			var attempted bool
+			var err error
+			for _, dep := range g.DependsOn {
+				if !deps {
+					break
+				}
+				<-done[dep]
+				mtx.Lock()
+				depFailed := failed[dep]
+				mtx.Unlock()
+				if depFailed {
+					err = fmt.Errorf("%q: dependency %q failed", g.Output, dep)
+					break
+				}
+			}
+			if err == nil {
+				attempted, err = g.download(ctx, false)
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			failed[g.Output] = err != nil
+			results = append(results, Result{
+				Output:    g.Output,
+				Attempted: attempted,
+				Err:       err,
+			})
+		}(g)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Output < results[j].Output
+	})
+	return results
+}
+
+// A Manager runs a set of Getters, using a single scheduler to start
+// each getter's checks and downloads when they are due. The zero value
+// is ready to use.
+type Manager struct {
+	// If StateFile is not empty, getter state (ETags, failure
+	// streaks, etc.) is loaded from this file by Start, and saved
+	// after each download attempt and by Stop.
+	StateFile string
+
+	// If MaxConcurrent > 0, at most MaxConcurrent downloads run
+	// at a time, in order of priority.
+	MaxConcurrent int
+
+	mtx          sync.Mutex
+	getters      map[string]*Getter
+	ctx          context.Context // cancelled by Shutdown
+	cancel       context.CancelFunc
+	limiter      *limiter
+	sched        *scheduler
+	stateMtx     sync.Mutex
+	stateChanged chan struct{}
+}
+
+// Status describes the current state of a Getter.
+type Status struct {
+	Output      string
+	URL         string
+	LastSuccess time.Time
+	FailSince   time.Time `json:",omitempty"`
+	LastError   string    `json:",omitempty"`
+	RetryAt     time.Time `json:",omitempty"`
+
+	// Earliest time the next download attempt is allowed
+	// (zero if none is allowed in the next 8 days)
+	NextEligible time.Time
+
+	// Size of the output file (0 if it does not exist)
+	Size int64
+
+	// Time before which the upstream server asked us not to
+	// retry, using a Retry-After response header (RetryAt is
+	// also set to this time)
+	DeferredUntil time.Time `json:",omitempty"`
+
+	// True if this is a Once target that has succeeded, so no
+	// more downloads will be attempted unless forced
+	Done bool `json:",omitempty"`
+
+	// Disabled in the config file, or paused by Manager.Pause.
+	// Either way, downloads are only attempted if forced.
+	Disabled bool `json:",omitempty"`
+	Paused   bool `json:",omitempty"`
+}
+
+// Start runs the given getters. Setup must already have been called
+// on each one.
+func (m *Manager) Start(getters map[string]*Getter) {
+	if m.StateFile != "" {
+		if err := LoadState(m.StateFile, getters); err != nil {
+			slog.Error("error loading state file", "path", m.StateFile, "error", err)
+		}
+		m.stateChanged = make(chan struct{}, 1)
+		go m.stateWriter()
+	}
+	m.Update(getters)
+}
+
+// Update starts/stops/replaces running getters as needed to match
+// the given set, e.g., after reloading the config file.
+//
+// A getter whose config is unchanged keeps running undisturbed. A
+// getter whose config (or key, certificate, etc. file) has changed is
+// replaced by the new getter, which carries over the old one's state
+// (last success time, failure streak) once the old one finishes any
+// download that is in progress.
+func (m *Manager) Update(loaded map[string]*Getter) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.ctx == nil {
+		m.ctx, m.cancel = context.WithCancel(context.Background())
+		m.sched = newScheduler()
+		go m.sched.run(m.ctx)
+	}
+	if m.limiter == nil && m.MaxConcurrent > 0 {
+		m.limiter = newLimiter(m.MaxConcurrent)
+	}
+	next := map[string]*Getter{}
+	for output, old := range m.getters {
+		if _, ok := loaded[output]; !ok {
+			old.logger().Info("removed from config, stopping")
+			failGaugeVec.DeleteLabelValues(output)
+			failCountVec.DeleteLabelValues(output)
+			retryGaugeVec.DeleteLabelValues(output)
+			deferGaugeVec.DeleteLabelValues(output)
+			attemptCountVec.DeleteLabelValues(output)
+			bytesCountVec.DeleteLabelValues(output)
+			durationVec.DeleteLabelValues(output)
+			spaceFailCountVec.DeleteLabelValues(output)
+			lastSuccessGaugeVec.DeleteLabelValues(output)
+			mirrorSuccessVec.DeletePartialMatch(prometheus.Labels{"target": output})
+			httpResponseCountVec.DeletePartialMatch(prometheus.Labels{"target": output})
+			go m.sched.remove(old)
+		}
+	}
+	for output, g := range loaded {
+		g.stateChanged = m.stateChanged
+		g.limiter = m.limiter
+		g.sched = m.sched
+		old, ok := m.getters[output]
+		if !ok {
+			if m.getters != nil {
+				g.logger().Info("added to config, starting")
+			}
+			m.sched.add(g)
+		} else if sameConfig(old, g) {
+			g = old
+		} else {
+			g.logger().Info("config changed, restarting")
+			go func(sched *scheduler, old, g *Getter) {
+				sched.remove(old)
+				g.inherit(old)
+				sched.add(g)
+			}(m.sched, old, g)
+		}
+		next[output] = g
+	}
+	linkDependencies(next)
+	m.getters = next
+}
+
+// Stop stops all getters, and waits for any downloads in progress to
+// finish.
+func (m *Manager) Stop() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	var wg sync.WaitGroup
+	for _, g := range m.getters {
+		wg.Add(1)
+		go func(g *Getter) {
+			defer wg.Done()
+			m.sched.remove(g)
+		}(g)
+	}
+	wg.Wait()
+	if m.StateFile != "" {
+		m.saveState(m.getters)
+	}
+	m.getters = nil
+	if m.cancel != nil {
+		m.cancel()
+		m.ctx, m.cancel, m.sched = nil, nil, nil
+	}
+}
+
+// Shutdown is like Stop, except that downloads in progress are
+// aborted (and their tempfiles removed) instead of waiting for them
+// to finish.
+func (m *Manager) Shutdown() {
+	m.mtx.Lock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mtx.Unlock()
+	m.Stop()
+}
+
+// Running returns true if the manager has been started (with a
+// possibly empty set of getters) and not stopped.
+func (m *Manager) Running() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.getters != nil
+}
+
+// TriggerNow starts a download attempt for the given output file
+// right away, regardless of its schedule. It does not wait for the
+// attempt to finish.
+func (m *Manager) TriggerNow(output string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	g, ok := m.getters[output]
+	if !ok {
+		return fmt.Errorf("%q: no such target", output)
+	}
+	g.signal(g.trigger)
+	return nil
+}
+
+// TriggerAll starts a download attempt for every target right away,
+// regardless of schedule, except targets that are disabled, paused,
+// or done (see Once). It does not wait for the attempts to finish.
+func (m *Manager) TriggerAll() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, g := range m.getters {
+		if g.Disabled || g.paused.Load() {
+			continue
+		}
+		g.mtx.Lock()
+		done := g.Once && !g.lastSuccess.IsZero()
+		g.mtx.Unlock()
+		if done {
+			continue
+		}
+		g.signal(g.trigger)
+	}
+}
+
+// Pause stops scheduling downloads for the given output file until
+// Resume is called, even if the config is reloaded. If StateFile is
+// set, the paused state is also saved across restarts. A download in
+// progress is not interrupted, and TriggerNow still starts a
+// download.
+func (m *Manager) Pause(output string) error {
+	return m.setPaused(output, true)
+}
+
+// Resume undoes Pause.
+func (m *Manager) Resume(output string) error {
+	return m.setPaused(output, false)
+}
+
+func (m *Manager) setPaused(output string, paused bool) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	g, ok := m.getters[output]
+	if !ok {
+		return fmt.Errorf("%q: no such target", output)
+	}
+	if g.paused.Swap(paused) == paused {
+		return nil
+	}
+	if paused {
+		g.logger().Info("paused")
+	} else {
+		g.logger().Info("resumed")
+	}
+	g.signal(g.wake)
+	select {
+	case g.stateChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the current state of each getter, sorted by output
+// file.
+func (m *Manager) Status() []Status {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	var status []Status
+	for _, g := range m.getters {
+		status = append(status, g.status())
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Output < status[j].Output
+	})
+	return status
+}
+
+// Stuck returns the output files of any getters that have stopped
+// making progress, e.g., because a download or OnSuccess command has
+// hung. It returns nil if all getters are working normally.
+func (m *Manager) Stuck() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	now := time.Now()
+	var stuck []string
+	for output, g := range m.getters {
+		if g.stuck(now) {
+			stuck = append(stuck, output)
+		}
+	}
+	sort.Strings(stuck)
+	return stuck
+}
+
+// sameConfig returns true if a and b have identical configuration
+// (i.e., exported fields), and the files loaded by Setup (TLSCert,
+// PrivateKeyFile, GPGKeyring, SkipDatesFile, etc.) had the same
+// content when each of them was set up.
+func sameConfig(a, b *Getter) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb) && reflect.DeepEqual(a.setupFiles, b.setupFiles)
+}
+
+// inherit copies runtime state from a getter that has been replaced
+// due to a config change. The old getter must be removed from the
+// scheduler already.
+func (g *Getter) inherit(old *Getter) {
+	g.restore(old.state())
+}
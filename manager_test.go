@@ -0,0 +1,439 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	output := filepath.Join(t.TempDir(), "foo")
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: output,
+		TTL:    "24h",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mgr Manager
+	mgr.Start(map[string]*Getter{output: g})
+	defer mgr.Stop()
+
+	waitFor := func(n int64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt64(&hits) < n || mgr.Status()[0].LastSuccess.IsZero() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %d requests", n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(1)
+	if err := mgr.TriggerNow(output); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(2)
+	if err := mgr.TriggerNow("/nonexistent"); err == nil {
+		t.Error("expected error triggering nonexistent target")
+	}
+	st := mgr.Status()
+	if len(st) != 1 || st[0].Output != output || st[0].LastError != "" {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	getters := map[string]*Getter{}
+	for _, g := range []*Getter{
+		{URL: srv.URL + "/ok", Output: filepath.Join(tmpdir, "a")},
+		{URL: srv.URL + "/fail", Output: filepath.Join(tmpdir, "b")},
+		{URL: srv.URL + "/ok", Output: filepath.Join(tmpdir, "c")},
+	} {
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		getters[g.Output] = g
+	}
+	// Not due because of a recent failure
+	getters[filepath.Join(tmpdir, "c")].retryAt = time.Now().Add(time.Hour)
+	results := RunOnce(context.Background(), getters, 0)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+	if r := results[0]; !r.Attempted || r.Err != nil {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r := results[1]; !r.Attempted || r.Err == nil {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r := results[2]; r.Attempted {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("partial content"))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-req.Context().Done()
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(tmpdir, "foo"),
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mgr Manager
+	mgr.Start(map[string]*Getter{g.Output: g})
+	<-started
+	t0 := time.Now()
+	mgr.Shutdown()
+	if d := time.Since(t0); d > 5*time.Second {
+		t.Errorf("Shutdown took %s", d)
+	}
+	if ents, err := os.ReadDir(tmpdir); err != nil || len(ents) != 0 {
+		t.Errorf("expected empty dir after shutdown, got %v, %v", ents, err)
+	}
+	if st := g.status(); !st.FailSince.IsZero() || st.LastError != "" {
+		t.Errorf("aborted download counted as failure: %+v", st)
+	}
+}
+
+func TestSubMinuteTTL(t *testing.T) {
+	defer func(d time.Duration) { minCheckWait = d }(minCheckWait)
+	minCheckWait = 10 * time.Millisecond
+
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:    srv.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+		TTL:    "200ms",
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := g.nextCheck(time.Now()); d > 200*time.Millisecond {
+		t.Errorf("nextCheck %s > TTL", d)
+	}
+	var mgr Manager
+	mgr.Start(map[string]*Getter{g.Output: g})
+	time.Sleep(time.Second)
+	mgr.Stop()
+	if n := atomic.LoadInt64(&hits); n < 3 || n > 6 {
+		t.Errorf("expected ~5 downloads in 1s with TTL 200ms, got %d", n)
+	}
+
+	g = &Getter{URL: srv.URL + "/foo", Schedule: "@daily", CheckInterval: "10m"}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.lastSuccess = time.Now()
+	if d := g.nextCheck(time.Now()); d != 10*time.Minute {
+		t.Errorf("expected nextCheck = CheckInterval, got %s", d)
+	}
+}
+
+func TestPause(t *testing.T) {
+	tmpdir := t.TempDir()
+	statefile := filepath.Join(tmpdir, "state.json")
+	output := filepath.Join(tmpdir, "foo")
+	newGetters := func(disabled bool) map[string]*Getter {
+		g := &Getter{URL: "http://host.example/foo", Output: output, Disabled: disabled}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		return map[string]*Getter{output: g}
+	}
+
+	getters := newGetters(true)
+	if g := getters[output]; g.should(time.Now()) {
+		t.Error("should() returned true for disabled target")
+	}
+
+	getters = newGetters(false)
+	g := getters[output]
+	if !g.should(time.Now()) {
+		t.Fatal("should() returned false for new target")
+	}
+	// Set up a manager without starting the getter goroutine.
+	mgr := &Manager{getters: getters}
+	if err := mgr.Pause(output); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Pause(filepath.Join(tmpdir, "bar")); err == nil {
+		t.Error("expected error pausing nonexistent target")
+	}
+	if g.should(time.Now()) {
+		t.Error("should() returned true for paused target")
+	}
+
+	// Paused state is carried over when the config changes...
+	g2 := newGetters(false)[output]
+	g2.inherit(g)
+	if g2.should(time.Now()) {
+		t.Error("should() returned true after inheriting paused state")
+	}
+
+	// ...and across restarts.
+	if err := SaveState(statefile, getters); err != nil {
+		t.Fatal(err)
+	}
+	getters = newGetters(false)
+	if err := LoadState(statefile, getters); err != nil {
+		t.Fatal(err)
+	}
+	g = getters[output]
+	if st := g.status(); !st.Paused || g.should(time.Now()) {
+		t.Errorf("paused state not restored: %+v", st)
+	}
+	mgr = &Manager{getters: getters}
+	if err := mgr.Resume(output); err != nil {
+		t.Fatal(err)
+	}
+	if !g.should(time.Now()) {
+		t.Error("should() returned false after Resume")
+	}
+}
+
+func TestTriggerAll(t *testing.T) {
+	tmpdir := t.TempDir()
+	getters := map[string]*Getter{
+		filepath.Join(tmpdir, "foo"):      {},
+		filepath.Join(tmpdir, "disabled"): {Disabled: true},
+		filepath.Join(tmpdir, "paused"):   {},
+	}
+	for output, g := range getters {
+		g.URL = "http://host.example/foo"
+		g.Output = output
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Set up a manager without starting the getter goroutines, so
+	// the triggers stay in the channels where we can see them.
+	mgr := &Manager{getters: getters}
+	mgr.Pause(filepath.Join(tmpdir, "paused"))
+	mgr.TriggerAll()
+	for output, g := range getters {
+		expect := filepath.Base(output) == "foo"
+		select {
+		case <-g.trigger:
+			if !expect {
+				t.Errorf("%s: unexpected trigger", output)
+			}
+		default:
+			if expect {
+				t.Errorf("%s: not triggered", output)
+			}
+		}
+	}
+}
+
+func TestStuck(t *testing.T) {
+	defer func(d time.Duration) { livenessGrace = d }(livenessGrace)
+	livenessGrace = 100 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	tmpdir := t.TempDir()
+	getters := map[string]*Getter{}
+	for _, name := range []string{"fast", "slowhook", "hung"} {
+		g := &Getter{
+			URL:             srv.URL + "/" + name,
+			Output:          filepath.Join(tmpdir, name),
+			TTL:             "24h",
+			DownloadTimeout: "100ms",
+		}
+		if name == "slowhook" {
+			// A hook that takes longer than
+			// DownloadTimeout is not a problem.
+			g.OnSuccess = "sleep 1"
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		getters[g.Output] = g
+	}
+	hung := getters[filepath.Join(tmpdir, "hung")]
+	delete(getters, hung.Output)
+	var mgr Manager
+	mgr.Start(getters)
+	defer mgr.Stop()
+
+	time.Sleep(700 * time.Millisecond)
+	if stuck := mgr.Stuck(); len(stuck) != 0 {
+		t.Errorf("expected no stuck targets, got %q", stuck)
+	}
+
+	// Simulate a getter that has missed its deadline.
+	hung.checkIn(time.Now().Add(-time.Second))
+	mgr.mtx.Lock()
+	mgr.getters[hung.Output] = hung
+	mgr.mtx.Unlock()
+	if stuck := mgr.Stuck(); len(stuck) != 1 || stuck[0] != hung.Output {
+		t.Errorf("expected only hung target to be stuck, got %q", stuck)
+	}
+	mgr.mtx.Lock()
+	delete(mgr.getters, hung.Output)
+	mgr.mtx.Unlock()
+}
+
+func TestManagerUpdate(t *testing.T) {
+	var mtx sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		hits[req.URL.Path]++
+		mtx.Unlock()
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+	getHits := func(name string) int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return hits["/"+name]
+	}
+
+	tmpdir := t.TempDir()
+	datesFile := filepath.Join(tmpdir, "dates")
+	if err := ioutil.WriteFile(datesFile, []byte("2019-12-25\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	load := func(names ...string) map[string]*Getter {
+		getters := map[string]*Getter{}
+		for _, name := range names {
+			g := &Getter{URL: srv.URL + "/" + name, Output: filepath.Join(tmpdir, name), TTL: "24h"}
+			if name == "changed" {
+				g.SkipDatesFile = datesFile
+			}
+			if err := g.Setup(); err != nil {
+				t.Fatal(err)
+			}
+			getters[g.Output] = g
+		}
+		return getters
+	}
+	var mgr Manager
+	defer mgr.Stop()
+	running := func() map[string]*Getter {
+		mgr.mtx.Lock()
+		defer mgr.mtx.Unlock()
+		getters := map[string]*Getter{}
+		for output, g := range mgr.getters {
+			getters[output] = g
+		}
+		return getters
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	orig := load("same", "changed", "removed")
+	mgr.Start(orig)
+	waitFor("initial downloads", func() bool {
+		return getHits("same") == 1 && getHits("changed") == 1 && getHits("removed") == 1
+	})
+	waitFor("initial success", func() bool {
+		for _, st := range mgr.Status() {
+			if st.LastSuccess.IsZero() {
+				return false
+			}
+		}
+		return true
+	})
+
+	// Rewriting SkipDatesFile counts as a config change, even
+	// though the config text is the same.
+	if err := ioutil.WriteFile(datesFile, []byte("2019-12-26\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := load("same", "changed", "added")
+	mgr.Update(reloaded)
+
+	out := func(name string) string { return filepath.Join(tmpdir, name) }
+	now := running()
+	if len(now) != 3 {
+		t.Errorf("expected 3 running getters, got %d", len(now))
+	}
+	if now[out("same")] != orig[out("same")] {
+		t.Error("unchanged getter was replaced")
+	}
+	if now[out("changed")] != reloaded[out("changed")] {
+		t.Error("changed getter was not replaced")
+	}
+	if now[out("added")] != reloaded[out("added")] {
+		t.Error("added getter is not running")
+	}
+	select {
+	case <-orig[out("removed")].done:
+	case <-time.After(5 * time.Second):
+		t.Error("removed getter was not stopped")
+	}
+	select {
+	case <-orig[out("changed")].done:
+	case <-time.After(5 * time.Second):
+		t.Error("replaced getter was not stopped")
+	}
+	waitFor("added target download", func() bool { return getHits("added") == 1 })
+	waitFor("state carried over", func() bool {
+		return reloaded[out("changed")].status().LastSuccess.Equal(orig[out("changed")].status().LastSuccess)
+	})
+	time.Sleep(100 * time.Millisecond)
+	if n := getHits("changed"); n != 1 {
+		t.Errorf("replaced getter downloaded again (%d requests) despite inheriting last success", n)
+	}
+	if n := getHits("same"); n != 1 {
+		t.Errorf("unchanged getter downloaded again (%d requests)", n)
+	}
+}
@@ -0,0 +1,105 @@
+package getlatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// outputMetadata is the content of the WriteMetadata sidecar file.
+type outputMetadata struct {
+	URL          string
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	SHA256       string
+	Size         int64
+	Downloaded   time.Time // when the current content was downloaded
+	Checked      time.Time // last successful attempt, possibly not modified
+}
+
+// metadataPath returns the path of the WriteMetadata sidecar file.
+func (g *Getter) metadataPath() string {
+	return g.Output + ".meta.json"
+}
+
+// writeMetadata records the source of the content in contentPath
+// (the new output file, or the downloaded content if it was piped
+// or unpacked) in the sidecar file.
+func (g *Getter) writeMetadata(contentPath, srcurl string, fetched fetched) error {
+	sum, err := sha256File(contentPath)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(contentPath)
+	if err != nil {
+		return err
+	}
+	if u, err := url.Parse(srcurl); err == nil {
+		srcurl = u.Redacted()
+	}
+	now := time.Now().UTC()
+	return g.saveMetadata(outputMetadata{
+		URL:          srcurl,
+		ETag:         fetched.etag,
+		LastModified: fetched.modtime,
+		SHA256:       sum,
+		Size:         fi.Size(),
+		Downloaded:   now,
+		Checked:      now,
+	})
+}
+
+// touchMetadata updates the Checked time in the sidecar file after
+// a successful attempt that did not change the output. Errors are
+// logged but otherwise ignored.
+func (g *Getter) touchMetadata() {
+	buf, err := ioutil.ReadFile(g.metadataPath())
+	if os.IsNotExist(err) {
+		return
+	}
+	var meta outputMetadata
+	if err == nil {
+		err = json.Unmarshal(buf, &meta)
+	}
+	if err == nil {
+		meta.Checked = time.Now().UTC()
+		err = g.saveMetadata(meta)
+	}
+	if err != nil {
+		g.logger().Warn("error updating metadata file", "path", g.metadataPath(), "error", err)
+	}
+}
+
+// saveMetadata atomically replaces the sidecar file.
+func (g *Getter) saveMetadata(meta outputMetadata) error {
+	buf, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, file := filepath.Split(g.metadataPath())
+	f, err := ioutil.TempFile(dir, "."+file+".")
+	if err != nil {
+		return fmt.Errorf("error creating metadata tempfile: %s", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(buf, '\n'))
+	if err == nil {
+		err = f.Chmod(0666 & ^umask)
+	}
+	if err == nil && (g.uid >= 0 || g.gid >= 0) {
+		err = f.Chown(g.uid, g.gid)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing metadata tempfile: %s", err)
+	}
+	return os.Rename(f.Name(), g.metadataPath())
+}
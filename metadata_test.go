@@ -0,0 +1,76 @@
+package getlatest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Tue, 02 Jan 2024 03:04:05 GMT")
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:           srv.URL + "/foo",
+		Output:        filepath.Join(t.TempDir(), "foo"),
+		WriteMetadata: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readMeta := func() outputMetadata {
+		var meta outputMetadata
+		buf, err := ioutil.ReadFile(g.Output + ".meta.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(buf, &meta); err != nil {
+			t.Fatal(err)
+		}
+		return meta
+	}
+
+	before := time.Now()
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := readMeta()
+	expect := outputMetadata{
+		URL:          srv.URL + "/foo",
+		ETag:         `"v1"`,
+		LastModified: "Tue, 02 Jan 2024 03:04:05 GMT",
+		SHA256:       "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+		Size:         6,
+	}
+	if meta.URL != expect.URL || meta.ETag != expect.ETag || meta.LastModified != expect.LastModified || meta.SHA256 != expect.SHA256 || meta.Size != expect.Size {
+		t.Errorf("expected %+v, got %+v", expect, meta)
+	}
+	if meta.Downloaded.Before(before.Add(-time.Second)) || !meta.Checked.Equal(meta.Downloaded) {
+		t.Errorf("unexpected times in %+v", meta)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta2 := readMeta()
+	if !meta2.Downloaded.Equal(meta.Downloaded) || !meta2.Checked.After(meta.Checked) || meta2.SHA256 != meta.SHA256 {
+		t.Errorf("after not-modified response, expected only Checked to change: %+v -> %+v", meta, meta2)
+	}
+}
@@ -0,0 +1,95 @@
+package getlatest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A minisignKey is a minisign or signify Ed25519 public key.
+type minisignKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// parseMinisignKey parses a minisign/signify public key: either the
+// base64-encoded key by itself, or the content of a .pub file
+// (comment line followed by base64-encoded key).
+func parseMinisignKey(s string) (*minisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != 2+8+ed25519.PublicKeySize || string(buf[:2]) != "Ed" {
+		return nil, fmt.Errorf("not an Ed25519 public key")
+	}
+	k := &minisignKey{key: ed25519.PublicKey(buf[10:])}
+	copy(k.keyID[:], buf[2:10])
+	return k, nil
+}
+
+// verifyMinisign checks a minisign or signify signature of the file at
+// path. Signify signatures, and minisign signatures in the original
+// (non-prehashed) format, require the whole file to be read into
+// memory.
+func (g *Getter) verifyMinisign(sig []byte, path string) error {
+	// Both formats start with "untrusted comment: ..." and a
+	// base64-encoded signature. Minisign adds "trusted
+	// comment: ..." and a global signature covering the
+	// signature and trusted comment.
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return fmt.Errorf("signature verification failed: invalid signature file format")
+	}
+	sigbuf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sigbuf) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("signature verification failed: invalid signature")
+	}
+	alg, keyID, edsig := string(sigbuf[:2]), sigbuf[2:10], sigbuf[10:]
+	if !bytes.Equal(keyID, g.minisignKey.keyID[:]) {
+		return fmt.Errorf("signature verification failed: signature key ID %X does not match MinisignKey %X", keyID, g.minisignKey.keyID)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var msg []byte
+	switch alg {
+	case "Ed":
+		msg, err = io.ReadAll(f)
+	case "ED":
+		h, _ := blake2b.New512(nil)
+		_, err = io.Copy(h, f)
+		msg = h.Sum(nil)
+	default:
+		return fmt.Errorf("signature verification failed: unsupported signature algorithm %q", alg)
+	}
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(g.minisignKey.key, msg, edsig) {
+		return fmt.Errorf("signature verification failed: bad signature")
+	}
+	if len(lines) >= 4 {
+		trusted, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+		if !ok {
+			return fmt.Errorf("signature verification failed: invalid trusted comment line")
+		}
+		globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+		if err != nil || !ed25519.Verify(g.minisignKey.key, append(edsig, trusted...), globalSig) {
+			return fmt.Errorf("signature verification failed: bad trusted comment signature")
+		}
+		g.logger().Info("good signature", "trustedComment", trusted)
+	} else {
+		g.logger().Info("good signature", "keyID", fmt.Sprintf("%X", keyID))
+	}
+	return nil
+}
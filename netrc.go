@@ -0,0 +1,98 @@
+package getlatest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// netrcEntry is the login and password for one machine in a netrc
+// file.
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrcLogin returns the NetrcFile entry for the given host (or the
+// default entry, if there is no entry for host). It returns nil if
+// NetrcFile is not set or has no matching entry. The file is read
+// every time, so credentials can be changed without reloading the
+// config.
+func (g *Getter) netrcLogin(host string) (*netrcEntry, error) {
+	if g.NetrcFile == "" {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(g.NetrcFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading NetrcFile: %s", err)
+	}
+	return parseNetrc(buf, host), nil
+}
+
+// parseNetrc returns the entry for host in the given netrc file
+// content, or the default entry, or nil.
+func parseNetrc(buf []byte, host string) *netrcEntry {
+	// Split into tokens, skipping macro definitions (which
+	// continue until the next blank line).
+	var tokens []string
+	inMacro := false
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, tok := range strings.Fields(line) {
+			if strings.HasPrefix(tok, "#") {
+				break
+			}
+			tokens = append(tokens, tok)
+			if tok == "macdef" {
+				inMacro = true
+			}
+		}
+	}
+
+	var found, dflt *netrcEntry
+	var current *netrcEntry
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			current = nil
+			if i+1 < len(tokens) {
+				i++
+				if found == nil && strings.EqualFold(tokens[i], host) {
+					found = &netrcEntry{}
+					current = found
+				}
+			}
+		case "default":
+			current = nil
+			if dflt == nil {
+				dflt = &netrcEntry{}
+				current = dflt
+			}
+		case "login", "password", "account", "macdef":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			if current == nil {
+				continue
+			}
+			switch tokens[i-1] {
+			case "login":
+				current.login = tokens[i]
+			case "password":
+				current.password = tokens[i]
+			}
+		}
+	}
+	if found != nil {
+		return found
+	}
+	return dflt
+}
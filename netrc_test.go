@@ -0,0 +1,84 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := []byte(`# comment
+machine example.com login alice password secret1
+machine other.example
+  login bob
+  password secret2 # trailing comment
+macdef init
+  cd /pub
+  login mallory
+
+machine after.macro login carol password secret3
+default login anonymous password guest
+`)
+	for _, trial := range []struct {
+		host  string
+		login string
+		pw    string
+	}{
+		{"example.com", "alice", "secret1"},
+		{"EXAMPLE.com", "alice", "secret1"},
+		{"other.example", "bob", "secret2"},
+		{"after.macro", "carol", "secret3"},
+		{"unlisted.example", "anonymous", "guest"},
+	} {
+		e := parseNetrc(netrc, trial.host)
+		if e == nil || e.login != trial.login || e.password != trial.pw {
+			t.Errorf("%s: got %+v, expected %s/%s", trial.host, e, trial.login, trial.pw)
+		}
+	}
+	if e := parseNetrc([]byte("machine example.com login alice password x\n"), "other.example"); e != nil {
+		t.Errorf("expected nil for unlisted host without default, got %+v", e)
+	}
+}
+
+func TestNetrcHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pw, ok := req.BasicAuth(); !ok || user != "alice" || pw != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	netrcFile := filepath.Join(dir, "netrc")
+	err := ioutil.WriteFile(netrcFile, []byte("machine 127.0.0.1 login alice password secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Getter{
+		URL:       srv.URL + "/foo",
+		Output:    filepath.Join(dir, "foo"),
+		NetrcFile: netrcFile,
+	}
+	err = g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g = &Getter{
+		URL:       srv.URL + "/foo",
+		Output:    filepath.Join(dir, "foo"),
+		NetrcFile: filepath.Join(dir, "missing"),
+	}
+	if err := g.Setup(); err == nil {
+		t.Error("expected Setup error for missing NetrcFile")
+	}
+}
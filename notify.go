@@ -0,0 +1,79 @@
+package getlatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Notify configures webhook notifications. A notification is sent
+// when a target starts failing, when it recovers, and (if OnSuccess
+// is true) each time the output file is updated.
+type Notify struct {
+	URL       string
+	Format    string // "slack" (default) or "json"
+	OnSuccess bool
+}
+
+// notifyClient is used for webhook requests. It does not use the
+// target's proxy, TLS, or authentication settings.
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+func (g *Getter) setupNotify() error {
+	n := g.Notify
+	if n == nil {
+		return nil
+	}
+	if n.URL == "" {
+		return fmt.Errorf("Notify requires URL")
+	}
+	switch n.Format {
+	case "", "slack", "json":
+	default:
+		return fmt.Errorf("invalid Notify Format %q (must be slack or json)", n.Format)
+	}
+	return nil
+}
+
+// notify sends a notification in the background, if configured. The
+// event is "failure", "recovery", or "success".
+func (g *Getter) notify(event, message string) {
+	n := g.Notify
+	if n == nil || (event == "success" && !n.OnSuccess) {
+		return
+	}
+	host, _ := os.Hostname()
+	var payload interface{}
+	if n.Format == "json" {
+		payload = map[string]interface{}{
+			"event":   event,
+			"target":  g.Output,
+			"host":    host,
+			"message": message,
+			"time":    time.Now().UTC(),
+		}
+	} else {
+		payload = map[string]string{
+			"text": fmt.Sprintf("getlatest on %s: %s: %s", host, g.Output, message),
+		}
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		g.logger().Error("error encoding notification", "error", err)
+		return
+	}
+	go func() {
+		resp, err := notifyClient.Post(n.URL, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			g.logger().Error("error sending notification", "event", event, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			g.logger().Error("error sending notification", "event", event, "status", resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,112 @@
+package getlatest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	var fail atomic.Bool
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, req, "foo", time.Unix(1e9, 0), strings.NewReader("hello\n"))
+	}))
+	defer src.Close()
+
+	events := make(chan map[string]interface{}, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var msg map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&msg)
+		events <- msg
+	}))
+	defer hook.Close()
+
+	expect := func(want ...string) {
+		t.Helper()
+		var got []string
+		timeout := time.After(5 * time.Second)
+		for len(got) < len(want) {
+			select {
+			case msg := <-events:
+				got = append(got, msg["event"].(string))
+			case <-timeout:
+				t.Fatalf("timed out, got %v, want %v", got, want)
+			}
+		}
+		select {
+		case msg := <-events:
+			t.Fatalf("unexpected event %v", msg)
+		case <-time.After(100 * time.Millisecond):
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	g := &Getter{
+		URL:    src.URL + "/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+		Notify: &Notify{URL: hook.URL, Format: "json", OnSuccess: true},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail.Store(true)
+	g.download(context.Background(), true)
+	expect("failure")
+	g.download(context.Background(), true)
+	expect()
+	fail.Store(false)
+	g.download(context.Background(), true)
+	expect("recovery", "success")
+	// Not modified, so no "success" notification
+	g.download(context.Background(), true)
+	expect()
+
+	g.Notify.Format = "xml"
+	if err := g.Setup(); err == nil {
+		t.Error("expected error for invalid Format")
+	}
+}
+
+func TestNotifySlack(t *testing.T) {
+	texts := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var msg struct{ Text string }
+		json.NewDecoder(req.Body).Decode(&msg)
+		texts <- msg.Text
+	}))
+	defer hook.Close()
+	g := &Getter{
+		URL:    "http://127.0.0.1:1/foo",
+		Output: filepath.Join(t.TempDir(), "foo"),
+		Notify: &Notify{URL: hook.URL},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.download(context.Background(), true)
+	select {
+	case text := <-texts:
+		if !strings.Contains(text, g.Output) || !strings.Contains(text, "download failed") {
+			t.Errorf("unexpected text %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out")
+	}
+}
@@ -0,0 +1,117 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ociTitleAnnotation is the annotation ORAS uses to record the file
+// name of each layer.
+const ociTitleAnnotation = "org.opencontainers.image.title"
+
+// ociReference parses an oci://registry/repository:tag (or
+// @sha256:...) URL.
+func ociReference(srcurl string) (name.Reference, error) {
+	return name.ParseReference(strings.TrimPrefix(srcurl, "oci://"))
+}
+
+// setupOCI checks an oci:// URL.
+func (g *Getter) setupOCI(urlstr string) error {
+	if _, err := ociReference(urlstr); err != nil {
+		return fmt.Errorf("invalid oci URL %q: %s", urlstr, err)
+	}
+	return nil
+}
+
+// fetchOCI resolves the manifest for an oci:// URL and downloads the
+// layer selected by OCILayer. Registry credentials are found in the
+// docker config file (~/.docker/config.json, or $DOCKER_CONFIG),
+// including credential helpers.
+func (g *Getter) fetchOCI(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	ref, err := ociReference(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	opts := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithTransport(g.transport()),
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+		remote.WithUserAgent(g.userAgent()),
+	}
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	// For a multi-platform index, Image() selects the
+	// linux/amd64 image.
+	img, err := desc.Image()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	layer, err := g.ociLayer(manifest.Layers)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	// Layers are content-addressed, so the digest is a perfect
+	// ETag.
+	etag := layer.Digest.String()
+	if g.haveOutput() && etag == g.etag {
+		return fetched{}, errNotModified
+	}
+	if err := g.checkMaximumSize(layer.Size); err != nil {
+		return fetched{}, err
+	}
+	if err := g.checkFreeSpace(layer.Size); err != nil {
+		return fetched{}, err
+	}
+	blob, err := remote.Layer(ref.Context().Digest(etag), opts...)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	// Compressed() returns the blob exactly as stored in the
+	// registry, and checks its digest as it is read.
+	rdr, err := blob.Compressed()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer rdr.Close()
+	n, err := g.copyBody(f, rdr, 0)
+	if err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", srcurl, err)
+	}
+	return fetched{size: n, etag: etag}, nil
+}
+
+// ociLayer returns the layer whose title annotation (file name) or
+// media type is OCILayer. If OCILayer is empty, there must be exactly
+// one layer.
+func (g *Getter) ociLayer(layers []v1.Descriptor) (v1.Descriptor, error) {
+	if g.OCILayer == "" {
+		if len(layers) != 1 {
+			return v1.Descriptor{}, fmt.Errorf("manifest has %d layers, OCILayer must be specified", len(layers))
+		}
+		return layers[0], nil
+	}
+	for _, l := range layers {
+		if l.Annotations[ociTitleAnnotation] == g.OCILayer {
+			return l, nil
+		}
+	}
+	for _, l := range layers {
+		if string(l.MediaType) == g.OCILayer {
+			return l, nil
+		}
+	}
+	return v1.Descriptor{}, fmt.Errorf("no layer with title or media type %q", g.OCILayer)
+}
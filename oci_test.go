@@ -0,0 +1,96 @@
+package getlatest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestOCI(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	push := func(tag string, files map[string]string) {
+		img := v1.Image(empty.Image)
+		for fnm, data := range files {
+			var err error
+			img, err = mutate.Append(img, mutate.Addendum{
+				Layer:       static.NewLayer([]byte(data), types.MediaType("application/x-"+fnm)),
+				Annotations: map[string]string{ociTitleAnnotation: fnm},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		ref, err := name.ParseReference(host + "/example/bundle:" + tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push("one", map[string]string{"a.txt": "hello\n"})
+	push("two", map[string]string{"a.txt": "hello\n", "b.txt": "world\n"})
+
+	for _, trial := range []struct {
+		tag    string
+		layer  string
+		expect string
+		errstr string
+	}{
+		{tag: "one", expect: "hello\n"},
+		{tag: "two", errstr: "OCILayer must be specified"},
+		{tag: "two", layer: "b.txt", expect: "world\n"},
+		{tag: "two", layer: "application/x-a.txt", expect: "hello\n"},
+		{tag: "two", layer: "c.txt", errstr: "no layer"},
+		{tag: "three", errstr: "MANIFEST_UNKNOWN"},
+	} {
+		g := Getter{
+			URL:      "oci://" + host + "/example/bundle:" + trial.tag,
+			Output:   filepath.Join(t.TempDir(), "out"),
+			OCILayer: trial.layer,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			err = g.trydownload(context.Background())
+			if trial.errstr != "" || err != nil {
+				break
+			}
+		}
+		if trial.errstr != "" {
+			if err == nil || !strings.Contains(err.Error(), trial.errstr) {
+				t.Errorf("%s %q: expected error containing %q, got %v", g.URL, trial.layer, trial.errstr, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s %q: %s", g.URL, trial.layer, err)
+			continue
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.expect {
+			t.Errorf("%s %q: output file: %q, %v", g.URL, trial.layer, buf, err)
+		}
+		if g.updates != 1 {
+			t.Errorf("%s %q: expected 1 update (second attempt should be not-modified), got %d", g.URL, trial.layer, g.updates)
+		}
+	}
+}
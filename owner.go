@@ -0,0 +1,45 @@
+package getlatest
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// lookupOwner returns the numeric uid and gid for the given user and
+// group names (or numeric IDs). An empty name yields -1, meaning
+// "leave unchanged" for os.Chown.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		id := owner
+		if _, err := strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("invalid Owner %q: %s", owner, err)
+			}
+			id = u.Uid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return -1, -1, fmt.Errorf("invalid Owner %q: non-numeric uid %q", owner, id)
+		}
+		uid = n
+	}
+	if group != "" {
+		id := group
+		if _, err := strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("invalid Group %q: %s", group, err)
+			}
+			id = g.Gid
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return -1, -1, fmt.Errorf("invalid Group %q: non-numeric gid %q", group, id)
+		}
+		gid = n
+	}
+	return uid, gid, nil
+}
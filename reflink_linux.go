@@ -0,0 +1,13 @@
+package getlatest
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst a copy-on-write clone of src (FICLONE), if the
+// filesystem supports it (e.g., btrfs, XFS).
+func reflink(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
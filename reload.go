@@ -0,0 +1,107 @@
+package getlatest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignalProcess configures a signal sent to a process (e.g., a
+// server that reloads its config on SIGHUP) after each update.
+type SignalProcess struct {
+	PIDFile string // file containing the process ID
+	Name    string // or process name, as in /proc/PID/comm (Linux only)
+	Signal  string // e.g., "HUP" (default), "USR1", "SIGUSR2"
+}
+
+// reloadTimeout is the maximum time to wait for a ReloadUnit job to
+// finish.
+const reloadTimeout = time.Minute
+
+func (g *Getter) setupReload() error {
+	g.reloadUnit = g.ReloadUnit
+	if g.reloadUnit != "" {
+		if err := checkSystemd(); err != nil {
+			return err
+		}
+	}
+	if g.reloadUnit != "" && !strings.Contains(g.reloadUnit, ".") {
+		// Like systemctl, assume a service unit.
+		g.reloadUnit += ".service"
+	}
+	sp := g.SignalProcess
+	if sp == nil {
+		return nil
+	}
+	if (sp.PIDFile == "") == (sp.Name == "") {
+		return fmt.Errorf("SignalProcess requires exactly one of PIDFile or Name")
+	}
+	if _, err := parseSignal(sp.Signal); err != nil {
+		return fmt.Errorf("invalid SignalProcess Signal: %s", err)
+	}
+	return nil
+}
+
+// reloadConsumers reloads ReloadUnit and sends the SignalProcess
+// signal, if configured. Errors are logged but do not make the
+// download count as a failure, since the output file has already
+// been replaced.
+func (g *Getter) reloadConsumers() {
+	if g.reloadUnit != "" {
+		err := g.reloadSystemdUnit()
+		if err != nil {
+			g.logger().Error("error reloading unit", "unit", g.reloadUnit, "error", err)
+		} else {
+			g.logger().Info("reloaded unit", "unit", g.reloadUnit)
+		}
+	}
+	if g.SignalProcess != nil {
+		err := g.signalProcess()
+		if err != nil {
+			g.logger().Error("error signaling process", "error", err)
+		}
+	}
+}
+
+// signalProcess sends the SignalProcess signal to the process
+// identified by PIDFile or Name.
+func (g *Getter) signalProcess() error {
+	sp := g.SignalProcess
+	sig, err := parseSignal(sp.Signal)
+	if err != nil {
+		return err
+	}
+	var pids []int
+	if sp.PIDFile != "" {
+		buf, err := ioutil.ReadFile(sp.PIDFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+		if err != nil || pid <= 0 {
+			return fmt.Errorf("invalid process ID in %q", sp.PIDFile)
+		}
+		pids = []int{pid}
+	} else {
+		pids, err = findProcesses(sp.Name)
+		if err != nil {
+			return err
+		} else if len(pids) == 0 {
+			return fmt.Errorf("no process named %q", sp.Name)
+		}
+	}
+	for _, pid := range pids {
+		proc, err := os.FindProcess(pid)
+		if err == nil {
+			err = proc.Signal(sig)
+		}
+		if err != nil {
+			return fmt.Errorf("error sending %s to process %d: %s", sig, pid, err)
+		}
+		g.logger().Info("sent signal", "pid", pid, "signal", sig.String())
+	}
+	return nil
+}
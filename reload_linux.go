@@ -0,0 +1,41 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// checkSystemd returns an error if ReloadUnit is not supported on
+// this platform.
+func checkSystemd() error {
+	return nil
+}
+
+// reloadSystemdUnit asks systemd (via D-Bus) to reload ReloadUnit,
+// or restart it if it does not support reloading, and waits for the
+// job to finish.
+func (g *Getter) reloadSystemdUnit() error {
+	ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+	defer cancel()
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to systemd: %s", err)
+	}
+	defer conn.Close()
+	done := make(chan string, 1)
+	_, err = conn.ReloadOrRestartUnitContext(ctx, g.reloadUnit, "replace", done)
+	if err != nil {
+		return err
+	}
+	select {
+	case result := <-done:
+		if result != "done" {
+			return fmt.Errorf("reload job result %q", result)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package getlatest
+
+import (
+	"errors"
+)
+
+var errNoSystemd = errors.New("ReloadUnit requires systemd")
+
+func checkSystemd() error {
+	return errNoSystemd
+}
+
+func (g *Getter) reloadSystemdUnit() error {
+	return errNoSystemd
+}
@@ -0,0 +1,124 @@
+//go:build !windows
+
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalProcess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	hupped := filepath.Join(tmpdir, "hupped")
+	cmd := exec.Command("/bin/sh", "-c", `trap 'echo hup >"$0"; exit 0' HUP; while :; do sleep 0.05; done`, hupped)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	pidfile := filepath.Join(tmpdir, "pid")
+	ioutil.WriteFile(pidfile, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0666)
+	// Give the shell time to set up its trap.
+	time.Sleep(200 * time.Millisecond)
+
+	g := &Getter{
+		URL:           srv.URL,
+		Output:        filepath.Join(tmpdir, "foo"),
+		SignalProcess: &SignalProcess{PIDFile: pidfile},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	if buf, err := ioutil.ReadFile(hupped); err != nil || string(buf) != "hup\n" {
+		t.Errorf("process did not get SIGHUP: %q, %v", buf, err)
+	}
+}
+
+func TestSignalProcessByName(t *testing.T) {
+	if _, err := os.Stat("/proc/self/comm"); err != nil {
+		t.Skip("no /proc")
+	}
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Use a copy of sleep with a unique name, so we don't
+	// signal any other processes.
+	buf, err := ioutil.ReadFile(sleep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("glsleep%d", os.Getpid()%100000)
+	bin := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(bin, buf, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	g := &Getter{SignalProcess: &SignalProcess{Name: name, Signal: "SIGTERM"}}
+	err = g.signalProcess()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Wait()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || !status.Signaled() || status.Signal() != syscall.SIGTERM {
+		t.Errorf("process was not terminated by SIGTERM: %v", err)
+	}
+
+	g.SignalProcess.Name = name + "x"
+	if err := g.signalProcess(); err == nil {
+		t.Error("expected error for nonexistent process name")
+	}
+}
+
+func TestSetupReload(t *testing.T) {
+	for _, trial := range []struct {
+		sp *SignalProcess
+		ok bool
+	}{
+		{&SignalProcess{PIDFile: "/run/nginx.pid"}, true},
+		{&SignalProcess{Name: "nginx", Signal: "usr2"}, true},
+		{&SignalProcess{}, false},
+		{&SignalProcess{PIDFile: "/run/nginx.pid", Name: "nginx"}, false},
+		{&SignalProcess{Name: "nginx", Signal: "SIGBOGUS"}, false},
+	} {
+		g := &Getter{SignalProcess: trial.sp}
+		if err := g.setupReload(); (err == nil) != trial.ok {
+			t.Errorf("%+v: got error %v", trial.sp, err)
+		}
+	}
+	g := &Getter{ReloadUnit: "nginx"}
+	if runtime.GOOS != "linux" {
+		if err := g.setupReload(); err == nil {
+			t.Error("expected ReloadUnit error on non-Linux system")
+		}
+		return
+	}
+	if err := g.setupReload(); err != nil || g.reloadUnit != "nginx.service" || g.ReloadUnit != "nginx" {
+		t.Errorf("ReloadUnit %q, reloadUnit %q, err %v", g.ReloadUnit, g.reloadUnit, err)
+	}
+}
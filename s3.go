@@ -0,0 +1,173 @@
+package getlatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// gcsEndpoint is the Google Cloud Storage XML API endpoint, which is
+// compatible with S3 when using HMAC keys as AWS credentials.
+var gcsEndpoint = "https://storage.googleapis.com"
+
+// setupS3 prepares an S3 client using the standard AWS credential
+// chain (environment, shared config/credentials files, instance
+// role, etc.).
+func (g *Getter) setupS3(u *url.URL) error {
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("s3 URL %q must be of the form s3://bucket/key", u.Redacted())
+	}
+	client, err := g.newS3Client(g.S3Region, g.S3Endpoint)
+	if err != nil {
+		return err
+	}
+	g.s3client = client
+	return nil
+}
+
+// newS3Client returns an S3 client for the given region (if not
+// empty, otherwise from the AWS config, or us-east-1) and endpoint
+// (if not empty, otherwise AWS).
+func (g *Getter) newS3Client(region, endpoint string) (*s3.Client, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %s", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.HTTPClient = &http.Client{Transport: g.transport()}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			// MinIO and most other S3-compatible
+			// services need path-style URLs.
+			o.UsePathStyle = true
+			// Many S3-compatible services (including
+			// GCS) don't accept the SDK's default
+			// streaming checksums.
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		}
+	}), nil
+}
+
+// A mirrorUpload is a Mirror destination.
+type mirrorUpload struct {
+	url    string
+	client *s3.Client
+	bucket string
+	key    string
+}
+
+// setupMirrorUploads checks the Mirror destinations and prepares a
+// client for each one.
+func (g *Getter) setupMirrorUploads() error {
+	g.mirrorUploads = nil
+	for _, dest := range g.Mirror {
+		u, err := url.Parse(dest)
+		if err != nil {
+			return fmt.Errorf("invalid Mirror %q: %s", dest, err)
+		}
+		if (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("invalid Mirror %q: must be of the form s3://bucket/key or gs://bucket/key", u.Redacted())
+		}
+		region, endpoint := g.S3Region, g.S3Endpoint
+		if u.Scheme == "gs" {
+			region, endpoint = "auto", gcsEndpoint
+		}
+		client, err := g.newS3Client(region, endpoint)
+		if err != nil {
+			return err
+		}
+		g.mirrorUploads = append(g.mirrorUploads, mirrorUpload{
+			url:    u.Redacted(),
+			client: client,
+			bucket: u.Host,
+			key:    strings.TrimPrefix(u.Path, "/"),
+		})
+	}
+	return nil
+}
+
+// uploadMirrors uploads the named file to each Mirror destination.
+func (g *Getter) uploadMirrors(ctx context.Context, name string) error {
+	for _, m := range g.mirrorUploads {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err == nil {
+			_, err = m.client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:        aws.String(m.bucket),
+				Key:           aws.String(m.key),
+				Body:          f,
+				ContentLength: aws.Int64(fi.Size()),
+			})
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("uploading to Mirror %q: %s", m.url, err)
+		}
+		g.logger().Info("uploaded to mirror", "mirror", m.url, "bytes", fi.Size())
+	}
+	return nil
+}
+
+func (g *Getter) fetchS3(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	u, err := url.Parse(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	}
+	if g.haveOutput() && g.etag != "" {
+		input.IfNoneMatch = aws.String(g.etag)
+	}
+	obj, err := g.s3client.GetObject(ctx, input)
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotModified {
+		return fetched{}, errNotModified
+	} else if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer obj.Body.Close()
+	if err := g.checkContentType(aws.ToString(obj.ContentType)); err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	if obj.ContentLength != nil {
+		if err := g.checkMaximumSize(*obj.ContentLength); err != nil {
+			return fetched{}, err
+		}
+		if err := g.checkFreeSpace(*obj.ContentLength); err != nil {
+			return fetched{}, err
+		}
+	}
+	n, err := g.copyBody(f, obj.Body, 0)
+	if err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", srcurl, err)
+	}
+	result := fetched{
+		size: n,
+		etag: aws.ToString(obj.ETag),
+	}
+	if obj.LastModified != nil {
+		result.modtime = obj.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return result, nil
+}
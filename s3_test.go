@@ -0,0 +1,122 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	var reqs []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs = append(reqs, req)
+		if req.URL.Path != "/bucket/dir/foo.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := Getter{
+		URL:        "s3://bucket/dir/foo.txt",
+		Output:     filepath.Join(t.TempDir(), "foo"),
+		S3Endpoint: srv.URL,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if h := reqs[1].Header.Get("If-None-Match"); h != `"abc"` {
+		t.Errorf("wrong If-None-Match %q in second request", h)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	var mtx sync.Mutex
+	puts := map[string]string{}
+	fail := false
+	bucketsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || fail {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		buf, _ := ioutil.ReadAll(req.Body)
+		mtx.Lock()
+		puts[req.Host+req.URL.Path] = string(buf)
+		mtx.Unlock()
+	}))
+	defer bucketsrv.Close()
+	defer func(orig string) { gcsEndpoint = orig }(gcsEndpoint)
+	gcsEndpoint = bucketsrv.URL + "/gcs"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	g := Getter{
+		URL:        srv.URL + "/foo.txt",
+		Output:     filepath.Join(t.TempDir(), "foo"),
+		S3Endpoint: bucketsrv.URL,
+		Mirror:     []string{"s3://bucket/dir/foo.txt", "gs://gbucket/foo.txt"},
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(bucketsrv.URL, "http://")
+	for _, path := range []string{"/bucket/dir/foo.txt", "/gcs/gbucket/foo.txt"} {
+		if got := puts[host+path]; got != "hello\n" {
+			t.Errorf("%s: uploaded %q", path, got)
+		}
+	}
+
+	fail = true
+	g.lastSuccess = time.Time{}
+	if err := g.trydownload(context.Background()); err == nil || !strings.Contains(err.Error(), "Mirror") {
+		t.Errorf("expected Mirror upload error, got %v", err)
+	}
+
+	for _, dest := range []string{"https://host/x", "s3://bucket", "gs:///key"} {
+		g := Getter{URL: srv.URL, Output: g.Output, Mirror: []string{dest}}
+		if err := g.Setup(); err == nil {
+			t.Errorf("Mirror %q: expected Setup error", dest)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package getlatest
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// A scheduler runs a Manager's getters. It keeps them in a queue
+// ordered by the next time each one needs to check whether a download
+// is due (see nextCheck), and uses a single timer to wait for the
+// earliest one, instead of one timer per getter.
+//
+// Each check (and any resulting download) runs in its own goroutine,
+// so a slow download does not delay other getters. At most one check
+// runs at a time for a given getter.
+type scheduler struct {
+	mtx     sync.Mutex
+	queue   schedQueue
+	entries map[*Getter]*schedEntry
+	kick    chan struct{} // queue changed
+}
+
+type schedEntry struct {
+	g       *Getter
+	at      time.Time // time of next check
+	index   int       // position in queue, -1 while busy
+	busy    bool      // check in progress
+	again   bool      // notified while busy, check again right away
+	removed bool      // close g.done when the current check finishes
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		entries: map[*Getter]*schedEntry{},
+		kick:    make(chan struct{}, 1),
+	}
+}
+
+// run starts checks as they come due, until ctx is cancelled.
+func (s *scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mtx.Lock()
+		now := time.Now()
+		for len(s.queue) > 0 && !s.queue[0].at.After(now) {
+			e := heap.Pop(&s.queue).(*schedEntry)
+			e.busy = true
+			go s.check(ctx, e)
+		}
+		var next <-chan time.Time
+		if len(s.queue) > 0 {
+			timer.Reset(s.queue[0].at.Sub(now))
+			next = timer.C
+		}
+		s.mtx.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.kick:
+		case <-next:
+		}
+	}
+}
+
+// check runs a single check for e's getter, then puts it back in the
+// queue.
+func (s *scheduler) check(ctx context.Context, e *schedEntry) {
+	wait := e.g.check(ctx)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e.busy = false
+	if e.removed {
+		close(e.g.done)
+		return
+	}
+	e.at = time.Now()
+	if e.again {
+		e.again = false
+	} else {
+		e.at = e.at.Add(wait)
+	}
+	e.g.checkIn(e.at)
+	heap.Push(&s.queue, e)
+	s.poke()
+}
+
+// add starts checking g, beginning right away.
+func (s *scheduler) add(g *Getter) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e := &schedEntry{g: g, at: time.Now()}
+	s.entries[g] = e
+	heap.Push(&s.queue, e)
+	s.poke()
+}
+
+// remove stops checking g, and waits for any check (and download) in
+// progress to finish.
+func (s *scheduler) remove(g *Getter) {
+	s.mtx.Lock()
+	e, ok := s.entries[g]
+	if !ok {
+		s.mtx.Unlock()
+		return
+	}
+	delete(s.entries, g)
+	if e.busy {
+		e.removed = true
+		s.mtx.Unlock()
+		<-g.done
+		return
+	}
+	heap.Remove(&s.queue, e.index)
+	close(g.done)
+	s.mtx.Unlock()
+}
+
+// wake makes g check again right away, or as soon as its current
+// check finishes.
+func (s *scheduler) wake(g *Getter) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e, ok := s.entries[g]
+	if !ok {
+		return
+	}
+	if e.busy {
+		e.again = true
+		return
+	}
+	e.at = time.Now()
+	heap.Fix(&s.queue, e.index)
+	s.poke()
+}
+
+// poke tells s.run that the queue has changed. The caller must
+// hold s.mtx.
+func (s *scheduler) poke() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// schedQueue implements heap.Interface, ordered by next check time.
+type schedQueue []*schedEntry
+
+func (q schedQueue) Len() int           { return len(q) }
+func (q schedQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q schedQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *schedQueue) Push(x interface{}) {
+	e := x.(*schedEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *schedQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
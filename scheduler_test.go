@@ -0,0 +1,72 @@
+package getlatest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerTriggerWhileBusy(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&hits, 1) == 1 {
+			<-release
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	getters := map[string]*Getter{}
+	for _, name := range []string{"slow", "other"} {
+		g := &Getter{
+			URL:    srv.URL + "/" + name,
+			Output: filepath.Join(tmpdir, name),
+			TTL:    "24h",
+		}
+		if name == "other" {
+			// Not due, so the scheduler has a second
+			// entry waiting in its queue.
+			g.lastSuccess = time.Now()
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatal(err)
+		}
+		getters[g.Output] = g
+	}
+	slow := filepath.Join(tmpdir, "slow")
+
+	var mgr Manager
+	mgr.Start(getters)
+	defer mgr.Stop()
+
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("first download to start", func() bool { return atomic.LoadInt64(&hits) == 1 })
+
+	// Triggering while the first download is in progress starts
+	// another one as soon as it finishes.
+	if err := mgr.TriggerNow(slow); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	waitFor("triggered download", func() bool { return atomic.LoadInt64(&hits) == 2 })
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt64(&hits); n != 2 {
+		t.Errorf("expected 2 downloads, got %d", n)
+	}
+	if stuck := mgr.Stuck(); len(stuck) != 0 {
+		t.Errorf("unexpected stuck getters: %v", stuck)
+	}
+}
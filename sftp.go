@@ -0,0 +1,157 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// setupSFTP checks the SFTP-specific configuration and prepares an
+// ssh client config.
+func (g *Getter) setupSFTP(u *url.URL) error {
+	user := g.Username
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	netrc, err := g.netrcLogin(u.Hostname())
+	if err != nil {
+		return err
+	}
+	if netrc != nil {
+		// The netrc password is loaded here, not re-read
+		// for each connection.
+		if _, err := g.readSetupFile(g.NetrcFile); err != nil {
+			return fmt.Errorf("error reading NetrcFile: %s", err)
+		}
+	}
+	if user == "" && netrc != nil {
+		user = netrc.login
+	}
+	if user == "" {
+		return fmt.Errorf("sftp URL %q requires a Username", u.Redacted())
+	}
+
+	var auth []ssh.AuthMethod
+	if g.PrivateKeyFile != "" {
+		buf, err := g.readSetupFile(g.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading PrivateKeyFile: %s", err)
+		}
+		var signer ssh.Signer
+		if g.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(buf, []byte(g.Password))
+		} else {
+			signer, err = ssh.ParsePrivateKey(buf)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing PrivateKeyFile %q: %s", g.PrivateKeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if pw := g.Password; pw != "" {
+		auth = append(auth, ssh.Password(pw))
+	} else if pw, ok := u.User.Password(); ok {
+		auth = append(auth, ssh.Password(pw))
+	} else if netrc != nil && netrc.login == user && netrc.password != "" {
+		auth = append(auth, ssh.Password(netrc.password))
+	} else {
+		return fmt.Errorf("sftp URL %q requires a Password or PrivateKeyFile", u.Redacted())
+	}
+
+	knownHostsFile := g.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot find default KnownHostsFile: %s", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if _, err := g.readSetupFile(knownHostsFile); err != nil {
+		return fmt.Errorf("error loading KnownHostsFile: %s", err)
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return fmt.Errorf("error loading KnownHostsFile: %s", err)
+	}
+
+	g.sshConfig = &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         g.connectTimeout,
+	}
+	return nil
+}
+
+func (g *Getter) fetchSFTP(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	u, err := url.Parse(srcurl)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	// Like ssh.Dial, but using dialContext. The host key is
+	// checked against the original addr.
+	netconn, err := g.dialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	sshconn, chans, reqs, err := ssh.NewClientConn(netconn, addr, g.sshConfig)
+	if err != nil {
+		netconn.Close()
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	conn := ssh.NewClient(sshconn, chans, reqs)
+	defer conn.Close()
+	go func() {
+		// Abort the transfer if ctx is done (e.g.,
+		// DownloadTimeout is reached).
+		<-ctx.Done()
+		conn.Close()
+	}()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer client.Close()
+
+	src, err := client.Open(u.Path)
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return fetched{}, fmt.Errorf("%q: %s", srcurl, err)
+	}
+	// SFTP has no ETag, so we use the size and modification
+	// time of the remote file instead.
+	etag := fmt.Sprintf("%d-%d", fi.Size(), fi.ModTime().UnixNano())
+	if g.haveOutput() && etag == g.etag {
+		return fetched{}, errNotModified
+	}
+	if err := g.checkMaximumSize(fi.Size()); err != nil {
+		return fetched{}, err
+	}
+	if err := g.checkFreeSpace(fi.Size()); err != nil {
+		return fetched{}, err
+	}
+	n, err := g.copyBody(f, src, 0)
+	if err != nil {
+		return fetched{}, fmt.Errorf("downloading %q to tempfile: %s", srcurl, err)
+	}
+	return fetched{
+		size:    n,
+		etag:    etag,
+		modtime: fi.ModTime().UTC().Format(http.TimeFormat),
+	}, nil
+}
@@ -0,0 +1,242 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpTestServer is an SSH server that accepts the given password or
+// public key for any user, and serves the local filesystem over the
+// sftp subsystem.
+type sftpTestServer struct {
+	ln      net.Listener
+	hostKey ssh.Signer
+}
+
+func newSFTPTestServer(t *testing.T, password string, clientKey ssh.PublicKey) *sftpTestServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if string(pw) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	config.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return &sftpTestServer{ln: ln, hostKey: hostKey}
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newch := range chans {
+		if newch.ChannelType() != "session" {
+			newch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, reqs, err := newch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				// The payload is a length-prefixed
+				// subsystem name.
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				srv, err := sftp.NewServer(ch)
+				if err != nil {
+					ch.Close()
+					return
+				}
+				srv.Serve()
+				ch.Close()
+			}
+		}()
+	}
+}
+
+// knownHosts writes a known_hosts file with the given host key for
+// the server's address, and returns its path.
+func (srv *sftpTestServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{srv.ln.Addr().String()}, key)
+	if err := ioutil.WriteFile(path, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSFTP(t *testing.T) {
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newSFTPTestServer(t, "secret", clientSigner.PublicKey())
+	knownHostsFile := srv.knownHosts(t, srv.hostKey.PublicKey())
+
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongHostsFile := srv.knownHosts(t, otherSigner.PublicKey())
+
+	remote := filepath.Join(t.TempDir(), "remote.txt")
+	if err := ioutil.WriteFile(remote, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("sftp://%s%s", srv.ln.Addr(), remote)
+
+	for _, trial := range []struct {
+		name           string
+		password       string
+		privateKeyFile string
+		knownHostsFile string
+		errMsg         string
+	}{
+		{name: "password", password: "secret", knownHostsFile: knownHostsFile},
+		{name: "key", privateKeyFile: keyFile, knownHostsFile: knownHostsFile},
+		{name: "wrong password", password: "wrong", knownHostsFile: knownHostsFile, errMsg: "unable to authenticate"},
+		{name: "host key mismatch", password: "secret", knownHostsFile: wrongHostsFile, errMsg: "key mismatch"},
+	} {
+		g := Getter{
+			URL:            url,
+			Output:         filepath.Join(t.TempDir(), "foo"),
+			Username:       "testuser",
+			Password:       trial.password,
+			PrivateKeyFile: trial.privateKeyFile,
+			KnownHostsFile: trial.knownHostsFile,
+		}
+		if err := g.Setup(); err != nil {
+			t.Fatalf("%s: %s", trial.name, err)
+		}
+		err := g.trydownload(context.Background())
+		if trial.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), trial.errMsg) {
+				t.Errorf("%s: expected %q error, got %v", trial.name, trial.errMsg, err)
+			}
+			if _, err := os.Stat(g.Output); !os.IsNotExist(err) {
+				t.Errorf("%s: output file exists after error", trial.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", trial.name, err)
+			continue
+		}
+		if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+			t.Errorf("%s: output file: %q, %v", trial.name, buf, err)
+		}
+	}
+
+	// With the same size and modification time, the remote file
+	// is considered unchanged and is not downloaded again.
+	g := Getter{
+		URL:            url,
+		Output:         filepath.Join(t.TempDir(), "foo"),
+		Username:       "testuser",
+		Password:       "secret",
+		KnownHostsFile: knownHostsFile,
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(remote, []byte("HELLO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(remote, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "hello\n" {
+		t.Errorf("expected unchanged output after not-modified, got %q, %v", buf, err)
+	}
+
+	// A new modification time means the file has changed.
+	mtime := fi.ModTime().Add(time.Minute)
+	if err := os.Chtimes(remote, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "HELLO\n" {
+		t.Errorf("expected updated output, got %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+
+package getlatest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"KILL": syscall.SIGKILL,
+}
+
+// parseSignal returns the signal with the given name, with or
+// without the "SIG" prefix. The default is SIGHUP.
+func parseSignal(name string) (os.Signal, error) {
+	if name == "" {
+		return syscall.SIGHUP, nil
+	}
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// findProcesses returns the IDs of processes with the given name,
+// according to /proc/PID/comm.
+func findProcesses(name string) ([]int, error) {
+	comms, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return nil, err
+	} else if len(comms) == 0 {
+		return nil, fmt.Errorf("cannot find processes by name: /proc is not available")
+	}
+	var pids []int
+	for _, comm := range comms {
+		buf, err := ioutil.ReadFile(comm)
+		if err != nil || strings.TrimSuffix(string(buf), "\n") != name {
+			continue
+		}
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(comm)))
+		if err == nil && pid != os.Getpid() {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,20 @@
+package getlatest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseSignal returns the signal with the given name. Windows only
+// supports KILL.
+func parseSignal(name string) (os.Signal, error) {
+	if strings.TrimPrefix(strings.ToUpper(name), "SIG") != "KILL" {
+		return nil, fmt.Errorf("unsupported signal %q (only KILL is supported on Windows)", name)
+	}
+	return os.Kill, nil
+}
+
+func findProcesses(name string) ([]int, error) {
+	return nil, fmt.Errorf("cannot find processes by name on Windows")
+}
@@ -0,0 +1,109 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// setupSignature loads the public keys used to verify signatures
+// fetched from SignatureURL.
+func (g *Getter) setupSignature() error {
+	if g.SignatureURL == "" {
+		if g.GPGKeyring != "" || g.GPGKeyFile != "" || g.MinisignKey != "" {
+			return fmt.Errorf("GPGKeyring/GPGKeyFile/MinisignKey cannot be used without SignatureURL")
+		}
+		return nil
+	}
+	t, err := template.New("signature").Parse(g.SignatureURL)
+	if err != nil {
+		return fmt.Errorf("error parsing SignatureURL %q: %s", g.SignatureURL, err)
+	}
+	g.signaturet = t
+	g.minisignKey = nil
+	if g.MinisignKey != "" {
+		if g.GPGKeyring != "" || g.GPGKeyFile != "" {
+			return fmt.Errorf("cannot use MinisignKey with GPGKeyring/GPGKeyFile")
+		}
+		g.minisignKey, err = parseMinisignKey(g.MinisignKey)
+		if err != nil {
+			return fmt.Errorf("invalid MinisignKey: %s", err)
+		}
+		return nil
+	}
+	g.gpgKeys = nil
+	for _, path := range []string{g.GPGKeyring, g.GPGKeyFile} {
+		if path == "" {
+			continue
+		}
+		keys, err := g.readKeyRing(path)
+		if err != nil {
+			return fmt.Errorf("error reading GPG keys from %q: %s", path, err)
+		}
+		g.gpgKeys = append(g.gpgKeys, keys...)
+	}
+	if len(g.gpgKeys) == 0 {
+		return fmt.Errorf("SignatureURL requires GPGKeyring, GPGKeyFile, or MinisignKey")
+	}
+	return nil
+}
+
+// readKeyRing reads public keys from an armored or binary keyring
+// file.
+func (g *Getter) readKeyRing(path string) (openpgp.EntityList, error) {
+	buf, err := g.readSetupFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isArmored(buf) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(buf))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(buf))
+}
+
+func isArmored(buf []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(buf), []byte("-----BEGIN "))
+}
+
+// verifySignature fetches the detached signature from SignatureURL
+// and checks it against the given file. It returns nil if no
+// SignatureURL is configured.
+func (g *Getter) verifySignature(ctx context.Context, path string) error {
+	if g.signaturet == nil {
+		return nil
+	}
+	sigurl, err := g.expand(g.signaturet)
+	if err != nil {
+		return fmt.Errorf("error getting signature url: %s", err)
+	}
+	sig, err := g.fetchAux(ctx, sigurl)
+	if err != nil {
+		return err
+	}
+	if g.minisignKey != nil {
+		return g.verifyMinisign(sig, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var signer *openpgp.Entity
+	if isArmored(sig) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(g.gpgKeys, f, bytes.NewReader(sig), nil)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(g.gpgKeys, f, bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %s", err)
+	}
+	for name := range signer.Identities {
+		g.logger().Info("good signature", "signer", name)
+		break
+	}
+	return nil
+}
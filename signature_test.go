@@ -0,0 +1,170 @@
+package getlatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestGPGSignature(t *testing.T) {
+	signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("hello\n")
+	var sig bytes.Buffer
+	err = openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir := t.TempDir()
+	keyfile := filepath.Join(tmpdir, "key.asc")
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.Serialize(w)
+	w.Close()
+	err = ioutil.WriteFile(keyfile, key.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/good.txt":
+			w.Write(content)
+		case "/bad.txt":
+			w.Write([]byte("hullo\n"))
+		default:
+			w.Write(sig.Bytes())
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path string
+		ok   bool
+	}{
+		{"/good.txt", true},
+		{"/bad.txt", false},
+	} {
+		g := &Getter{
+			URL:          srv.URL + trial.path,
+			Output:       filepath.Join(tmpdir, "out"+strings.Replace(trial.path, "/", "-", -1)),
+			SignatureURL: srv.URL + trial.path + ".asc",
+			GPGKeyFile:   keyfile,
+		}
+		err = g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%s: %s", trial.path, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s: expected signature failure", trial.path)
+		}
+		if _, err := os.Stat(g.Output); (err == nil) != trial.ok {
+			t.Errorf("%s: output file stat: %v", trial.path, err)
+		}
+	}
+}
+
+func TestMinisignSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte("12345678")
+	pubkey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+	content := []byte("hello\n")
+	hash := blake2b.Sum512(content)
+
+	sign := func(alg string, keyID []byte, msg []byte) []byte {
+		return append(append([]byte(alg), keyID...), ed25519.Sign(priv, msg)...)
+	}
+	minisig := func(alg string, keyID []byte, msg []byte, trusted string) string {
+		sig := sign(alg, keyID, msg)
+		global := ed25519.Sign(priv, append(sig[10:], trusted...))
+		return "untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(sig) + "\n" +
+			"trusted comment: " + trusted + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n"
+	}
+	sigs := map[string]string{
+		"/prehashed.minisig": minisig("ED", keyID, hash[:], "timestamp:1234"),
+		"/legacy.minisig":    minisig("Ed", keyID, content, "timestamp:1234"),
+		"/signify.sig":       "untrusted comment: verify with test.pub\n" + base64.StdEncoding.EncodeToString(sign("Ed", keyID, content)) + "\n",
+		"/wrongkey.minisig":  minisig("ED", []byte("87654321"), hash[:], "timestamp:1234"),
+		"/badsig.minisig":    minisig("ED", keyID, content, "timestamp:1234"),
+		"/badtrusted.minisig": strings.Replace(minisig("ED", keyID, hash[:], "timestamp:1234"),
+			"timestamp:1234", "timestamp:9999", 1),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if sig, ok := sigs[req.URL.Path]; ok {
+			w.Write([]byte(sig))
+		} else {
+			w.Write(content)
+		}
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	for _, trial := range []struct {
+		sigpath string
+		key     string
+		ok      bool
+	}{
+		{"/prehashed.minisig", pubkey, true},
+		{"/legacy.minisig", pubkey, true},
+		{"/signify.sig", pubkey, true},
+		{"/prehashed.minisig", "untrusted comment: minisign public key 12345678\n" + pubkey + "\n", true},
+		{"/wrongkey.minisig", pubkey, false},
+		{"/badsig.minisig", pubkey, false},
+		{"/badtrusted.minisig", pubkey, false},
+	} {
+		g := &Getter{
+			URL:          srv.URL + "/file.txt",
+			Output:       filepath.Join(tmpdir, "out"+strings.Replace(trial.sigpath, "/", "-", -1)),
+			SignatureURL: srv.URL + trial.sigpath,
+			MinisignKey:  trial.key,
+		}
+		err = g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.ok && err != nil {
+			t.Errorf("%s: %s", trial.sigpath, err)
+		} else if !trial.ok && err == nil {
+			t.Errorf("%s: expected signature failure", trial.sigpath)
+		}
+	}
+
+	for _, bad := range []*Getter{
+		{MinisignKey: pubkey},
+		{SignatureURL: srv.URL + "/signify.sig", MinisignKey: "RWQ"},
+		{SignatureURL: srv.URL + "/signify.sig", MinisignKey: pubkey, GPGKeyFile: "/dev/null"},
+	} {
+		bad.URL = srv.URL + "/file.txt"
+		bad.Output = filepath.Join(tmpdir, "bad")
+		if err := bad.Setup(); err == nil {
+			t.Errorf("SignatureURL %q MinisignKey %q: expected Setup error", bad.SignatureURL, bad.MinisignKey)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var minSpeedRegexp = regexp.MustCompile(`^\s*([0-9.]+)\s*([KMG]i?)?B/s\s*(?:over\s+(\S+))?\s*$`)
+
+// parseMinSpeed parses a MinSpeed value like "50KB/s over 30s" and
+// returns the speed in bytes per second and the interval. KB, MB,
+// and GB are powers of 1000; KiB, MiB, and GiB are powers of 1024.
+func parseMinSpeed(s string) (float64, time.Duration, error) {
+	m := minSpeedRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid MinSpeed %q (example: \"50KB/s over 30s\")", s)
+	}
+	speed, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || speed <= 0 {
+		return 0, 0, fmt.Errorf("invalid MinSpeed %q: speed must be a positive number", s)
+	}
+	if m[2] != "" {
+		base := 1000.0
+		if strings.HasSuffix(m[2], "i") {
+			base = 1024
+		}
+		speed *= map[byte]float64{'K': base, 'M': base * base, 'G': base * base * base}[m[2][0]]
+	}
+	window := 30 * time.Second
+	if m[3] != "" {
+		window, err = time.ParseDuration(m[3])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid MinSpeed %q: %s", s, err)
+		} else if window < time.Second {
+			return 0, 0, fmt.Errorf("invalid MinSpeed %q: interval must be at least 1s", s)
+		}
+	}
+	return speed, window, nil
+}
+
+// fetchMinSpeed calls fetch, aborting it if fewer than MinSpeed bytes
+// per second are written to f (see copyBody) during any MinSpeed
+// interval. Concurrent attempts (see HedgeAfter) write to different
+// files, so each one is measured separately.
+func (g *Getter) fetchMinSpeed(ctx context.Context, f *os.File, srcurl string) (fetched, error) {
+	if g.minSpeed <= 0 {
+		return g.fetch(ctx, f, srcurl)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+	minSpeed, window, spec := g.minSpeed, g.minSpeedWindow, g.MinSpeed
+	progress := g.progressCounter(f)
+	defer g.progress.Delete(f)
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		last := progress.Load()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			n := progress.Load()
+			if speed := float64(n-last) / window.Seconds(); speed < minSpeed {
+				cancel(fmt.Errorf("transfer speed %.0f bytes/s over %s is below MinSpeed %q", speed, window, spec))
+				return
+			}
+			last = n
+		}
+	}()
+	fetched, err := g.fetch(ctx, f, srcurl)
+	if err != nil && ctx.Err() != nil {
+		// Depending on where it was interrupted, err may or
+		// may not already mention the cause.
+		if cause := context.Cause(ctx); cause != ctx.Err() && !strings.Contains(err.Error(), cause.Error()) {
+			err = fmt.Errorf("%s: %s", cause, err)
+		}
+	}
+	return fetched, err
+}
+
+// progressCounter returns the counter of bytes written to f during
+// the current download attempt.
+func (g *Getter) progressCounter(f *os.File) *atomic.Int64 {
+	n, _ := g.progress.LoadOrStore(f, new(atomic.Int64))
+	return n.(*atomic.Int64)
+}
+
+// progressWriter counts bytes written to w in n.
+type progressWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (pw progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,95 @@
+package getlatest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMinSpeed(t *testing.T) {
+	for _, trial := range []struct {
+		spec   string
+		speed  float64
+		window time.Duration
+		ok     bool
+	}{
+		{"50KB/s over 30s", 50000, 30 * time.Second, true},
+		{"50KiB/s over 1m", 50 * 1024, time.Minute, true},
+		{"1.5MB/s", 1500000, 30 * time.Second, true},
+		{"100B/s over 10s", 100, 10 * time.Second, true},
+		{"2GiB/s", 2 << 30, 30 * time.Second, true},
+		{"50KB", 0, 0, false},
+		{"0KB/s", 0, 0, false},
+		{"50KB/s over 10ms", 0, 0, false},
+		{"50KB/s over soon", 0, 0, false},
+		{"50TB/s", 0, 0, false},
+	} {
+		speed, window, err := parseMinSpeed(trial.spec)
+		if !trial.ok {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v %v", trial.spec, speed, window)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", trial.spec, err)
+		} else if speed != trial.speed || window != trial.window {
+			t.Errorf("%q: expected %v %v, got %v %v", trial.spec, trial.speed, trial.window, speed, window)
+		}
+	}
+}
+
+func TestMinSpeed(t *testing.T) {
+	stall := make(chan struct{})
+	defer close(stall)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "100000")
+		w.Write(make([]byte, 500))
+		w.(http.Flusher).Flush()
+		if req.URL.Path == "/stall" {
+			select {
+			case <-stall:
+			case <-req.Context().Done():
+			}
+			return
+		}
+		w.Write(make([]byte, 99500))
+	}))
+	defer srv.Close()
+
+	g := &Getter{
+		URL:      srv.URL + "/stall",
+		URLs:     []string{srv.URL + "/ok"},
+		Output:   filepath.Join(t.TempDir(), "out"),
+		MinSpeed: "1KB/s over 1s",
+	}
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now()
+	if err := g.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(t0); d > 10*time.Second {
+		t.Errorf("stalled download took %s to abort", d)
+	}
+
+	g.URLs = nil
+	g.Output = filepath.Join(t.TempDir(), "out")
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	err := g.trydownload(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "below MinSpeed") {
+		t.Errorf("expected MinSpeed error, got %v", err)
+	}
+
+	g.MinSpeed = "fast"
+	if err := g.Setup(); err == nil {
+		t.Error("expected Setup error for invalid MinSpeed")
+	}
+}
@@ -0,0 +1,156 @@
+package getlatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// targetState is the runtime state of a Getter that is carried over
+// when the getter is replaced after a config change, and saved in
+// the state file across restarts.
+type targetState struct {
+	URLs             []string
+	LastSuccess      time.Time
+	FailSince        time.Time
+	FailStreak       int
+	LastError        string
+	RetryDelay       time.Duration
+	RetryAt          time.Time
+	ETag             string
+	LastModified     string
+	PartialValidator string
+	Paused           bool
+}
+
+func (g *Getter) state() targetState {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return targetState{
+		URLs:             g.allURLs(),
+		LastSuccess:      g.lastSuccess,
+		FailSince:        g.failSince,
+		FailStreak:       g.failStreak,
+		LastError:        g.lastError,
+		RetryDelay:       g.retryDelay,
+		RetryAt:          g.retryAt,
+		ETag:             g.etag,
+		LastModified:     g.modtime,
+		PartialValidator: g.partialValidator,
+		Paused:           g.paused.Load(),
+	}
+}
+
+// restore copies the given state into g. ETag, Last-Modified, and
+// partial download validator are only restored if the state was
+// saved with the same URLs.
+func (g *Getter) restore(st targetState) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if st.LastSuccess.After(g.lastSuccess) {
+		g.lastSuccess = st.LastSuccess
+		g.setLastSuccessGauge()
+	}
+	g.failSince = st.FailSince
+	g.paused.Store(st.Paused)
+	g.failStreak = st.FailStreak
+	g.lastError = st.LastError
+	if fmt.Sprint(st.URLs) == fmt.Sprint(g.allURLs()) {
+		g.etag = st.ETag
+		g.modtime = st.LastModified
+		g.partialValidator = st.PartialValidator
+	}
+	if !g.failSince.IsZero() {
+		g.failGauge.Set(time.Now().Sub(g.failSince).Seconds())
+		g.retryDelay = st.RetryDelay
+		if g.retryDelay > g.maxRetryInterval {
+			g.retryDelay = g.maxRetryInterval
+		}
+		g.retryAt = st.RetryAt
+		g.retryGauge.Set(g.retryDelay.Seconds())
+	}
+}
+
+// LoadState restores the state (ETags, failure streaks, etc.) of the
+// given getters from a state file written by SaveState. It should be
+// called before the getters start. A nonexistent state file is not
+// an error.
+func LoadState(path string, getters map[string]*Getter) error {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var states map[string]targetState
+	err = json.Unmarshal(buf, &states)
+	if err != nil {
+		return fmt.Errorf("error decoding state file %q: %s", path, err)
+	}
+	for output, st := range states {
+		if g, ok := getters[output]; ok {
+			g.restore(st)
+		}
+	}
+	return nil
+}
+
+// SaveState writes the state of the given getters to a state file,
+// replacing it atomically.
+func SaveState(path string, getters map[string]*Getter) error {
+	states := map[string]targetState{}
+	for output, g := range getters {
+		states[output] = g.state()
+	}
+	buf, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, file := filepath.Split(path)
+	f, err := ioutil.TempFile(dir, "."+file+".")
+	if err != nil {
+		return fmt.Errorf("error creating state tempfile: %s", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(buf, '\n'))
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing state tempfile: %s", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// stateWriter saves the state file each time a getter signals a
+// state change. It runs until the program exits.
+func (m *Manager) stateWriter() {
+	for range m.stateChanged {
+		m.mtx.Lock()
+		if m.getters == nil {
+			// stopped
+			m.mtx.Unlock()
+			continue
+		}
+		getters := make(map[string]*Getter, len(m.getters))
+		for output, g := range m.getters {
+			getters[output] = g
+		}
+		m.mtx.Unlock()
+		m.saveState(getters)
+	}
+}
+
+func (m *Manager) saveState(getters map[string]*Getter) {
+	m.stateMtx.Lock()
+	defer m.stateMtx.Unlock()
+	if err := SaveState(m.StateFile, getters); err != nil {
+		slog.Error("error saving state file", "path", m.StateFile, "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package getlatest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateFile(t *testing.T) {
+	var inm []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inm = append(inm, req.Header.Get("If-None-Match"))
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if req.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	statefile := filepath.Join(tmpdir, "state.json")
+	newGetters := func() map[string]*Getter {
+		getters := map[string]*Getter{
+			filepath.Join(tmpdir, "foo"): {URL: srv.URL + "/foo"},
+			filepath.Join(tmpdir, "bar"): {URL: srv.URL + "/fail", RetryInterval: "10m"},
+		}
+		for output, g := range getters {
+			g.Output = output
+			if err := g.Setup(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return getters
+	}
+
+	// Nonexistent state file is OK.
+	getters := newGetters()
+	if err := LoadState(statefile, getters); err != nil {
+		t.Fatal(err)
+	}
+	RunOnce(context.Background(), getters, 0)
+	if err := SaveState(statefile, getters); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a restart.
+	getters = newGetters()
+	if err := LoadState(statefile, getters); err != nil {
+		t.Fatal(err)
+	}
+	bar := getters[filepath.Join(tmpdir, "bar")]
+	if bar.failSince.IsZero() || bar.failStreak != 1 || bar.lastError == "" || bar.retryAt.Before(time.Now().Add(9*time.Minute)) {
+		t.Errorf("failure state not restored: %+v", bar.state())
+	}
+	foo := getters[filepath.Join(tmpdir, "foo")]
+	if foo.etag != `"abc"` {
+		t.Errorf("etag not restored: %+v", foo.state())
+	}
+	inm = nil
+	if err := foo.trydownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(inm) != 1 || inm[0] != `"abc"` {
+		t.Errorf("expected conditional request after restart, got If-None-Match %q", inm)
+	}
+
+	// Manager saves state in Stop.
+	os.Remove(statefile)
+	mgr := &Manager{StateFile: statefile}
+	mgr.Start(getters)
+	mgr.Stop()
+	if _, err := os.Stat(statefile); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,111 @@
+package getlatest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+)
+
+// transformer returns a rewriteFunc for a Transform value: "jq:"
+// followed by a jq program, or "template:" followed by a Go
+// text/template.
+func transformer(transform string) (rewriteFunc, error) {
+	if prog, ok := strings.CutPrefix(transform, "jq:"); ok {
+		query, err := gojq.Parse(prog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Transform jq program: %s", err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Transform jq program: %s", err)
+		}
+		return func(w io.Writer, src *os.File) error {
+			return jqTransform(w, src, code)
+		}, nil
+	} else if text, ok := strings.CutPrefix(transform, "template:"); ok {
+		tmpl, err := template.New("Transform").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				buf, err := json.Marshal(v)
+				return string(buf), err
+			},
+		}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Transform template: %s", err)
+		}
+		return func(w io.Writer, src *os.File) error {
+			return templateTransform(w, src, tmpl)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid Transform %q (must start with \"jq:\" or \"template:\")", transform)
+}
+
+// jqTransform runs the jq program on each JSON value in src, like
+// "jq -r": string results are written as is, other results are
+// written as JSON, each followed by a newline.
+func jqTransform(w io.Writer, src io.Reader, code *gojq.Code) error {
+	bw := bufio.NewWriter(w)
+	dec := json.NewDecoder(bufio.NewReader(src))
+	dec.UseNumber()
+	for {
+		var input interface{}
+		err := dec.Decode(&input)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("Transform: error parsing JSON input: %s", err)
+		}
+		iter := code.Run(input)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
+					break
+				}
+				return fmt.Errorf("Transform: %s", err)
+			}
+			if s, ok := v.(string); ok {
+				bw.WriteString(s)
+			} else {
+				buf, err := gojq.Marshal(v)
+				if err != nil {
+					return fmt.Errorf("Transform: %s", err)
+				}
+				bw.Write(buf)
+			}
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// templateTransform executes tmpl with the content of src as ".":
+// the decoded value if src is a single JSON value, otherwise the
+// content as a string.
+func templateTransform(w io.Writer, src io.Reader, tmpl *template.Template) error {
+	buf, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	var data interface{} = string(buf)
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	if dec.Decode(&v) == nil && dec.Decode(new(interface{})) == io.EOF {
+		data = v
+	}
+	bw := bufio.NewWriter(w)
+	if err := tmpl.Execute(bw, data); err != nil {
+		return fmt.Errorf("Transform: %s", err)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,71 @@
+package getlatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api":
+			w.Write([]byte(`{"data": {"version": "1.2.3", "count": 12345678901234567890, "items": [{"name": "a"}, {"name": "b"}]}}`))
+		case "/stream":
+			w.Write([]byte("{\"n\": 1}\n{\"n\": 2}\n"))
+		case "/text":
+			w.Write([]byte("hello world\n"))
+		}
+	}))
+	defer srv.Close()
+
+	for _, trial := range []struct {
+		path      string
+		transform string
+		expect    string
+		setupErr  bool
+	}{
+		{path: "/api", transform: "jq:.data.version", expect: "1.2.3\n"},
+		{path: "/api", transform: "jq:.data.count", expect: "12345678901234567890\n"},
+		{path: "/api", transform: "jq:.data.items[].name", expect: "a\nb\n"},
+		{path: "/api", transform: "jq:.data.items | map(.name)", expect: "[\"a\",\"b\"]\n"},
+		{path: "/stream", transform: "jq:.n * 2", expect: "2\n4\n"},
+		{path: "/text", transform: "jq:.", expect: ""},
+		{path: "/api", transform: "jq:error(\"nope\")", expect: ""},
+		{path: "/api", transform: "template:version={{.data.version}}\n{{range .data.items}}{{.name}},{{end}}", expect: "version=1.2.3\na,b,"},
+		{path: "/api", transform: "template:{{json .data.items}}", expect: `[{"name":"a"},{"name":"b"}]`},
+		{path: "/text", transform: "template:got {{printf \"%q\" .}}", expect: `got "hello world\n"`},
+		{transform: "jq:.[", setupErr: true},
+		{transform: "template:{{.", setupErr: true},
+		{transform: ".data", setupErr: true},
+	} {
+		g := &Getter{
+			URL:       srv.URL + trial.path,
+			Output:    filepath.Join(t.TempDir(), "foo"),
+			Transform: trial.transform,
+		}
+		err := g.Setup()
+		if trial.setupErr {
+			if err == nil {
+				t.Errorf("%s: expected Setup error", trial.transform)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if trial.expect == "" {
+			if err == nil {
+				t.Errorf("%s: expected error", trial.transform)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %s", trial.transform, err)
+		} else if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != trial.expect {
+			t.Errorf("%s: expected %q, got %q, %v", trial.transform, trial.expect, buf, err)
+		}
+	}
+}
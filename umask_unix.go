@@ -0,0 +1,14 @@
+//go:build !windows
+
+package getlatest
+
+import (
+	"os"
+	"syscall"
+)
+
+var umask = func() os.FileMode {
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	return os.FileMode(umask)
+}()
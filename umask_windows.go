@@ -0,0 +1,7 @@
+package getlatest
+
+import "os"
+
+// Windows has no umask. File permissions are only used to set the
+// read-only attribute.
+var umask os.FileMode = 0
@@ -0,0 +1,200 @@
+package getlatest
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unpackOutput extracts the archive in tmpname into a new directory
+// next to the output, then atomically replaces the output symlink
+// with one that points to the new directory, and removes the
+// previous directory. In Versioned mode, the new directory is a
+// version in Output.d, and old versions are pruned instead.
+func (g *Getter) unpackOutput(tmpname, modtime string) error {
+	outdir, outfile := filepath.Split(g.Output)
+	if outdir == "" {
+		outdir = "."
+	}
+	oldTarget, err := os.Readlink(g.Output)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("existing output must be a symlink to use Unpack: %s", err)
+	}
+	parent, prefix := outdir, "."+outfile+"."
+	if g.Versioned {
+		parent, prefix = g.versionDir(), "."
+		if err := os.MkdirAll(parent, 0777); err != nil {
+			return err
+		}
+	}
+	dir, err := os.MkdirTemp(parent, prefix)
+	if err != nil {
+		return fmt.Errorf("error creating directory: %s", err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			os.RemoveAll(dir)
+		}
+	}()
+	err = g.extractAll(tmpname, dir)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0777&^umask); err != nil {
+		return err
+	}
+	if g.uid >= 0 || g.gid >= 0 {
+		if err := os.Chown(dir, g.uid, g.gid); err != nil {
+			return err
+		}
+	}
+	if g.PreserveModTime && modtime != "" {
+		if t, err := http.ParseTime(modtime); err != nil {
+			g.logger().Warn("cannot parse Last-Modified time", "modtime", modtime, "error", err)
+		} else if err := os.Chtimes(dir, time.Now(), t); err != nil {
+			return fmt.Errorf("setting directory mtime: %s", err)
+		}
+	}
+	if !g.NoSync {
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("syncing directory: %s", err)
+		}
+	}
+	if g.Versioned {
+		vpath, err := g.newVersionPath()
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(dir, vpath); err != nil {
+			return err
+		}
+		dir = vpath
+		ok = true
+		return g.switchVersion(vpath)
+	}
+	err = replaceSymlink(filepath.Base(dir), g.Output)
+	if err != nil {
+		return err
+	}
+	ok = true
+	if !g.NoSync {
+		if err := syncDir(outdir); err != nil {
+			g.logger().Warn("error syncing output directory", "error", err)
+		}
+	}
+	// Only remove the previous directory if we created it.
+	if oldTarget != "" && !strings.ContainsRune(oldTarget, os.PathSeparator) && strings.HasPrefix(oldTarget, "."+outfile+".") {
+		if err := os.RemoveAll(filepath.Join(outdir, oldTarget)); err != nil {
+			g.logger().Warn("error removing previous directory", "dir", oldTarget, "error", err)
+		}
+	}
+	return nil
+}
+
+// replaceSymlink atomically replaces link (if it exists) with a
+// symlink to target.
+func replaceSymlink(target, link string) error {
+	tmplink := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".symlink")
+	os.Remove(tmplink)
+	if err := os.Symlink(target, tmplink); err != nil {
+		return err
+	}
+	if err := os.Rename(tmplink, link); err != nil {
+		os.Remove(tmplink)
+		return err
+	}
+	return nil
+}
+
+// extractAll extracts every entry in the archive in srcpath into
+// dir. Entries cannot escape dir, even via symlinks in the archive.
+func (g *Getter) extractAll(srcpath, dir string) error {
+	src, err := os.Open(srcpath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return walkArchive(src, func(name string, hdr *tar.Header, r io.Reader) error {
+		if name == "" {
+			return nil
+		}
+		err := g.extractEntry(root, name, hdr, r)
+		if err != nil {
+			return fmt.Errorf("error extracting %q: %s", name, err)
+		}
+		return nil
+	})
+}
+
+func (g *Getter) extractEntry(root *os.Root, name string, hdr *tar.Header, r io.Reader) error {
+	if dir := path.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	switch {
+	case hdr.Typeflag == tar.TypeDir:
+		if err := root.MkdirAll(name, 0777); err != nil {
+			return err
+		}
+	case hdr.Typeflag == tar.TypeReg:
+		mode := hdr.FileInfo().Mode().Perm() & ^umask
+		if g.FileMode != 0 {
+			mode = g.FileMode
+		}
+		f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if err == nil {
+			// Chmod, in case the archive mode is not
+			// writable, or FileMode is more permissive
+			// than the umask.
+			err = f.Chmod(mode)
+		}
+		if err == nil && !g.NoSync {
+			err = f.Sync()
+		}
+		if err == nil {
+			err = f.Close()
+		} else {
+			f.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if !hdr.ModTime.IsZero() {
+			if err := root.Chtimes(name, time.Now(), hdr.ModTime); err != nil {
+				return err
+			}
+		}
+	case hdr.Typeflag == tar.TypeSymlink && hdr.Linkname != "":
+		if err := root.Symlink(hdr.Linkname, name); err != nil {
+			return err
+		}
+	case hdr.Typeflag == tar.TypeLink:
+		if err := root.Link(cleanArchivePath(hdr.Linkname), name); err != nil {
+			return err
+		}
+	default:
+		g.logger().Debug("skipping unsupported archive entry", "name", name, "type", string(hdr.Typeflag))
+		return nil
+	}
+	if g.uid >= 0 || g.gid >= 0 {
+		return root.Lchown(name, g.uid, g.gid)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package getlatest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnpack(t *testing.T) {
+	zipData, tgzData := testArchives(t,
+		[2]string{"release-1.0/", ""},
+		[2]string{"release-1.0/README", "readme\n"},
+		[2]string{"release-1.0/bin/example", "#!/bin/sh\necho example\n"})
+	_, tgzData2 := testArchives(t,
+		[2]string{"release-1.1/README", "readme 1.1\n"})
+	data := map[string][]byte{
+		"/release.zip": zipData,
+		"/release.tgz": tgzData,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data[req.URL.Path])
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/release.zip", "/release.tgz"} {
+		outdir := t.TempDir()
+		g := &Getter{
+			URL:    srv.URL + path,
+			Output: filepath.Join(outdir, "release"),
+			Unpack: true,
+		}
+		err := g.Setup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if buf, err := ioutil.ReadFile(filepath.Join(g.Output, "release-1.0", "bin", "example")); err != nil || string(buf) != "#!/bin/sh\necho example\n" {
+			t.Errorf("%s: extracted file: %q, %v", path, buf, err)
+		}
+		first, err := os.Readlink(g.Output)
+		if err != nil {
+			t.Fatalf("%s: output is not a symlink: %s", path, err)
+		}
+
+		data[path] = tgzData2
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if buf, err := ioutil.ReadFile(filepath.Join(g.Output, "release-1.1", "README")); err != nil || string(buf) != "readme 1.1\n" {
+			t.Errorf("%s: extracted file after update: %q, %v", path, buf, err)
+		}
+		if _, err := os.Stat(filepath.Join(g.Output, "release-1.0")); !os.IsNotExist(err) {
+			t.Errorf("%s: old content still present after update: %v", path, err)
+		}
+		if _, err := os.Stat(filepath.Join(outdir, first)); !os.IsNotExist(err) {
+			t.Errorf("%s: previous directory %q not removed: %v", path, first, err)
+		}
+		if ents, err := os.ReadDir(outdir); err != nil || len(ents) != 2 {
+			t.Errorf("%s: expected symlink and one directory in output dir, got %v, %v", path, ents, err)
+		}
+	}
+}
+
+func TestUnpackEscape(t *testing.T) {
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside})
+	tw.WriteHeader(&tar.Header{Name: "evil/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+	tw.Write([]byte("pwnd"))
+	tw.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	outdir := t.TempDir()
+	g := &Getter{
+		URL:    srv.URL + "/evil.tar",
+		Output: filepath.Join(outdir, "evil"),
+		Unpack: true,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.trydownload(context.Background())
+	if err == nil {
+		t.Error("expected error")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "pwned")); !os.IsNotExist(err) {
+		t.Errorf("archive entry was written outside the output directory: %v", err)
+	}
+	if ents, err := os.ReadDir(outdir); err != nil || len(ents) != 0 {
+		t.Errorf("expected empty output dir after failure, got %v, %v", ents, err)
+	}
+}
+
+func TestUnpackSetup(t *testing.T) {
+	outdir := t.TempDir()
+	for _, g := range []*Getter{
+		{Unpack: true, ArchiveFilter: "*/README"},
+		{Unpack: true, KeepVersions: 2},
+		{Unpack: true, SkipUnchanged: true},
+	} {
+		g.URL = "http://localhost/release.tgz"
+		g.Output = filepath.Join(outdir, "release")
+		if err := g.Setup(); err == nil {
+			t.Errorf("%+v: expected Setup error", g)
+		}
+	}
+
+	// An existing output that is not a symlink is not replaced.
+	_, tgzData := testArchives(t, [2]string{"README", "readme\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(tgzData)
+	}))
+	defer srv.Close()
+	g := &Getter{
+		URL:    srv.URL + "/release.tgz",
+		Output: filepath.Join(outdir, "release"),
+		Unpack: true,
+	}
+	os.Mkdir(g.Output, 0777)
+	if err := g.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.trydownload(context.Background()); err == nil {
+		t.Error("expected error replacing a real directory")
+	}
+}
@@ -0,0 +1,40 @@
+package getlatest
+
+import (
+	"runtime/debug"
+)
+
+// Version is the getlatest version, reported in the default
+// User-Agent header. Release builds can set it with
+//
+//	go build -ldflags "-X github.com/tomclegg/getlatest.Version=v1.2.3"
+//
+// Otherwise, it is taken from the module build info if available.
+var Version = ""
+
+// version returns Version, or the module version from the build
+// info, or "devel".
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == "github.com/tomclegg/getlatest" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			return bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/tomclegg/getlatest" {
+				return dep.Version
+			}
+		}
+	}
+	return "devel"
+}
+
+// userAgent returns the User-Agent header value to send.
+func (g *Getter) userAgent() string {
+	if g.UserAgent != "" {
+		return g.UserAgent
+	}
+	return "getlatest/" + version()
+}
@@ -0,0 +1,137 @@
+package getlatest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const versionTimeFormat = "20060102T150405"
+
+// versionedTimeFormat names versions in Versioned mode. Unlike
+// archived copies, versions are named after the download time, and
+// several can be written in the same second.
+const versionedTimeFormat = "20060102T150405.000000000"
+
+// keepVersion archives the current output file (if any) as
+// Output.YYYYMMDDTHHMMSS, using its modification time, and removes
+// all but the newest KeepVersions archived copies.
+//
+// The archived copy is a hard link, so the output file stays in
+// place until it is replaced by the new version.
+func (g *Getter) keepVersion() error {
+	fi, err := os.Stat(g.Output)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	vpath := g.Output + "." + fi.ModTime().UTC().Format(versionTimeFormat)
+	err = os.Link(g.Output, vpath)
+	if os.IsExist(err) {
+		// already archived, e.g., previous attempt failed
+		// after linking
+	} else if err != nil {
+		return fmt.Errorf("error archiving previous version: %s", err)
+	}
+	return g.pruneVersions()
+}
+
+// versions returns the paths of archived copies of the output file,
+// oldest first. In Versioned mode, these are the files (or Unpack
+// directories) in Output.d, including the current version.
+func (g *Getter) versions() ([]string, error) {
+	outdir, outfile := filepath.Split(g.Output)
+	if outdir == "" {
+		outdir = "."
+	}
+	prefix, format := outfile+".", versionTimeFormat
+	if g.Versioned {
+		outdir, prefix, format = g.versionDir(), "", versionedTimeFormat
+	}
+	ents, err := ioutil.ReadDir(outdir)
+	if os.IsNotExist(err) && g.Versioned {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, ent := range ents {
+		name := ent.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		} else if !ent.Mode().IsRegular() && !(g.Versioned && ent.IsDir()) {
+			continue
+		}
+		suffix := name[len(prefix):]
+		if _, err := time.Parse(format, suffix); err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(outdir, name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (g *Getter) pruneVersions() error {
+	paths, err := g.versions()
+	if err != nil {
+		return err
+	}
+	keep := g.KeepVersions
+	if g.Versioned {
+		// paths includes the current version
+		keep++
+	}
+	for len(paths) > keep {
+		g.logger().Info("removing old version", "path", paths[0])
+		err = os.RemoveAll(paths[0])
+		if err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// versionDir returns the directory where Versioned mode writes each
+// version.
+func (g *Getter) versionDir() string {
+	return g.Output + ".d"
+}
+
+// newVersionPath returns an unused path in versionDir for a new
+// version, named after the current time.
+func (g *Getter) newVersionPath() (string, error) {
+	vdir := g.versionDir()
+	if err := os.MkdirAll(vdir, 0777); err != nil {
+		return "", err
+	}
+	for t := time.Now().UTC(); ; t = t.Add(time.Nanosecond) {
+		vpath := filepath.Join(vdir, t.Format(versionedTimeFormat))
+		if _, err := os.Lstat(vpath); os.IsNotExist(err) {
+			return vpath, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// switchVersion atomically points the output symlink to vpath, a new
+// version in versionDir, and prunes old versions.
+func (g *Getter) switchVersion(vpath string) error {
+	target := filepath.Join(filepath.Base(g.versionDir()), filepath.Base(vpath))
+	if err := replaceSymlink(target, g.Output); err != nil {
+		return fmt.Errorf("error updating symlink: %s", err)
+	}
+	if !g.NoSync {
+		if err := syncDir(filepath.Dir(g.Output)); err != nil {
+			g.logger().Warn("error syncing output directory", "error", err)
+		}
+	}
+	return g.pruneVersions()
+}
@@ -0,0 +1,158 @@
+package getlatest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeepVersions(t *testing.T) {
+	count := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		count++
+		fmt.Fprintf(w, "version %d\n", count)
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:          srv.URL + "/foo",
+		Output:       filepath.Join(tmpdir, "foo"),
+		KeepVersions: 2,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2019, 8, 28, 7, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Give each version a distinct, predictable mtime.
+		mtime = mtime.Add(time.Hour)
+		os.Chtimes(g.Output, mtime, mtime)
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "version 4\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+	paths, err := g.versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{g.Output + ".20190828T090000", g.Output + ".20190828T100000"}
+	if fmt.Sprint(paths) != fmt.Sprint(expect) {
+		t.Fatalf("expected versions %q, got %q", expect, paths)
+	}
+	for i, path := range paths {
+		if buf, err := ioutil.ReadFile(path); err != nil || string(buf) != fmt.Sprintf("version %d\n", i+2) {
+			t.Errorf("%s: %q, %v", path, buf, err)
+		}
+	}
+}
+
+func TestVersioned(t *testing.T) {
+	count := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		count++
+		fmt.Fprintf(w, "version %d\n", count)
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:          srv.URL + "/foo",
+		Output:       filepath.Join(tmpdir, "foo"),
+		Versioned:    true,
+		KeepVersions: 1,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reader *os.File
+	for i := 0; i < 4; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// A long-running reader keeps reading the
+			// version it opened.
+			reader, err = os.Open(g.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+		}
+	}
+	if buf, err := ioutil.ReadFile(g.Output); err != nil || string(buf) != "version 4\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+	if buf, err := ioutil.ReadAll(reader); err != nil || string(buf) != "version 1\n" {
+		t.Errorf("reader opened before updates: %q, %v", buf, err)
+	}
+	target, err := os.Readlink(g.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(target) != "foo.d" {
+		t.Errorf("symlink target %q is not in foo.d", target)
+	}
+	paths, err := g.versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[1] != filepath.Join(tmpdir, target) {
+		t.Fatalf("expected previous and current versions, got %q (current %q)", paths, target)
+	}
+	if buf, err := ioutil.ReadFile(paths[0]); err != nil || string(buf) != "version 3\n" {
+		t.Errorf("%s: %q, %v", paths[0], buf, err)
+	}
+}
+
+func TestVersionedUnpack(t *testing.T) {
+	count := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		count++
+		_, tgzData := testArchives(t, [2]string{"VERSION", fmt.Sprintf("%d\n", count)})
+		w.Write(tgzData)
+	}))
+	defer srv.Close()
+
+	tmpdir := t.TempDir()
+	g := &Getter{
+		URL:          srv.URL + "/foo.tgz",
+		Output:       filepath.Join(tmpdir, "foo"),
+		Versioned:    true,
+		Unpack:       true,
+		KeepVersions: 1,
+	}
+	err := g.Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = g.trydownload(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(g.Output, "VERSION")); err != nil || string(buf) != "3\n" {
+		t.Errorf("output file: %q, %v", buf, err)
+	}
+	ents, err := os.ReadDir(g.versionDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 || !ents[0].IsDir() || !ents[1].IsDir() {
+		t.Errorf("expected 2 version directories, got %v", ents)
+	}
+}